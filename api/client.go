@@ -1,16 +1,23 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
+	"net/url"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
 )
 
 const (
 	default_address = "http://127.0.0.1:11823"
+	// maximum size of single server-sent event.
+	maxEventSize = 4 << 20
 )
 
 type Client struct {
@@ -31,25 +38,94 @@ func NewClient(endpoint, key string) *Client {
 }
 
 func (c *Client) Chat(ctx context.Context, in ChatRequest) (*ChatResponse, error) {
-	const path = "v1/chat/completions"
-	urlString := fmt.Sprintf("%s/%s", c.Endpoint, path)
+	const path = "v1/agent/completions"
+	in.Version = agent.MessageVersion
+	return c.post(ctx, path, in)
+}
 
-	b, err := json.Marshal(in)
-	if err != nil {
-		return nil, err
+// resume failed run from its last checkpoint.
+func (c *Client) Resume(ctx context.Context, runID string) (*ChatResponse, error) {
+	path := fmt.Sprintf("v1/runs/%s/resume", url.PathEscape(runID))
+	return c.post(ctx, path, nil)
+}
+
+// approve, edit or reject tool calls of paused run, the run continue after it.
+func (c *Client) Approve(ctx context.Context, runID string, in ApprovalRequest) (*ChatResponse, error) {
+	path := fmt.Sprintf("v1/runs/%s/approval", url.PathEscape(runID))
+	return c.post(ctx, path, in)
+}
+
+// stream the run as server-sent events, the iteration ends after the final event.
+// error event from server is yielded as error.
+func (c *Client) ChatStream(ctx context.Context, in ChatRequest) iter.Seq2[StreamEvent, error] {
+	const path = "v1/agent/completions"
+	return func(yield func(StreamEvent, error) bool) {
+		in.Stream = true
+		in.Version = agent.MessageVersion
+		req, err := c.newRequest(ctx, path, in)
+		if err != nil {
+			yield(StreamEvent{}, err)
+			return
+		}
+		req.Header.Set("Accept", "text/event-stream")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			yield(StreamEvent{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode > 299 {
+			b, _ := io.ReadAll(resp.Body)
+			yield(StreamEvent{}, fmt.Errorf("API error: status %d, body: %s", resp.StatusCode, string(b)))
+			return
+		}
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+		var data []byte
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) > 0 {
+				// only data field is needed, the event name is repeated in the payload.
+				if v, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+					data = append(data, bytes.TrimPrefix(v, []byte(" "))...)
+				}
+				continue
+			}
+			if len(data) == 0 {
+				continue
+			}
+
+			var ev StreamEvent
+			if err := json.Unmarshal(data, &ev); err != nil {
+				yield(StreamEvent{}, fmt.Errorf("client failed decode event: %w", err))
+				return
+			}
+			data = data[:0]
+			if ev.Type == agent.EventError {
+				yield(ev, fmt.Errorf("API error: %s", ev.Error))
+				return
+			}
+			if !yield(ev, nil) || ev.Type == agent.EventFinal {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(StreamEvent{}, err)
+			return
+		}
+		yield(StreamEvent{}, fmt.Errorf("client stream closed before final event"))
 	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlString, bytes.NewReader(b))
+func (c *Client) post(ctx context.Context, path string, in any) (*ChatResponse, error) {
+	req, err := c.newRequest(ctx, path, in)
 	if err != nil {
-		return nil, fmt.Errorf("client failed create request: %v", err)
+		return nil, err
 	}
 
-	header := http.Header{}
-	header.Set("Content-Type", "application/json")
-	header.Set("Authorization", fmt.Sprintf("Bearer %s", c.key))
-
-	req.Header = header
-
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -69,3 +145,28 @@ func (c *Client) Chat(ctx context.Context, in ChatRequest) (*ChatResponse, error
 
 	return &out, nil
 }
+
+func (c *Client) newRequest(ctx context.Context, path string, in any) (*http.Request, error) {
+	urlString := fmt.Sprintf("%s/%s", c.Endpoint, path)
+
+	var body io.Reader = http.NoBody
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlString, body)
+	if err != nil {
+		return nil, fmt.Errorf("client failed create request: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", fmt.Sprintf("Bearer %s", c.key))
+
+	req.Header = header
+	return req, nil
+}
@@ -3,6 +3,7 @@ package api_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -15,6 +16,7 @@ import (
 
 func basicRequest() *api.ChatRequest {
 	return &api.ChatRequest{
+		Version: agent.MessageVersion,
 		Content: []*api.Message{
 			{
 				Role: "user",
@@ -78,3 +80,46 @@ func Test_client(t *testing.T) {
 		})
 	}
 }
+
+func Test_clientChatStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var gotReq api.ChatRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&gotReq))
+		assert.True(t, gotReq.Stream)
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: text_delta\ndata: {\"type\":\"text_delta\",\"text\":\"hel\"}\n\n")
+		fmt.Fprint(w, ": keep-alive comment\n\n")
+		fmt.Fprint(w, "event: text_delta\ndata: {\"type\":\"text_delta\",\"text\":\"lo\"}\n\n")
+		fmt.Fprint(w, "event: final\ndata: {\"type\":\"final\",\"run_id\":\"run-1\",\"response\":{\"text\":\"hello\",\"status\":\"completed\"}}\n\n")
+	}))
+	defer ts.Close()
+
+	cli := api.NewClient(ts.URL, "test-key")
+	var text string
+	var final *api.ChatResponse
+	for ev, err := range cli.ChatStream(context.Background(), *basicRequest()) {
+		require.NoError(t, err)
+		switch ev.Type {
+		case agent.EventTextDelta:
+			text += ev.Text
+		case agent.EventFinal:
+			final = ev.Response
+		}
+	}
+	assert.Equal(t, "hello", text)
+	require.NotNil(t, final)
+	assert.Equal(t, "hello", final.Text)
+
+	// error event
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":\"budget exceeded: steps\"}\n\n")
+	}))
+	defer ts.Close()
+
+	cli = api.NewClient(ts.URL, "test-key")
+	for _, err := range cli.ChatStream(context.Background(), *basicRequest()) {
+		require.EqualError(t, err, "API error: budget exceeded: steps")
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"time"
 
@@ -9,7 +10,21 @@ import (
 
 // Request
 type ChatRequest struct {
+	// message format of content, set to agent.MessageVersion by Client.
+	Version int        `json:"version,omitempty"`
 	Content []*Message `json:"content"`
+	// set by Client.ChatStream.
+	Stream bool `json:"stream,omitempty"`
+	// names of server tools the request may use, empty list disables tools.
+	Tools []string `json:"tools"`
+	// "auto", "none", "required" or name of the tool that must be called first.
+	ToolChoice string `json:"tool_choice,omitempty"`
+	// the final answer must be JSON matching the schema, see ChatResponse.Output.
+	ResponseSchema *agent.ParameterDefinition `json:"response_schema,omitempty"`
+	// ask the model to think, the thinking is returned in ChatResponse.Reasoning.
+	Reasoning bool `json:"reasoning,omitempty"`
+	// name of the server profile that run the request, empty is the default profile.
+	Profile string `json:"profile,omitempty"`
 }
 
 type Message agent.Message
@@ -33,6 +48,54 @@ type Message agent.Message
 type ChatResponse struct {
 	Created time.Time `json:"created"`
 	Text    string    `json:"text"`
+	// final answer parsed as JSON, set if ChatRequest.ResponseSchema is set.
+	Output json.RawMessage `json:"output,omitempty"`
+	// thinking of the model, set if ChatRequest.Reasoning is set.
+	Reasoning string `json:"reasoning,omitempty"`
+	// message format of messages.
+	Version int `json:"version"`
+	// use it to resume the run if it failed.
+	RunID  string `json:"run_id,omitempty"`
+	Status string `json:"status,omitempty"`
+	// tool calls that wait for approval, see Client.Approve.
+	Pending []*agent.ToolCall `json:"pending,omitempty"`
+	// messages appended by the run: assistant tool calls, tool responses and the final answer.
+	// append them to the history to keep it faithful.
+	Messages     []*Message   `json:"messages,omitempty"`
+	RequestID    string       `json:"request_id,omitempty"`
+	Model        string       `json:"model,omitempty"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+	Usage        agent.Usage  `json:"usage"`
+	Steps        []StepTiming `json:"steps,omitempty"`
+}
+
+// execution time of single graph node.
+type StepTiming struct {
+	Node       string    `json:"node"`
+	Start      time.Time `json:"start"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// server-sent event of streamed run, see Client.ChatStream.
+type StreamEvent struct {
+	agent.Event
+	// set in final event.
+	Response *ChatResponse `json:"response,omitempty"`
+}
+
+// run status
+const (
+	StatusCompleted       = "completed"
+	StatusPendingApproval = "pending_approval"
+)
+
+// decision of tool calls that wait for approval.
+type ApprovalRequest struct {
+	// keyed by tool call ID.
+	Decisions map[string]agent.Approval `json:"decisions"`
+	Reasoning bool                      `json:"reasoning,omitempty"`
+	// profile that started the run.
+	Profile string `json:"profile,omitempty"`
 }
 
 /* HELPER  */
@@ -57,7 +57,12 @@ func start(ctx context.Context) {
 		}
 
 		fmt.Printf(">model: %s \n\n", res.Text)
-		session.history = append(session.history, api.NewTextMessage("assistant", res.Text))
+		// keep tool calls and tool responses of the run in history.
+		if len(res.Messages) > 0 {
+			session.history = append(session.history, res.Messages...)
+		} else {
+			session.history = append(session.history, api.NewTextMessage("assistant", res.Text))
+		}
 	}
 
 }
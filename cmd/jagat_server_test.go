@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
@@ -35,6 +36,15 @@ func TestLoadAndValidate_Old(t *testing.T) {
 		assert.Equal(t, "ollama", cfg.Provider.Name)
 		assert.Equal(t, "qwen3:1.7b", cfg.Provider.Model)
 		assert.False(t, cfg.Server.Debug)
+		assert.Equal(t, 10, cfg.Agent.Budget.MaxToolCalls)
+		assert.Equal(t, 2*time.Minute, cfg.Agent.Budget.Timeout)
+		assert.Equal(t, 24*time.Hour, cfg.Agent.Checkpoint.TTL)
+		assert.Equal(t, 1000, cfg.Agent.Checkpoint.MaxRuns)
+		require.NotNil(t, cfg.Agent.ArgumentRetries)
+		assert.Equal(t, 2, *cfg.Agent.ArgumentRetries)
+		// compaction is disabled, the per model example is commented out.
+		assert.Equal(t, 0, cfg.Agent.Context.MaxTokens)
+		assert.Empty(t, cfg.Agent.Context.Models)
 	})
 
 	// --- Test Case 2: Flag overrides config file ---
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 )
 
@@ -13,12 +14,19 @@ type Agent struct {
 	provider Provider
 	tools    Tools
 
-	toolMaxCall int
+	budget          Budget
+	toolConcurrency int
+	argumentRetries int
+	graphBuilders   []GraphBuilder
+	checkpointer    Checkpointer
+	contextWindow   ContextWindow
+	instruction     string
 }
 
 func New(provider Provider, opts ...OptionFunc) *Agent {
 
-	o := options{}
+	// unset argument retries is told apart from 0.
+	o := options{argumentRetries: -1}
 
 	for _, fn := range opts {
 		fn(&o)
@@ -29,59 +37,367 @@ func New(provider Provider, opts ...OptionFunc) *Agent {
 	}
 
 	a := &Agent{
-		mx:          sync.Mutex{},
-		provider:    provider,
-		tools:       o.tools,
-		toolMaxCall: o.toolMaxCall,
+		mx:       sync.Mutex{},
+		provider: provider,
+		tools:    o.tools,
+		budget:   o.budget,
+
+		toolConcurrency: o.toolConcurrency,
+		argumentRetries: o.argumentRetries,
+		graphBuilders:   o.graphBuilders,
+		checkpointer:    o.checkpointer,
+		contextWindow:   o.contextWindow,
+		instruction:     o.instruction,
 	}
 
 	return a
 }
 
 type CompletionOptions struct {
+	// ask the model to think before answering, see Part.Thought.
 	Think  bool
 	Stream bool
+	// per request budget, it can only tighten the agent budget.
+	Budget Budget
+	// identify the run for checkpoint, generated if empty.
+	RunID string
+	// decision of tool calls that wait for approval, keyed by ToolCall.ID, resume only.
+	Approvals map[string]Approval
+	// names of tools the run may use, nil means all tools of the agent.
+	Tools []string
+	// "auto", "none", "required" or name of the tool that must be called first.
+	ToolChoice string
+	// override the provider temperature.
+	Temperature *float32
+	// the final answer must be JSON matching the schema, see Result.Output.
+	ResponseSchema *ParameterDefinition
+}
+
+type CompletionOption func(o *CompletionOptions)
+
+// limit the request with budget, limit that higher than agent budget is ignored.
+func WithCompletionBudget(b Budget) CompletionOption {
+	return func(o *CompletionOptions) {
+		o.Budget = b
+	}
+}
+
+// set the run ID, it is needed to resume the run if it failed.
+func WithRunID(id string) CompletionOption {
+	return func(o *CompletionOptions) {
+		o.RunID = id
+	}
+}
+
+// approve, edit or reject tool calls of paused run, see Agent.Resume.
+func WithApprovals(approvals map[string]Approval) CompletionOption {
+	return func(o *CompletionOptions) {
+		o.Approvals = approvals
+	}
+}
+
+// restrict the run to the named tools, no name means the run has no tools.
+func WithAllowedTools(names ...string) CompletionOption {
+	return func(o *CompletionOptions) {
+		o.Tools = append([]string{}, names...)
+	}
+}
+
+// control how the model call tools, see ToolChoiceAuto, ToolChoiceNone and ToolChoiceRequired.
+// any other value is name of the tool that must be called.
+// required and named choice only apply until the first tool result, so the run can still end.
+func WithToolChoice(choice string) CompletionOption {
+	return func(o *CompletionOptions) {
+		o.ToolChoice = choice
+	}
+}
+
+// ask the model to think before answering, the thinking is kept in Part.Thought apart from the answer.
+func WithThink(think bool) CompletionOption {
+	return func(o *CompletionOptions) {
+		o.Think = think
+	}
 }
 
-func (a *Agent) completionDag(ctx context.Context, msgs []*Message) (*Message, error) {
+// override the provider temperature for the run.
+func WithTemperature(t float32) CompletionOption {
+	return func(o *CompletionOptions) {
+		o.Temperature = &t
+	}
+}
+
+// constrain the final answer to JSON matching the schema.
+// the answer is validated and re-prompted a few times if it does not match, the parsed JSON is in Result.Output.
+func WithResponseSchema(schema ParameterDefinition) CompletionOption {
+	return func(o *CompletionOptions) {
+		o.ResponseSchema = &schema
+	}
+}
+
+func newCompletionOptions(opts []CompletionOption) CompletionOptions {
+	o := CompletionOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// tools the run may use.
+func (a *Agent) runTools(opts CompletionOptions) (Tools, error) {
+	if opts.Tools == nil {
+		return a.tools, nil
+	}
+	tools, err := a.tools.Only(opts.Tools...)
+	if err != nil {
+		return nil, &ErrInvalidOption{Err: fmt.Errorf("agent failed select tools: %w", err)}
+	}
+	return tools, nil
+}
+
+// build the execution graph for single run.
+func (a *Agent) graph(opts CompletionOptions) (*Graph, error) {
+	tools, err := a.runTools(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateToolChoice(opts.ToolChoice, tools); err != nil {
+		return nil, &ErrInvalidOption{Err: err}
+	}
+	if opts.ResponseSchema != nil {
+		if err := opts.ResponseSchema.lint("response_schema"); err != nil {
+			return nil, &ErrInvalidOption{Err: err}
+		}
+	}
+
+	// the answer of agent node is validated by output node if the run has response schema.
+	done := End
+	if opts.ResponseSchema != nil {
+		done = OutputNodeName
+	}
 
 	graph := NewGraph()
 	agentNode := AgentNode{
-		provider: a.provider,
-		tools:    a.tools.Def(),
+		provider:       a.provider,
+		tools:          tools.Def(),
+		toolChoice:     opts.ToolChoice,
+		think:          opts.Think,
+		temperature:    opts.Temperature,
+		responseSchema: opts.ResponseSchema,
 	}
 	graph.AddNode(&agentNode)
+	toolNode := NewToolNode(tools, a.toolConcurrency)
+	toolNode.SetArgumentRetries(a.argumentRetries)
+	graph.AddNode(toolNode)
 
-	for _, tool := range a.tools {
-		toolNode := NewToolNode(tool)
-		graph.AddNode(toolNode)
+	graph.SetEntryPoint(AgentNodeName)
+	graph.AddConditionalEdge(AgentNodeName, func(state State) string {
+		if RouteToolCalls(state) == End {
+			return done
+		}
+		return ToolNodeName
+	}, ToolNodeName, done)
+	graph.AddEdge(ToolNodeName, AgentNodeName)
+
+	if opts.ResponseSchema != nil {
+		graph.AddNode(NewOutputNode(a.provider, *opts.ResponseSchema, opts.Temperature))
+		graph.SetFinishPoint(OutputNodeName)
 	}
 
-	copyMsg := make([]*Message, len(msgs))
-	copy(copyMsg, msgs)
+	// long history is compacted once before the first provider call.
+	if a.contextWindow.MaxTokens > 0 {
+		if err := a.contextWindow.validate(); err != nil {
+			return nil, err
+		}
+		graph.AddNode(NewCompactNode(a.contextWindow, a.provider))
+		graph.SetEntryPoint(CompactNodeName)
+		graph.AddEdge(CompactNodeName, AgentNodeName)
+	}
+
+	// sensitive tool calls wait for approval before executed.
+	if slices.ContainsFunc(tools, requireApproval) {
+		graph.AddNode(NewApprovalNode(tools))
+		graph.AddConditionalEdge(AgentNodeName, func(state State) string {
+			if RouteToolCalls(state) == End {
+				return done
+			}
+			return ApprovalNodeName
+		}, ApprovalNodeName, done)
+		graph.AddEdge(ApprovalNodeName, ToolNodeName)
+	}
+
+	// the final answer after budget exceeded is produced without tools.
+	var final Node = &AgentNode{provider: a.provider, temperature: opts.Temperature, responseSchema: opts.ResponseSchema}
+	if opts.ResponseSchema != nil {
+		final = &outputFinalNode{answer: final, output: NewOutputNode(a.provider, *opts.ResponseSchema, opts.Temperature)}
+	}
+	graph.SetBudget(a.budget.Tighten(opts.Budget), final)
+
+	// custom flow on top of default nodes.
+	for _, fn := range a.graphBuilders {
+		if err := fn(graph); err != nil {
+			return nil, fmt.Errorf("agent failed customize graph: %w", err)
+		}
+	}
+	if err := graph.Build(); err != nil {
+		return nil, err
+	}
+	if a.checkpointer != nil {
+		graph.SetCheckpointer(a.checkpointer)
+	}
+	return graph, nil
+}
+
+// returned when the completion options do not fit the agent, e.g unknown tool name.
+type ErrInvalidOption struct {
+	Err error
+}
+
+func (e *ErrInvalidOption) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ErrInvalidOption) Unwrap() error {
+	return e.Err
+}
+
+func validateToolChoice(choice string, tools Tools) error {
+	switch choice {
+	case "", ToolChoiceAuto, ToolChoiceNone:
+		return nil
+	case ToolChoiceRequired:
+		if len(tools) == 0 {
+			return fmt.Errorf("agent tool choice '%s' but the run has no tools", choice)
+		}
+		return nil
+	default:
+		if _, ok := tools.Get(choice); !ok {
+			return fmt.Errorf("agent tool choice: tool '%s' not found", choice)
+		}
+		return nil
+	}
+}
+
+func (a *Agent) completionDag(ctx context.Context, msgs []*Message, opts CompletionOptions) (*Result, error) {
+	graph, err := a.graph(opts)
+	if err != nil {
+		return nil, err
+	}
+	return a.run(ctx, graph, msgs, opts)
+}
+
+func (a *Agent) run(ctx context.Context, graph *Graph, msgs []*Message, opts CompletionOptions) (*Result, error) {
+	state, err := a.runState(ctx, graph, msgs, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(state), nil
+}
+
+// run the graph, the state is returned on error too, e.g for usage spent before the run failed.
+func (a *Agent) runState(ctx context.Context, graph *Graph, msgs []*Message, opts CompletionOptions) (State, error) {
+	copyMsg := make([]*Message, 0, len(msgs)+1)
+	if a.instruction != "" {
+		copyMsg = append(copyMsg, NewTextMessage(RoleSystem, a.instruction))
+	}
+	copyMsg = append(copyMsg, msgs...)
+	// resume only need what shape the graph.
+	runOpts := opts
+	runOpts.RunID, runOpts.Approvals, runOpts.Stream = "", nil, false
 	initState := State{
+		RunID:   opts.RunID,
 		Message: copyMsg,
+		Input:   len(copyMsg),
+		Options: &runOpts,
 	}
 
-	return graph.Run(ctx, "agent", initState)
+	return graph.runState(ctx, initState)
 }
 
-func (a *Agent) Completion(ctx context.Context, msgs []*Message) (*Message, error) {
-	return a.completionDag(ctx, msgs)
+func (a *Agent) Completion(ctx context.Context, msgs []*Message, opts ...CompletionOption) (*Result, error) {
+	return a.completionDag(ctx, msgs, newCompletionOptions(opts))
 }
 
+// run the completion in background and stream its events.
+// the channel is closed after EventFinal or EventError, the caller must drain it or cancel ctx.
+func (a *Agent) CompletionStream(ctx context.Context, msgs []*Message, opts ...CompletionOption) (<-chan Event, error) {
+	o := newCompletionOptions(opts)
+	graph, err := a.graph(o)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event, 16)
+	send := func(ev Event) {
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(events)
+		// the run ID is generated by the graph when the caller does not set it.
+		state, err := a.runState(WithEmitter(ctx, send), graph, msgs, o)
+		if err != nil {
+			send(Event{Type: EventError, RunID: state.RunID, Error: err.Error(), Err: err})
+			return
+		}
+		res := newResult(state)
+		send(Event{Type: EventFinal, RunID: res.RunID, Message: res.Message, Result: res})
+	}()
+
+	return events, nil
+}
+
+// continue failed or paused run from its last checkpoint, agent must be created WithCheckpointer.
+// run that wait for approval return *Interrupt with *PendingApproval value, resume it WithApprovals.
+// the run keep the options it is started with, opts can only tighten its budget and give approvals.
+func (a *Agent) Resume(ctx context.Context, runID string, opts ...CompletionOption) (*Result, error) {
+	if a.checkpointer == nil {
+		return nil, fmt.Errorf("agent has no checkpointer, resume is disabled")
+	}
+	cp, err := a.checkpointer.Load(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed load checkpoint '%s': %w", runID, err)
+	}
+	o := newCompletionOptions(opts)
+	// checkpoint saved before the options are kept is resumed with the given options.
+	if stored := cp.State.Options; stored != nil {
+		resumed := *stored
+		resumed.Budget = stored.Budget.Tighten(o.Budget)
+		resumed.Approvals = o.Approvals
+		o = resumed
+	}
+	graph, err := a.graph(o)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := a.runTools(o)
+	if err != nil {
+		return nil, err
+	}
+	updates := []StateUpdate{}
+	if len(o.Approvals) > 0 {
+		updates = append(updates, withApprovals(tools, o.Approvals))
+	}
+	state, err := graph.resumeState(ctx, runID, updates...)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(state), nil
+}
 
-//Deprecate, subjet to remove.
+// Deprecate, subjet to remove.
 func (a *Agent) completion(ctx context.Context, msgs []*Message) (*Message, error) {
 	currentHistory := make([]*Message, len(msgs))
 	copy(currentHistory, msgs)
 
-	for i := 0; i < a.toolMaxCall; i++ {
+	for i := 0; i < a.budget.MaxToolCalls; i++ {
 		resp, err := a.provider.Chat(ctx, CCReq{
 			// Model:      a.model,
 			Messages:   currentHistory,
 			Tools:      a.tools.Def(),
-			ToolChoice: "auto",
+			ToolChoice: ToolChoiceAuto,
 		})
 
 		if err != nil {
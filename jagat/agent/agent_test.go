@@ -158,3 +158,253 @@ func TestAgent_Completions(t *testing.T) {
 		})
 	}
 }
+
+func TestAgent_ParallelToolCalls(t *testing.T) {
+	tp, err := tooldef.Build(t.Context(), []tooldef.Config{{Name: xtime.Namespace}})
+	require.NoError(t, err)
+
+	var toolMsg *agent.Message
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			if len(req.Messages) == 1 {
+				return &agent.CCRes{
+					Choices: []agent.Choice{
+						{
+							ToolCalls: []*agent.ToolCall{
+								{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "get_current_time", Arguments: `{}`}},
+								{ID: "call_2", Type: "function", Function: agent.FunctionCall{Name: "unknown_tool", Arguments: `{}`}},
+								{ID: "call_3", Type: "function", Function: agent.FunctionCall{Name: "get_current_time", Arguments: `{}`}},
+							},
+						},
+					},
+				}, nil
+			}
+			toolMsg = req.Messages[len(req.Messages)-1]
+			return &agent.CCRes{Choices: []agent.Choice{{Text: "done"}}}, nil
+		},
+	}
+
+	a := agent.New(provider, agent.WithTool(tp...), agent.WithToolConcurrency(2))
+	msg, err := a.Completion(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "what time is it?")})
+	require.NoError(t, err)
+	assert.Equal(t, "done", msg.Text())
+
+	// all calls answered in one tool message, in the order of the calls.
+	require.NotNil(t, toolMsg)
+	assert.Equal(t, agent.RoleTool, toolMsg.Role)
+	require.Len(t, toolMsg.Parts, 3)
+	for i, id := range []string{"call_1", "call_2", "call_3"} {
+		require.NotNil(t, toolMsg.Parts[i].ToolResponse)
+		assert.Equal(t, id, toolMsg.Parts[i].ToolResponse.ID)
+	}
+	assert.Contains(t, toolMsg.Parts[0].ToolResponse.Output, "current_time_utc")
+	assert.Contains(t, toolMsg.Parts[1].ToolResponse.Output, "error")
+	assert.Equal(t, "get_current_time", toolMsg.Parts[2].ToolResponse.Name)
+}
+
+func TestAgent_AllowedTools(t *testing.T) {
+	tp, err := tooldef.Build(t.Context(), []tooldef.Config{{Name: xtime.Namespace}})
+	require.NoError(t, err)
+
+	var gotTools []agent.Tool
+	var gotTemperature *float32
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			gotTools = req.Tools
+			gotTemperature = req.Temperature
+			return &agent.CCRes{Choices: []agent.Choice{{Text: "done"}}}, nil
+		},
+	}
+	a := agent.New(provider, agent.WithTool(tp...))
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hello")}
+
+	_, err = a.Completion(t.Context(), msgs)
+	require.NoError(t, err)
+	assert.Len(t, gotTools, 1)
+	assert.Nil(t, gotTemperature)
+
+	_, err = a.Completion(t.Context(), msgs, agent.WithAllowedTools(), agent.WithTemperature(0.2))
+	require.NoError(t, err)
+	assert.Empty(t, gotTools)
+	require.NotNil(t, gotTemperature)
+	assert.Equal(t, float32(0.2), *gotTemperature)
+
+	_, err = a.Completion(t.Context(), msgs, agent.WithAllowedTools("unknown_tool"))
+	require.EqualError(t, err, "agent failed select tools: tool 'unknown_tool' not found")
+}
+
+func TestAgent_ToolChoice(t *testing.T) {
+	// call the tool while it is forced, then answer.
+	var choices []string
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			choices = append(choices, req.ToolChoice)
+			if req.ToolChoice != "send_message" {
+				return &agent.CCRes{Choices: []agent.Choice{{Text: "done"}}}, nil
+			}
+			return &agent.CCRes{Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+				{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}},
+			}}}}, nil
+		},
+	}
+	tool := &countingTool{}
+	a := agent.New(provider, agent.WithTool(tool))
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hello")}
+
+	res, err := a.Completion(t.Context(), msgs, agent.WithToolChoice("send_message"))
+	require.NoError(t, err)
+	assert.Equal(t, "done", res.Text())
+	assert.Equal(t, []string{"send_message", "auto"}, choices)
+	assert.Equal(t, int32(1), tool.calls.Load())
+
+	choices = nil
+	_, err = a.Completion(t.Context(), msgs, agent.WithToolChoice("none"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"none"}, choices)
+
+	_, err = a.Completion(t.Context(), msgs, agent.WithToolChoice("unknown_tool"))
+	require.EqualError(t, err, "agent tool choice: tool 'unknown_tool' not found")
+
+	_, err = a.Completion(t.Context(), msgs, agent.WithAllowedTools(), agent.WithToolChoice("required"))
+	require.EqualError(t, err, "agent tool choice 'required' but the run has no tools")
+}
+
+func TestAgent_Budget(t *testing.T) {
+	tp, err := tooldef.Build(t.Context(), []tooldef.Config{{Name: xtime.Namespace}})
+	require.NoError(t, err)
+
+	// keep calling tool as long as tools are provided.
+	greedyProvider := func(obeyToolLess bool) *mockProvider {
+		return &mockProvider{
+			ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+				if len(req.Tools) == 0 && obeyToolLess {
+					return &agent.CCRes{Choices: []agent.Choice{{Text: "final answer"}}}, nil
+				}
+				return &agent.CCRes{
+					Choices: []agent.Choice{
+						{
+							ToolCalls: []*agent.ToolCall{
+								{ID: "call", Type: "function", Function: agent.FunctionCall{Name: "get_current_time", Arguments: `{}`}},
+							},
+						},
+					},
+				}, nil
+			},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		provider      agent.Provider
+		budget        agent.Budget
+		reqBudget     agent.Budget
+		expectedText  string
+		expectedLimit string
+	}{
+		{
+			name:         "final answer after max tool calls",
+			provider:     greedyProvider(true),
+			budget:       agent.Budget{MaxToolCalls: 2},
+			expectedText: "final answer",
+		},
+		{
+			name:         "final answer after max steps",
+			provider:     greedyProvider(true),
+			budget:       agent.Budget{MaxSteps: 3},
+			expectedText: "final answer",
+		},
+		{
+			name:         "request budget tighten agent budget",
+			provider:     greedyProvider(true),
+			budget:       agent.Budget{MaxCallsPerTool: 10},
+			reqBudget:    agent.Budget{MaxCallsPerTool: 1},
+			expectedText: "final answer",
+		},
+		{
+			name:          "error when final answer still call tool",
+			provider:      greedyProvider(false),
+			budget:        agent.Budget{MaxCallsPerTool: 1},
+			expectedLimit: agent.LimitCallsPerTool,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := agent.New(tc.provider, agent.WithTool(tp...), agent.WithBudget(tc.budget))
+			msg, err := a.Completion(
+				t.Context(),
+				[]*agent.Message{agent.NewTextMessage(agent.RoleUser, "what time is it?")},
+				agent.WithCompletionBudget(tc.reqBudget),
+			)
+
+			if tc.expectedLimit != "" {
+				var budgetErr *agent.ErrBudgetExceeded
+				require.ErrorAs(t, err, &budgetErr)
+				assert.Equal(t, tc.expectedLimit, budgetErr.Limit)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedText, msg.Text())
+		})
+	}
+}
+
+func TestAgent_Think(t *testing.T) {
+	var gotThink []bool
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			gotThink = append(gotThink, req.Think)
+			// the thought of previous turn is kept in history.
+			if len(req.Messages) > 1 {
+				return &agent.CCRes{Choices: []agent.Choice{{Text: "noon", Thought: "clock said 12"}}}, nil
+			}
+			return &agent.CCRes{Choices: []agent.Choice{{Thought: "need the clock", ToolCalls: []*agent.ToolCall{
+				{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}},
+			}}}}, nil
+		},
+	}
+	a := agent.New(provider, agent.WithTool(&countingTool{}))
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "what time is it?")}
+
+	res, err := a.Completion(t.Context(), msgs, agent.WithThink(true))
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, gotThink)
+	assert.Equal(t, "noon", res.Text())
+	assert.Equal(t, "clock said 12", res.Message.Thought())
+	require.Len(t, res.Message.Parts, 2)
+	assert.Equal(t, "clock said 12", res.Message.Parts[0].Thought)
+	assert.Empty(t, res.Message.Parts[0].Text)
+
+	// thought before tool call is kept with the calls.
+	callMsg := res.Messages[0]
+	assert.Equal(t, "need the clock", callMsg.Parts[0].Thought)
+	assert.Len(t, callMsg.ToolCalls(), 1)
+	assert.Equal(t, "need the clock\n\nclock said 12", res.Reasoning())
+
+	gotThink = nil
+	_, err = a.Completion(t.Context(), msgs)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, false}, gotThink)
+}
+
+func TestAgent_Instruction(t *testing.T) {
+	var got []*agent.Message
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			got = req.Messages
+			return &agent.CCRes{Choices: []agent.Choice{{Text: "hello"}}}, nil
+		},
+	}
+	a := agent.New(provider, agent.WithInstruction("you are a support agent"))
+
+	res, err := a.Completion(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, agent.RoleSystem, got[0].Role)
+	assert.Equal(t, "you are a support agent", got[0].Text())
+	assert.Equal(t, "hi", got[1].Text())
+
+	// the instruction is not part of the run output.
+	require.Len(t, res.Messages, 1)
+	assert.Equal(t, "hello", res.Messages[0].Text())
+}
@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// name of the node that pause the run until sensitive tool calls are approved.
+const ApprovalNodeName = "approval"
+
+// implemented by tool provider that must not be executed without human approval.
+type ApprovalRequirer interface {
+	RequireApproval() bool
+}
+
+type approvalTool struct {
+	ToolProvider
+}
+
+func (at *approvalTool) RequireApproval() bool {
+	return true
+}
+
+// wrap tool provider so every call of it need approval before executed.
+func RequireApproval(tp ToolProvider) ToolProvider {
+	return &approvalTool{ToolProvider: tp}
+}
+
+func requireApproval(tp ToolProvider) bool {
+	ar, ok := tp.(ApprovalRequirer)
+	return ok && ar.RequireApproval()
+}
+
+type ApprovalAction string
+
+const (
+	ApprovalApprove ApprovalAction = "approve"
+	// approve with different arguments.
+	ApprovalEdit   ApprovalAction = "edit"
+	ApprovalReject ApprovalAction = "reject"
+)
+
+// human decision of single tool call.
+type Approval struct {
+	Action ApprovalAction `json:"action"`
+	// replacement of tool call arguments, edit only.
+	Arguments string `json:"arguments,omitempty"`
+	// explanation sent to the model, reject only.
+	Reason string `json:"reason,omitempty"`
+}
+
+func (a Approval) validate() error {
+	switch a.Action {
+	case ApprovalApprove, ApprovalReject:
+	case ApprovalEdit:
+		if !json.Valid([]byte(a.Arguments)) {
+			return fmt.Errorf("edited arguments is not valid json")
+		}
+	default:
+		return fmt.Errorf("unknown approval action '%s'", a.Action)
+	}
+	return nil
+}
+
+// Interrupt value when the run wait for tool calls approval.
+type PendingApproval struct {
+	// tool calls that need approval, keyed by the decision with ToolCall.ID.
+	Calls []*ToolCall
+}
+
+// pause the run if pending tool calls need approval and has no decision.
+type ApprovalNode struct {
+	tools Tools
+}
+
+func NewApprovalNode(tools Tools) *ApprovalNode {
+	return &ApprovalNode{tools: tools}
+}
+
+func (an *ApprovalNode) Name() string {
+	return ApprovalNodeName
+}
+
+func (an *ApprovalNode) Execute(ctx context.Context, state State) (State, error) {
+	_, span := tracer.Start(ctx, "ApprovalNode.Execute")
+	defer span.End()
+
+	if calls := pendingApprovals(an.tools, state); len(calls) > 0 {
+		return state, &Interrupt{Value: &PendingApproval{Calls: calls}}
+	}
+
+	// apply edited arguments, rejected call is handled by tool node.
+	// the message is copied, the checkpoint share it with the state.
+	lastMsg := state.Message[len(state.Message)-1]
+	edited := &Message{Role: lastMsg.Role, Parts: slices.Clone(lastMsg.Parts)}
+	var changed bool
+	for i, part := range edited.Parts {
+		if part.Toolcall == nil {
+			continue
+		}
+		approval, ok := state.Approvals[part.Toolcall.ID]
+		if !ok || approval.Action != ApprovalEdit {
+			continue
+		}
+		tc := *part.Toolcall
+		tc.Function.Arguments = approval.Arguments
+		p := *part
+		p.Toolcall = &tc
+		edited.Parts[i] = &p
+		changed = true
+	}
+	if changed {
+		state.Message = append(slices.Clone(state.Message[:len(state.Message)-1]), edited)
+	}
+	return state, nil
+}
+
+// tool calls of the last message that need approval and has no decision yet.
+func pendingApprovals(tools Tools, state State) []*ToolCall {
+	if len(state.Message) == 0 {
+		return nil
+	}
+	var calls []*ToolCall
+	for _, tc := range state.Message[len(state.Message)-1].ToolCalls() {
+		tp, ok := tools.Get(tc.Function.Name)
+		if !ok || !requireApproval(tp) {
+			continue
+		}
+		if _, decided := state.Approvals[tc.ID]; !decided {
+			calls = append(calls, tc)
+		}
+	}
+	return calls
+}
+
+// record the decisions into the state of paused run, only pending tool call can be decided.
+// the decision is removed once the tool node used it, see ToolNode.Execute.
+func withApprovals(tools Tools, approvals map[string]Approval) StateUpdate {
+	return func(state *State) error {
+		pending := map[string]bool{}
+		for _, tc := range pendingApprovals(tools, *state) {
+			pending[tc.ID] = true
+		}
+		decided := maps.Clone(state.Approvals)
+		if decided == nil {
+			decided = map[string]Approval{}
+		}
+		for id, approval := range approvals {
+			if !pending[id] {
+				return &ErrInvalidOption{Err: fmt.Errorf("tool call '%s' is not pending approval", id)}
+			}
+			if err := approval.validate(); err != nil {
+				return &ErrInvalidOption{Err: fmt.Errorf("tool call '%s': %w", id, err)}
+			}
+			decided[id] = approval
+		}
+		state.Approvals = decided
+		return nil
+	}
+}
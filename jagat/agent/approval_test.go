@@ -0,0 +1,145 @@
+package agent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// record the arguments of every call.
+type recordTool struct {
+	countingTool
+	args []string
+}
+
+func (rt *recordTool) Call(ctx context.Context, fc agent.FunctionCall) (*agent.ToolResponse, error) {
+	rt.args = append(rt.args, fc.Arguments)
+	return rt.countingTool.Call(ctx, fc)
+}
+
+func TestAgent_Approval(t *testing.T) {
+	testCases := []struct {
+		name           string
+		approval       agent.Approval
+		expectedArgs   []string
+		expectedOutput string
+	}{
+		{
+			name:           "approve",
+			approval:       agent.Approval{Action: agent.ApprovalApprove},
+			expectedArgs:   []string{`{"text":"hello"}`},
+			expectedOutput: "sent",
+		},
+		{
+			name:           "edit",
+			approval:       agent.Approval{Action: agent.ApprovalEdit, Arguments: `{"text":"hi"}`},
+			expectedArgs:   []string{`{"text":"hi"}`},
+			expectedOutput: "sent",
+		},
+		{
+			name:           "reject",
+			approval:       agent.Approval{Action: agent.ApprovalReject, Reason: "not now"},
+			expectedArgs:   nil,
+			expectedOutput: "reason",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tool := &recordTool{}
+			var toolResp *agent.ToolResponse
+			provider := &mockProvider{
+				ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+					if len(req.Messages) == 1 {
+						return &agent.CCRes{Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+							{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{"text":"hello"}`}},
+						}}}}, nil
+					}
+					toolResp = req.Messages[len(req.Messages)-1].Parts[0].ToolResponse
+					return &agent.CCRes{Choices: []agent.Choice{{Text: "done"}}}, nil
+				},
+			}
+
+			a := agent.New(
+				provider,
+				agent.WithTool(agent.RequireApproval(tool)),
+				agent.WithCheckpointer(agent.NewMemoryCheckpointer()),
+			)
+			msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "send hello")}
+			_, err := a.Completion(t.Context(), msgs, agent.WithRunID("run-1"))
+
+			var interrupt *agent.Interrupt
+			require.ErrorAs(t, err, &interrupt)
+			assert.Equal(t, "run-1", interrupt.RunID)
+			pending, ok := interrupt.Value.(*agent.PendingApproval)
+			require.True(t, ok)
+			require.Len(t, pending.Calls, 1)
+			assert.Equal(t, "call_1", pending.Calls[0].ID)
+			assert.Equal(t, int32(0), tool.calls.Load())
+
+			msg, err := a.Resume(t.Context(), "run-1", agent.WithApprovals(map[string]agent.Approval{"call_1": tc.approval}))
+			require.NoError(t, err)
+			assert.Equal(t, "done", msg.Text())
+			assert.Equal(t, tc.expectedArgs, tool.args)
+			require.NotNil(t, toolResp)
+			assert.Equal(t, "call_1", toolResp.ID)
+			assert.Contains(t, toolResp.Output, tc.expectedOutput)
+			// the edit is applied to a copy, the paused history keeps the original call.
+			assert.Equal(t, `{"text":"hello"}`, pending.Calls[0].Function.Arguments)
+		})
+	}
+}
+
+func TestAgent_ApprovalWithoutCheckpointer(t *testing.T) {
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			return &agent.CCRes{Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+				{Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}},
+			}}}}, nil
+		},
+	}
+	a := agent.New(provider, agent.WithTool(agent.RequireApproval(&countingTool{})))
+	_, err := a.Completion(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "send")})
+	require.EqualError(t, err, "node 'approval' cannot pause the run without checkpointer")
+}
+
+func TestAgent_ApprovalIsUsedOnce(t *testing.T) {
+	tool := &recordTool{}
+	// the provider reuse the same ID in every turn.
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			if len(req.Messages) < 5 {
+				return &agent.CCRes{Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+					{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{"text":"hello"}`}},
+				}}}}, nil
+			}
+			return &agent.CCRes{Choices: []agent.Choice{{Text: "done"}}}, nil
+		},
+	}
+	a := agent.New(
+		provider,
+		agent.WithTool(agent.RequireApproval(tool)),
+		agent.WithCheckpointer(agent.NewMemoryCheckpointer()),
+	)
+	_, err := a.Completion(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "send hello twice")}, agent.WithRunID("run-1"))
+	var interrupt *agent.Interrupt
+	require.ErrorAs(t, err, &interrupt)
+
+	_, err = a.Resume(t.Context(), "run-1", agent.WithApprovals(map[string]agent.Approval{"call_2": {Action: agent.ApprovalApprove}}))
+	var optionErr *agent.ErrInvalidOption
+	require.ErrorAs(t, err, &optionErr)
+	assert.EqualError(t, optionErr, "tool call 'call_2' is not pending approval")
+
+	// the second call is paused again although it has the same ID.
+	_, err = a.Resume(t.Context(), "run-1", agent.WithApprovals(map[string]agent.Approval{"call_1": {Action: agent.ApprovalEdit, Arguments: `{"text":"hi"}`}}))
+	require.ErrorAs(t, err, &interrupt)
+	assert.Equal(t, []string{`{"text":"hi"}`}, tool.args)
+
+	msg, err := a.Resume(t.Context(), "run-1", agent.WithApprovals(map[string]agent.Approval{"call_1": {Action: agent.ApprovalApprove}}))
+	require.NoError(t, err)
+	assert.Equal(t, "done", msg.Text())
+	assert.Equal(t, []string{`{"text":"hi"}`, `{"text":"hello"}`}, tool.args)
+}
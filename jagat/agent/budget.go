@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+)
+
+// limits the work a single graph run is allowed to do.
+// zero value of each field means unlimited.
+type Budget struct {
+	// maximum number of node executions.
+	MaxSteps int `yaml:"maxSteps"`
+	// maximum number of tool calls across all tools.
+	MaxToolCalls int `yaml:"maxToolCalls"`
+	// maximum number of calls for each tool.
+	MaxCallsPerTool int `yaml:"maxCallsPerTool"`
+	// maximum wall-clock time of the run.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// return budget that only allow the lowest limit of b and other.
+// it is use to apply per request budget without exceed the configured one.
+func (b Budget) Tighten(other Budget) Budget {
+	b.MaxSteps = minLimit(b.MaxSteps, other.MaxSteps)
+	b.MaxToolCalls = minLimit(b.MaxToolCalls, other.MaxToolCalls)
+	b.MaxCallsPerTool = minLimit(b.MaxCallsPerTool, other.MaxCallsPerTool)
+	b.Timeout = minLimit(b.Timeout, other.Timeout)
+	return b
+}
+
+func minLimit[T int | time.Duration](a, b T) T {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+	return min(a, b)
+}
+
+// check if state is allowed to execute another node.
+func (b Budget) checkStep(state State) error {
+	if b.MaxSteps > 0 && state.Steps >= b.MaxSteps {
+		return &ErrBudgetExceeded{Limit: LimitSteps, Detail: fmt.Sprintf("max %d steps", b.MaxSteps)}
+	}
+	return nil
+}
+
+// check if state is allowed to execute pending tool calls.
+func (b Budget) checkToolCalls(state State, pending []*ToolCall) error {
+	if b.MaxToolCalls > 0 {
+		total := len(pending)
+		for _, n := range state.ToolCalls {
+			total += n
+		}
+		if total > b.MaxToolCalls {
+			return &ErrBudgetExceeded{Limit: LimitToolCalls, Detail: fmt.Sprintf("max %d tool calls", b.MaxToolCalls)}
+		}
+	}
+
+	if b.MaxCallsPerTool > 0 {
+		perTool := map[string]int{}
+		for _, tc := range pending {
+			perTool[tc.Function.Name]++
+		}
+		for name, n := range perTool {
+			if state.ToolCalls[name]+n > b.MaxCallsPerTool {
+				return &ErrBudgetExceeded{
+					Limit:  LimitCallsPerTool,
+					Detail: fmt.Sprintf("max %d calls for tool '%s'", b.MaxCallsPerTool, name),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// limit names reported by ErrBudgetExceeded.
+const (
+	LimitSteps        = "steps"
+	LimitToolCalls    = "tool_calls"
+	LimitCallsPerTool = "calls_per_tool"
+	LimitTimeout      = "timeout"
+)
+
+// returned when a run hit one of its Budget limits and no final answer could be produced.
+type ErrBudgetExceeded struct {
+	// which limit is hit.
+	Limit string
+	// human readable description of the limit.
+	Detail string
+}
+
+func (e *ErrBudgetExceeded) Error() string {
+	return fmt.Sprintf("budget exceeded: %s", e.Detail)
+}
@@ -0,0 +1,237 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+// snapshot of a run after a node is executed.
+type Checkpoint struct {
+	RunID string
+	// node executed next when the run is resumed.
+	Next  string
+	State State
+	// time the checkpoint is saved.
+	Updated time.Time
+}
+
+// persist checkpoint of graph run, so failed run can be resumed.
+type Checkpointer interface {
+	// save or replace the checkpoint of the run.
+	Save(ctx context.Context, cp *Checkpoint) error
+	// load the last checkpoint of the run, return ErrCheckpointNotFound if not exist.
+	Load(ctx context.Context, runID string) (*Checkpoint, error)
+	// delete the checkpoint of the run, it is called when the run finished.
+	Delete(ctx context.Context, runID string) error
+}
+
+// generate random run ID.
+func NewRunID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// copy slices and maps so later node execution does not modify it.
+func (s State) clone() State {
+	s.Message = append([]*Message(nil), s.Message...)
+	s.ToolCalls = maps.Clone(s.ToolCalls)
+	s.InvalidCalls = maps.Clone(s.InvalidCalls)
+	s.Approvals = maps.Clone(s.Approvals)
+	s.Timings = append([]StepTiming(nil), s.Timings...)
+	return s
+}
+
+var _ Checkpointer = (*MemoryCheckpointer)(nil)
+
+const (
+	// default time a checkpoint is kept in memory after its last save.
+	DefaultCheckpointTTL = 24 * time.Hour
+	// default number of runs kept in memory.
+	DefaultMaxCheckpoints = 1000
+)
+
+// keep checkpoints in process memory, it is lost when process exit.
+// failed, cancelled and paused run is never finished, so its checkpoint is evicted
+// after the TTL or when there are too many runs, the oldest first.
+type MemoryCheckpointer struct {
+	mx      sync.Mutex
+	m       map[string]Checkpoint
+	ttl     time.Duration
+	maxRuns int
+}
+
+type MemoryCheckpointerOption func(mc *MemoryCheckpointer)
+
+// evict checkpoint not saved for ttl, 0 or less keep it until evicted by WithMaxCheckpoints.
+func WithCheckpointTTL(ttl time.Duration) MemoryCheckpointerOption {
+	return func(mc *MemoryCheckpointer) {
+		mc.ttl = ttl
+	}
+}
+
+// keep at most n runs, 0 or less is unlimited.
+func WithMaxCheckpoints(n int) MemoryCheckpointerOption {
+	return func(mc *MemoryCheckpointer) {
+		mc.maxRuns = n
+	}
+}
+
+func NewMemoryCheckpointer(opts ...MemoryCheckpointerOption) *MemoryCheckpointer {
+	mc := &MemoryCheckpointer{
+		m:       map[string]Checkpoint{},
+		ttl:     DefaultCheckpointTTL,
+		maxRuns: DefaultMaxCheckpoints,
+	}
+	for _, fn := range opts {
+		fn(mc)
+	}
+	return mc
+}
+
+func (mc *MemoryCheckpointer) Save(ctx context.Context, cp *Checkpoint) error {
+	mc.mx.Lock()
+	defer mc.mx.Unlock()
+	c := *cp
+	c.State = cp.State.clone()
+	// eviction go by the time the checkpoint is kept, not the one set by caller.
+	c.Updated = time.Now()
+	mc.m[cp.RunID] = c
+	mc.evict(c.Updated)
+	return nil
+}
+
+func (mc *MemoryCheckpointer) Load(ctx context.Context, runID string) (*Checkpoint, error) {
+	mc.mx.Lock()
+	defer mc.mx.Unlock()
+	c, ok := mc.m[runID]
+	if !ok || mc.expired(c, time.Now()) {
+		return nil, ErrCheckpointNotFound
+	}
+	c.State = c.State.clone()
+	return &c, nil
+}
+
+func (mc *MemoryCheckpointer) Delete(ctx context.Context, runID string) error {
+	mc.mx.Lock()
+	defer mc.mx.Unlock()
+	delete(mc.m, runID)
+	return nil
+}
+
+func (mc *MemoryCheckpointer) expired(c Checkpoint, now time.Time) bool {
+	return mc.ttl > 0 && now.Sub(c.Updated) > mc.ttl
+}
+
+// remove expired checkpoints then the oldest ones over the limit, caller hold the lock.
+func (mc *MemoryCheckpointer) evict(now time.Time) {
+	for id, c := range mc.m {
+		if mc.expired(c, now) {
+			delete(mc.m, id)
+		}
+	}
+	for mc.maxRuns > 0 && len(mc.m) > mc.maxRuns {
+		oldest := ""
+		for id, c := range mc.m {
+			if oldest == "" || c.Updated.Before(mc.m[oldest].Updated) {
+				oldest = id
+			}
+		}
+		delete(mc.m, oldest)
+	}
+}
+
+var _ Checkpointer = (*FileCheckpointer)(nil)
+
+// run ID is use as file name, restrict it to safe character.
+var validRunID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// keep each checkpoint as json file in local directory.
+type FileCheckpointer struct {
+	dir string
+}
+
+func NewFileCheckpointer(dir string) (*FileCheckpointer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("file checkpointer directory cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("file checkpointer failed create directory: %w", err)
+	}
+	return &FileCheckpointer{dir: dir}, nil
+}
+
+func (fc *FileCheckpointer) path(runID string) (string, error) {
+	if !validRunID.MatchString(runID) {
+		return "", fmt.Errorf("invalid run id '%s'", runID)
+	}
+	return filepath.Join(fc.dir, runID+".json"), nil
+}
+
+func (fc *FileCheckpointer) Save(ctx context.Context, cp *Checkpoint) error {
+	p, err := fc.path(cp.RunID)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("file checkpointer failed marshal checkpoint: %w", err)
+	}
+
+	// write into temporary file first so reader never see partial checkpoint.
+	tmp, err := os.CreateTemp(fc.dir, cp.RunID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (fc *FileCheckpointer) Load(ctx context.Context, runID string) (*Checkpoint, error) {
+	p, err := fc.path(runID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCheckpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("file checkpointer failed unmarshal checkpoint: %w", err)
+	}
+	return &cp, nil
+}
+
+func (fc *FileCheckpointer) Delete(ctx context.Context, runID string) error {
+	p, err := fc.path(runID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// count how many times the tool is called.
+type countingTool struct {
+	calls atomic.Int32
+}
+
+func (ct *countingTool) Def() agent.Tool {
+	return agent.Tool{Type: "function", Function: agent.Function{Name: "send_message"}}
+}
+
+func (ct *countingTool) Call(ctx context.Context, fc agent.FunctionCall) (*agent.ToolResponse, error) {
+	ct.calls.Add(1)
+	return &agent.ToolResponse{Name: fc.Name, Output: map[string]any{"sent": true}}, nil
+}
+
+func (ct *countingTool) Ping(ctx context.Context) error {
+	return nil
+}
+
+func TestAgent_Resume(t *testing.T) {
+	fileCP, err := agent.NewFileCheckpointer(t.TempDir())
+	require.NoError(t, err)
+
+	checkpointers := map[string]agent.Checkpointer{
+		"memory": agent.NewMemoryCheckpointer(),
+		"file":   fileCP,
+	}
+
+	for name, cp := range checkpointers {
+		t.Run(name, func(t *testing.T) {
+			tool := &countingTool{}
+			failing := true
+			provider := &mockProvider{
+				ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+					if len(req.Messages) == 1 {
+						return &agent.CCRes{Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+							{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}},
+						}}}}, nil
+					}
+					if failing {
+						return nil, errors.New("provider unavailable")
+					}
+					return &agent.CCRes{Choices: []agent.Choice{{Text: "message sent"}}}, nil
+				},
+			}
+
+			a := agent.New(provider, agent.WithTool(tool), agent.WithCheckpointer(cp))
+			msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "send hello")}
+			_, err := a.Completion(t.Context(), msgs, agent.WithRunID("run-1"))
+			require.Error(t, err)
+			assert.Equal(t, int32(1), tool.calls.Load())
+
+			failing = false
+			msg, err := a.Resume(t.Context(), "run-1")
+			require.NoError(t, err)
+			assert.Equal(t, "message sent", msg.Text())
+			// the tool is not executed again
+			assert.Equal(t, int32(1), tool.calls.Load())
+
+			// finished run is removed
+			_, err = a.Resume(t.Context(), "run-1")
+			require.ErrorIs(t, err, agent.ErrCheckpointNotFound)
+		})
+	}
+}
+
+func TestFileCheckpointer_InvalidRunID(t *testing.T) {
+	cp, err := agent.NewFileCheckpointer(t.TempDir())
+	require.NoError(t, err)
+
+	err = cp.Save(t.Context(), &agent.Checkpoint{RunID: "../escape"})
+	require.Error(t, err)
+}
+
+func TestAgent_ResumeKeepOptions(t *testing.T) {
+	fileCP, err := agent.NewFileCheckpointer(t.TempDir())
+	require.NoError(t, err)
+
+	failing := true
+	var last agent.CCReq
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			last = req
+			if failing {
+				return nil, errors.New("provider unavailable")
+			}
+			return &agent.CCRes{Choices: []agent.Choice{{Text: "hello"}}}, nil
+		},
+	}
+	a := agent.New(provider, agent.WithTool(&countingTool{}), agent.WithCheckpointer(fileCP))
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}
+	_, err = a.Completion(t.Context(), msgs,
+		agent.WithRunID("run-1"),
+		agent.WithAllowedTools(),
+		agent.WithTemperature(0.2),
+		agent.WithThink(true),
+	)
+	require.Error(t, err)
+
+	// the resume options does not widen the run.
+	failing = false
+	_, err = a.Resume(t.Context(), "run-1", agent.WithAllowedTools("send_message"), agent.WithThink(false))
+	require.NoError(t, err)
+	assert.Empty(t, last.Tools)
+	require.NotNil(t, last.Temperature)
+	assert.Equal(t, float32(0.2), *last.Temperature)
+	assert.True(t, last.Think)
+}
+
+func TestMemoryCheckpointer_Evict(t *testing.T) {
+	ctx := t.Context()
+
+	cp := agent.NewMemoryCheckpointer(agent.WithMaxCheckpoints(2))
+	for _, id := range []string{"run-1", "run-2", "run-3"} {
+		require.NoError(t, cp.Save(ctx, &agent.Checkpoint{RunID: id}))
+		time.Sleep(time.Millisecond)
+	}
+	_, err := cp.Load(ctx, "run-1")
+	require.ErrorIs(t, err, agent.ErrCheckpointNotFound)
+	_, err = cp.Load(ctx, "run-3")
+	require.NoError(t, err)
+
+	cp = agent.NewMemoryCheckpointer(agent.WithCheckpointTTL(time.Millisecond))
+	require.NoError(t, cp.Save(ctx, &agent.Checkpoint{RunID: "run-1"}))
+	time.Sleep(5 * time.Millisecond)
+	_, err = cp.Load(ctx, "run-1")
+	require.ErrorIs(t, err, agent.ErrCheckpointNotFound)
+}
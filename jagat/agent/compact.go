@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// name of the node that compact the history before it is sent to the provider.
+const CompactNodeName = "compact"
+
+type CompactStrategy string
+
+const (
+	// drop the oldest turns until the history fit.
+	CompactDropOldest CompactStrategy = "drop_oldest"
+	// keep system messages and the last KeepLast messages.
+	CompactKeepLast CompactStrategy = "keep_last"
+	// replace older messages with summary generated by the provider, the last KeepLast messages are kept.
+	CompactSummarize CompactStrategy = "summarize"
+)
+
+// default number of latest messages kept by keep_last and summarize strategy.
+const defaultKeepLast = 10
+
+// limit the history sent to the provider.
+type ContextWindow struct {
+	// estimated token budget of the history, zero disables compaction.
+	MaxTokens int `yaml:"maxTokens"`
+	// applied when the history is over MaxTokens, default drop_oldest.
+	Strategy CompactStrategy `yaml:"strategy"`
+	// number of latest messages kept by keep_last and summarize strategy (default 10).
+	KeepLast int `yaml:"keepLast"`
+}
+
+func (cw ContextWindow) validate() error {
+	switch cw.Strategy {
+	case "", CompactDropOldest, CompactKeepLast, CompactSummarize:
+		return nil
+	default:
+		return fmt.Errorf("unknown compact strategy '%s'", cw.Strategy)
+	}
+}
+
+// rough token estimate of image, most provider bill an image as few hundred tokens.
+const imageTokens = 258
+
+// roughly estimate the token of message, about 4 characters per token.
+func EstimateTokens(msg *Message) int {
+	// role and message framing.
+	n := 4
+	for _, p := range msg.Parts {
+		switch {
+		case p.Text != "":
+			n += len(p.Text) / 4
+		case p.Blob != nil:
+			if strings.HasPrefix(p.Blob.Mime, "image/") {
+				n += imageTokens
+			} else {
+				n += len(p.Blob.Bytes) / 4
+			}
+		case p.Toolcall != nil:
+			n += (len(p.Toolcall.Function.Name) + len(p.Toolcall.Function.Arguments)) / 4
+		case p.ToolResponse != nil:
+			b, _ := json.Marshal(p.ToolResponse.Output)
+			n += (len(p.ToolResponse.Name) + len(b)) / 4
+		}
+	}
+	return n
+}
+
+func estimateHistory(msgs []*Message) int {
+	n := 0
+	for _, msg := range msgs {
+		n += EstimateTokens(msg)
+	}
+	return n
+}
+
+// compact the history when it is over the context window.
+type CompactNode struct {
+	window   ContextWindow
+	provider Provider
+}
+
+// provider is only used by summarize strategy.
+func NewCompactNode(window ContextWindow, provider Provider) *CompactNode {
+	if window.Strategy == "" {
+		window.Strategy = CompactDropOldest
+	}
+	if window.KeepLast <= 0 {
+		window.KeepLast = defaultKeepLast
+	}
+	return &CompactNode{window: window, provider: provider}
+}
+
+func (cn *CompactNode) Name() string {
+	return CompactNodeName
+}
+
+func (cn *CompactNode) Execute(ctx context.Context, state State) (State, error) {
+	ctx, span := tracer.Start(ctx, "CompactNode.Execute")
+	defer span.End()
+
+	if cn.window.MaxTokens <= 0 || estimateHistory(state.Message) <= cn.window.MaxTokens {
+		return state, nil
+	}
+
+	// system messages are always kept, the rest is cut only at turn boundary.
+	system, history := splitSystem(state.Message)
+	budget := cn.window.MaxTokens - estimateHistory(system)
+
+	var kept []*Message
+	var summary *Message
+	switch cn.window.Strategy {
+	case CompactDropOldest:
+		kept = dropOldest(history, budget)
+
+	case CompactKeepLast:
+		kept = history[keepLastCut(history, cn.window.KeepLast):]
+
+	case CompactSummarize:
+		cut := keepLastCut(history, cn.window.KeepLast)
+		kept = history[cut:]
+		if cut > 0 {
+			text, usage, err := cn.summarize(ctx, history[:cut])
+			if err != nil {
+				return state, err
+			}
+			state.Usage = state.Usage.Add(usage)
+			summary = NewTextMessage(RoleSystem, "Summary of the earlier conversation:\n"+text)
+		}
+
+	default:
+		return state, fmt.Errorf("unknown compact strategy '%s'", cn.window.Strategy)
+	}
+
+	// messages after Input is produced by the run, keep the index pointing to the same message.
+	dropped := len(history) - len(kept)
+	inputHistory := state.Input - len(system)
+	newInput := len(system) + max(inputHistory-dropped, 0)
+	compacted := append(slices.Clone(system), kept...)
+	if summary != nil {
+		compacted = slices.Insert(compacted, len(system), summary)
+		newInput++
+	}
+
+	state.Message = compacted
+	state.Input = min(newInput, len(compacted))
+	return state, nil
+}
+
+// separate leading system messages from the rest of history.
+func splitSystem(msgs []*Message) ([]*Message, []*Message) {
+	i := 0
+	for i < len(msgs) && msgs[i].Role == RoleSystem {
+		i++
+	}
+	return msgs[:i], msgs[i:]
+}
+
+// history can be cut before i without orphaning tool response or leaving leading tool call turn.
+// the cut is placed before user message, so the kept history start with user turn.
+func isTurnStart(msgs []*Message, i int) bool {
+	return msgs[i].Role == RoleUser
+}
+
+// drop the oldest turns until the history fit the budget, the last turn is always kept.
+func dropOldest(history []*Message, budget int) []*Message {
+	total := estimateHistory(history)
+	cut := 0
+	for i := 1; i < len(history) && total > budget; i++ {
+		if !isTurnStart(history, i) {
+			continue
+		}
+		total -= estimateHistory(history[cut:i])
+		cut = i
+	}
+	return history[cut:]
+}
+
+// index of the first kept message, about n latest messages are kept.
+// the cut moves forward to the next turn start, so tool call and its response stay together,
+// or back to the start of the last turn if there is none.
+func keepLastCut(history []*Message, n int) int {
+	start := max(len(history)-n, 0)
+	for cut := start; cut < len(history); cut++ {
+		if isTurnStart(history, cut) {
+			return cut
+		}
+	}
+	for cut := start; cut > 0; cut-- {
+		if isTurnStart(history, cut) {
+			return cut
+		}
+	}
+	return 0
+}
+
+// ask the provider to summarize the messages as plain transcript.
+func (cn *CompactNode) summarize(ctx context.Context, msgs []*Message) (string, Usage, error) {
+	var sb strings.Builder
+	for _, msg := range msgs {
+		for _, p := range msg.Parts {
+			switch {
+			case p.Text != "":
+				fmt.Fprintf(&sb, "%s: %s\n", msg.Role, p.Text)
+			case p.Blob != nil:
+				fmt.Fprintf(&sb, "%s: [%s attachment]\n", msg.Role, p.Blob.Mime)
+			case p.Toolcall != nil:
+				fmt.Fprintf(&sb, "%s: call tool %s(%s)\n", msg.Role, p.Toolcall.Function.Name, p.Toolcall.Function.Arguments)
+			case p.ToolResponse != nil:
+				b, _ := json.Marshal(p.ToolResponse.Output)
+				fmt.Fprintf(&sb, "%s: tool %s returned %s\n", msg.Role, p.ToolResponse.Name, b)
+			}
+		}
+	}
+
+	resp, err := cn.provider.Chat(ctx, CCReq{
+		Messages: []*Message{
+			NewTextMessage(RoleSystem, "Summarize the conversation below in a few sentences. Keep facts, decisions and open questions needed to continue it."),
+			NewTextMessage(RoleUser, sb.String()),
+		},
+	})
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("compact failed summarize history: %w", err)
+	}
+	return resp.Choices[0].Text, resp.Usage, nil
+}
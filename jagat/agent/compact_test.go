@@ -0,0 +1,125 @@
+package agent_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func toolCallMessage(id string) *agent.Message {
+	return &agent.Message{Role: agent.RoleAssistant, Parts: []*agent.Part{{Toolcall: &agent.ToolCall{
+		ID: id, Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`},
+	}}}}
+}
+
+func toolResponseMessage(id string) *agent.Message {
+	return &agent.Message{Role: agent.RoleTool, Parts: []*agent.Part{{ToolResponse: &agent.ToolResponse{
+		ID: id, Name: "send_message", Output: map[string]any{"sent": true},
+	}}}}
+}
+
+// long chat history, each text is about 100 tokens.
+func longHistory() []*agent.Message {
+	text := strings.Repeat("word ", 80)
+	return []*agent.Message{
+		agent.NewTextMessage(agent.RoleSystem, "concise"),
+		agent.NewTextMessage(agent.RoleUser, "u1 "+text),
+		toolCallMessage("call_1"),
+		toolResponseMessage("call_1"),
+		agent.NewTextMessage(agent.RoleAssistant, "a1 "+text),
+		agent.NewTextMessage(agent.RoleUser, "u2 "+text),
+		agent.NewTextMessage(agent.RoleAssistant, "a2 "+text),
+		agent.NewTextMessage(agent.RoleUser, "u3"),
+	}
+}
+
+func TestAgent_ContextWindow(t *testing.T) {
+	testCases := []struct {
+		name     string
+		window   agent.ContextWindow
+		expected []string
+	}{
+		{
+			name:     "under budget",
+			window:   agent.ContextWindow{MaxTokens: 10000},
+			expected: []string{"concise", "u1", "call_1", "call_1", "a1", "u2", "a2", "u3"},
+		},
+		{
+			name:     "drop oldest turn with its tool calls",
+			window:   agent.ContextWindow{MaxTokens: 300, Strategy: agent.CompactDropOldest},
+			expected: []string{"concise", "u2", "a2", "u3"},
+		},
+		{
+			name:     "drop all but last turn",
+			window:   agent.ContextWindow{MaxTokens: 50},
+			expected: []string{"concise", "u3"},
+		},
+		{
+			// last 5 messages start with tool response, the cut moves to next user turn
+			name:     "keep last without orphan",
+			window:   agent.ContextWindow{MaxTokens: 300, Strategy: agent.CompactKeepLast, KeepLast: 5},
+			expected: []string{"concise", "u2", "a2", "u3"},
+		},
+		{
+			name:     "summarize older turns",
+			window:   agent.ContextWindow{MaxTokens: 300, Strategy: agent.CompactSummarize, KeepLast: 3},
+			expected: []string{"concise", "Summary of the earlier conversation:\nuser asked twice", "u2", "a2", "u3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent []*agent.Message
+			var summarized string
+			provider := &mockProvider{
+				ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+					if strings.HasPrefix(req.Messages[0].Text(), "Summarize") {
+						summarized = req.Messages[1].Text()
+						return &agent.CCRes{Choices: []agent.Choice{{Text: "user asked twice"}}}, nil
+					}
+					sent = req.Messages
+					return &agent.CCRes{Choices: []agent.Choice{{Text: "done"}}}, nil
+				},
+			}
+			a := agent.New(provider, agent.WithTool(&countingTool{}), agent.WithContextWindow(tc.window))
+
+			res, err := a.Completion(t.Context(), longHistory())
+			require.NoError(t, err)
+
+			got := []string{}
+			for _, msg := range sent {
+				if tcs := msg.ToolCalls(); len(tcs) > 0 {
+					got = append(got, tcs[0].ID)
+				} else if msg.Role == agent.RoleTool {
+					got = append(got, msg.Parts[0].ToolResponse.ID)
+				} else {
+					got = append(got, strings.SplitN(msg.Text(), " ", 2)[0])
+				}
+			}
+			if tc.window.Strategy == agent.CompactSummarize {
+				got[1] = sent[1].Text()
+				assert.Contains(t, summarized, "call tool send_message({})")
+			}
+			assert.Equal(t, tc.expected, got)
+
+			// only the answer is produced by the run
+			require.Len(t, res.Messages, 1)
+			assert.Equal(t, "done", res.Text())
+		})
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	text := agent.NewTextMessage(agent.RoleUser, strings.Repeat("a", 400))
+	assert.Equal(t, 104, agent.EstimateTokens(text))
+
+	image := &agent.Message{Role: agent.RoleUser, Parts: []*agent.Part{{Blob: &agent.Blob{Bytes: make([]byte, 1<<20), Mime: "image/png"}}}}
+	assert.Equal(t, 262, agent.EstimateTokens(image))
+
+	pdf := &agent.Message{Role: agent.RoleUser, Parts: []*agent.Part{{Blob: &agent.Blob{Bytes: make([]byte, 4000), Mime: "application/pdf"}}}}
+	assert.Equal(t, 1004, agent.EstimateTokens(pdf))
+}
@@ -0,0 +1,565 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+)
+
+// Anthropic Messages API.
+
+const (
+	_anthropic_base_url      = "https://api.anthropic.com"
+	_anthropic_messages_path = "v1/messages"
+	_anthropic_version       = "2023-06-01"
+
+	_anthropic_default_max_tokens = 4096
+	// minimum thinking budget accepted by the API.
+	_anthropic_min_thinking_budget = 1024
+)
+
+var _ agent.StreamingProvider = (*AnthropicAdapter)(nil)
+
+func init() {
+	Register("anthropic", newAnthropicDriver)
+}
+
+// anthropic settings of ProviderConfig.Extra.
+type AnthropicExtra struct {
+	// maximum tokens of the answer, thinking budget is added on top of it, default 4096.
+	MaxTokens int `json:"maxTokens"`
+	// retries of request that failed with 429, 5xx or network error, default 2.
+	MaxRetries *int `json:"maxRetries"`
+}
+
+func newAnthropicDriver(cfg ProviderConfig) (agent.Provider, error) {
+	var extra AnthropicExtra
+	if err := cfg.Decode(&extra); err != nil {
+		return nil, err
+	}
+	conf := cfg.Options
+	conf.Endpoint = cfg.endpoint()
+	aa, err := NewAnthropicAdapter(cfg.Model, cfg.ApiKey, &conf)
+	if err != nil {
+		return nil, err
+	}
+	if extra.MaxTokens > 0 {
+		aa.maxTokens = extra.MaxTokens
+	}
+	if extra.MaxRetries != nil {
+		aa.maxRetry = *extra.MaxRetries
+	}
+	return aa, nil
+}
+
+type AnthropicAdapter struct {
+	retryClient
+	model     string
+	apiKey    string
+	baseUrl   string
+	maxTokens int
+
+	conf *Config
+}
+
+// config.Endpoint is the base URL without version path, e.g "https://api.anthropic.com".
+func NewAnthropicAdapter(model, key string, config *Config) (*AnthropicAdapter, error) {
+	if model == "" {
+		return nil, fmt.Errorf("anthropic_adapter model cannot be empty")
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = _anthropic_base_url
+	}
+	baseUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic_adapter failed parse base url: %w", err)
+	}
+	if baseUrl.Scheme == "" || baseUrl.Host == "" {
+		return nil, fmt.Errorf("anthropic_adapter base url need scheme and host: %s", endpoint)
+	}
+
+	return &AnthropicAdapter{
+		retryClient: newRetryClient("anthropic_adapter"),
+		model:       model,
+		apiKey:      key,
+		baseUrl:     strings.TrimSuffix(baseUrl.String(), "/"),
+		maxTokens:   _anthropic_default_max_tokens,
+		conf:        config,
+	}, nil
+}
+
+// Chat implements agent.Provider.
+func (aa *AnthropicAdapter) Chat(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+	input, err := aa.request(req, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := aa.do(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("anthropic_adapter failed decode response: %w", err)
+	}
+
+	choice := agent.Choice{FinishReason: out.StopReason, ToolCalls: []*agent.ToolCall{}}
+	texts, thoughts := []string{}, []string{}
+	for _, block := range out.Content {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "thinking":
+			thoughts = append(thoughts, block.Thinking)
+		case "tool_use":
+			choice.ToolCalls = append(choice.ToolCalls, block.toolCall())
+		}
+	}
+	choice.Text = strings.Join(texts, "")
+	choice.Thought = strings.Join(thoughts, "\n\n")
+
+	return &agent.CCRes{
+		ID:      out.ID,
+		Model:   out.Model,
+		Object:  out.Type,
+		Choices: []agent.Choice{choice},
+		Usage:   out.Usage.usage(),
+	}, nil
+}
+
+// ChatStream implements agent.StreamingProvider.
+// tool input is streamed as partial JSON, the call is yielded once its block stopped.
+func (aa *AnthropicAdapter) ChatStream(ctx context.Context, req agent.CCReq) iter.Seq2[agent.Chunk, error] {
+	return func(yield func(agent.Chunk, error) bool) {
+		input, err := aa.request(req, true)
+		if err != nil {
+			yield(agent.Chunk{}, err)
+			return
+		}
+		resp, err := aa.do(ctx, input)
+		if err != nil {
+			yield(agent.Chunk{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		var id, model string
+		var usage anthropicUsage
+		// content blocks by index, only tool_use is kept until it stopped.
+		blocks := map[int]*anthropicBlock{}
+		for data, err := range sseData(resp.Body) {
+			if err != nil {
+				yield(agent.Chunk{}, fmt.Errorf("anthropic_adapter failed read stream: %w", err))
+				return
+			}
+
+			var ev anthropicEvent
+			if err := json.Unmarshal(data, &ev); err != nil {
+				yield(agent.Chunk{}, fmt.Errorf("anthropic_adapter failed decode stream: %w", err))
+				return
+			}
+			chunk := agent.Chunk{ID: id, Model: model}
+			switch ev.Type {
+			case "message_start":
+				id, model = ev.Message.ID, ev.Message.Model
+				usage = ev.Message.Usage
+				continue
+
+			case "content_block_start":
+				if ev.ContentBlock.Type == "tool_use" {
+					block := ev.ContentBlock
+					blocks[ev.Index] = &block
+				}
+				continue
+
+			case "content_block_delta":
+				switch ev.Delta.Type {
+				case "text_delta":
+					chunk.Text = ev.Delta.Text
+				case "thinking_delta":
+					chunk.Thought = ev.Delta.Thinking
+				case "input_json_delta":
+					if block, ok := blocks[ev.Index]; ok {
+						block.partialInput += ev.Delta.PartialJSON
+					}
+					continue
+				default:
+					continue
+				}
+
+			case "content_block_stop":
+				block, ok := blocks[ev.Index]
+				if !ok {
+					continue
+				}
+				delete(blocks, ev.Index)
+				if block.partialInput != "" {
+					block.Input = json.RawMessage(block.partialInput)
+				}
+				chunk.ToolCalls = []*agent.ToolCall{block.toolCall()}
+
+			case "message_delta":
+				// output tokens is cumulative, input tokens is only reported in message_start.
+				usage.OutputTokens = ev.Usage.OutputTokens
+				u := usage.usage()
+				chunk.Usage = &u
+				chunk.FinishReason = ev.Delta.StopReason
+
+			case "error":
+				yield(agent.Chunk{}, fmt.Errorf("anthropic_adapter stream error: %s: %s", ev.Error.Type, ev.Error.Message))
+				return
+
+			default:
+				// ping and message_stop.
+				continue
+			}
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}
+}
+
+// send the request, it is retried with exponential backoff on 429, 5xx and network error.
+func (aa *AnthropicAdapter) do(ctx context.Context, input *anthropicRequest) (*http.Response, error) {
+	b, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic_adapter failed encode request: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/%s", aa.baseUrl, _anthropic_messages_path)
+
+	return aa.retryClient.do(ctx, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("x-api-key", aa.apiKey)
+		request.Header.Set("anthropic-version", _anthropic_version)
+		return request, nil
+	})
+}
+
+func (aa *AnthropicAdapter) request(req agent.CCReq, stream bool) (*anthropicRequest, error) {
+	system := []string{}
+	msgs := []anthropicMessage{}
+	for _, msg := range req.Messages {
+		if msg.Role == agent.RoleSystem {
+			system = append(system, msg.Text())
+			continue
+		}
+		am, err := anthropicMessageOf(msg)
+		if err != nil {
+			return nil, fmt.Errorf("anthropic_adapter failed convert message: %w", err)
+		}
+		if len(am.Content) == 0 {
+			continue
+		}
+		// consecutive messages of the same role, e.g tool results then user text, are merged.
+		if n := len(msgs); n > 0 && msgs[n-1].Role == am.Role {
+			msgs[n-1].Content = append(msgs[n-1].Content, am.Content...)
+			continue
+		}
+		msgs = append(msgs, am)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("anthropic_adapter messages is empty")
+	}
+
+	input := &anthropicRequest{
+		Model:     aa.model,
+		MaxTokens: aa.maxTokens,
+		Messages:  msgs,
+		Stream:    stream,
+	}
+
+	// the API has no JSON schema mode, the schema is given as instruction and the agent validate the answer.
+	if req.ResponseSchema != nil && len(req.Tools) == 0 {
+		b, _ := json.Marshal(req.ResponseSchema)
+		system = append(system, fmt.Sprintf("Answer only with a JSON value matching this JSON schema, without code fence: %s", b))
+	}
+	input.System = strings.Join(system, "\n\n")
+
+	// tools are sent even with none choice, history with tool blocks require the definitions.
+	if len(req.Tools) > 0 {
+		for _, t := range req.Tools {
+			input.Tools = append(input.Tools, anthropicTool{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				InputSchema: objectSchema(t.Function.Parameters),
+			})
+		}
+		input.ToolChoice = anthropicToolChoice(req.ToolChoice)
+	}
+
+	input.Thinking = anthropicThinking(req, aa.conf.Thinking, msgs)
+	if input.Thinking != nil {
+		// thinking does not go along with sampling options and it count toward max tokens.
+		input.MaxTokens += input.Thinking.BudgetTokens
+		return input, nil
+	}
+	temperature := aa.conf.Temperature
+	if req.Temperature != nil {
+		temperature = req.Temperature
+	}
+	input.Temperature = temperature
+	input.TopP = aa.conf.TopP
+	if aa.conf.TopK != nil {
+		k := int(*aa.conf.TopK)
+		input.TopK = &k
+	}
+	return input, nil
+}
+
+// thinking of the request, nil if disabled.
+// thought part does not keep the block signature, so thinking is left out while the model continue from tool results.
+// forced tool choice does not go along with thinking either.
+func anthropicThinking(req agent.CCReq, conf ThinkingConfig, msgs []anthropicMessage) *anthropicThinkingConfig {
+	if !req.Think && !conf.Enable {
+		return nil
+	}
+	switch req.ToolChoice {
+	case "", agent.ToolChoiceAuto, agent.ToolChoiceNone:
+	default:
+		if len(req.Tools) > 0 {
+			return nil
+		}
+	}
+	last := msgs[len(msgs)-1]
+	for _, block := range last.Content {
+		if block.Type == "tool_result" {
+			return nil
+		}
+	}
+	budget := _anthropic_min_thinking_budget
+	if b := conf.budget(); b != nil {
+		if *b == 0 {
+			return nil
+		}
+		budget = max(budget, int(*b))
+	}
+	return &anthropicThinkingConfig{Type: "enabled", BudgetTokens: budget}
+}
+
+func anthropicToolChoice(choice string) *anthropicToolChoiceConfig {
+	switch choice {
+	case "", agent.ToolChoiceAuto:
+		return &anthropicToolChoiceConfig{Type: "auto"}
+	case agent.ToolChoiceNone:
+		return &anthropicToolChoiceConfig{Type: "none"}
+	case agent.ToolChoiceRequired:
+		return &anthropicToolChoiceConfig{Type: "any"}
+	default:
+		return &anthropicToolChoiceConfig{Type: "tool", Name: choice}
+	}
+}
+
+// convert the message into content blocks, tool message become user message with tool_result blocks.
+// thought part is left out because it has no signature.
+func anthropicMessageOf(msg *agent.Message) (anthropicMessage, error) {
+	am := anthropicMessage{}
+	switch msg.Role {
+	case agent.RoleUser, agent.RoleTool:
+		am.Role = "user"
+	case agent.RoleAssistant:
+		am.Role = "assistant"
+	default:
+		return am, fmt.Errorf("unknown message role: %v", msg.Role)
+	}
+
+	for _, p := range msg.Parts {
+		switch {
+		case p.Text != "":
+			am.Content = append(am.Content, anthropicBlock{Type: "text", Text: p.Text})
+
+		case p.Blob != nil:
+			block, err := anthropicBlob(p.Blob)
+			if err != nil {
+				return am, err
+			}
+			am.Content = append(am.Content, block)
+
+		case p.Toolcall != nil:
+			input := json.RawMessage(p.Toolcall.Function.Arguments)
+			// invalid arguments was already refused by the agent, the API only accept JSON object.
+			if !json.Valid(input) {
+				input = json.RawMessage("{}")
+			}
+			am.Content = append(am.Content, anthropicBlock{
+				Type:  "tool_use",
+				ID:    p.Toolcall.ID,
+				Name:  p.Toolcall.Function.Name,
+				Input: input,
+			})
+
+		case p.ToolResponse != nil:
+			b, err := json.Marshal(p.ToolResponse.Output)
+			if err != nil {
+				return am, fmt.Errorf("tool response '%s': %w", p.ToolResponse.Name, err)
+			}
+			am.Content = append(am.Content, anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: p.ToolResponse.ID,
+				Content:   string(b),
+			})
+		}
+	}
+	return am, nil
+}
+
+// image become image block, pdf and plain text become document block.
+func anthropicBlob(blob *agent.Blob) (anthropicBlock, error) {
+	source := &anthropicSource{Type: "base64", MediaType: blob.Mime, Data: base64.StdEncoding.EncodeToString(blob.Bytes)}
+	switch {
+	case strings.HasPrefix(blob.Mime, "image/"):
+		return anthropicBlock{Type: "image", Source: source}, nil
+	case blob.Mime == "application/pdf":
+		return anthropicBlock{Type: "document", Source: source}, nil
+	case blob.Mime == "text/plain":
+		source.Type, source.Data = "text", string(blob.Bytes)
+		return anthropicBlock{Type: "document", Source: source}, nil
+	default:
+		return anthropicBlock{}, fmt.Errorf("unsupported blob mime '%s', only image, pdf and plain text are supported", blob.Mime)
+	}
+}
+
+//------------
+
+type anthropicRequest struct {
+	Model       string                     `json:"model"`
+	MaxTokens   int                        `json:"max_tokens"`
+	System      string                     `json:"system,omitempty"`
+	Messages    []anthropicMessage         `json:"messages"`
+	Tools       []anthropicTool            `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoiceConfig `json:"tool_choice,omitempty"`
+	Thinking    *anthropicThinkingConfig   `json:"thinking,omitempty"`
+	Temperature *float32                   `json:"temperature,omitempty"`
+	TopP        *float32                   `json:"top_p,omitempty"`
+	TopK        *int                       `json:"top_k,omitempty"`
+	Stream      bool                       `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	InputSchema agent.ParameterSchema `json:"input_schema"`
+}
+
+type anthropicToolChoiceConfig struct {
+	// "auto", "none", "any" or "tool".
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicThinkingConfig struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// content block, the fields are set by its type.
+type anthropicBlock struct {
+	Type string `json:"type"`
+	// text
+	Text string `json:"text,omitempty"`
+	// thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// image and document
+	Source *anthropicSource `json:"source,omitempty"`
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+
+	// input_json_delta of streamed tool_use.
+	partialInput string
+}
+
+func (b anthropicBlock) toolCall() *agent.ToolCall {
+	args := string(b.Input)
+	if args == "" {
+		args = "{}"
+	}
+	return &agent.ToolCall{
+		ID:   b.ID,
+		Type: "function",
+		Function: agent.FunctionCall{
+			Name:      b.Name,
+			Arguments: args,
+		},
+	}
+}
+
+type anthropicSource struct {
+	// "base64" or "text".
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Type       string           `json:"type"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicUsage struct {
+	// does not include the cached tokens.
+	InputTokens              int32 `json:"input_tokens"`
+	OutputTokens             int32 `json:"output_tokens"`
+	CacheCreationInputTokens int32 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int32 `json:"cache_read_input_tokens"`
+}
+
+// thinking tokens are not reported separately, output tokens include them.
+func (u anthropicUsage) usage() agent.Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return agent.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+	}
+}
+
+// server-sent event of streamed message, the fields are set by its type.
+type anthropicEvent struct {
+	Type         string            `json:"type"`
+	Message      anthropicResponse `json:"message"`
+	Index        int               `json:"index"`
+	ContentBlock anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
@@ -0,0 +1,255 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fake Anthropic server, handler is called for every request to the messages path.
+func anthropicServer(t *testing.T, handler http.HandlerFunc) *AnthropicAdapter {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, _anthropic_version, r.Header.Get("anthropic-version"))
+		handler(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	aa, err := NewAnthropicAdapter("claude-test", "test-key", &Config{Endpoint: ts.URL})
+	require.NoError(t, err)
+	aa.retryWait = time.Millisecond
+	return aa
+}
+
+func Test_anthropicChat(t *testing.T) {
+	var body map[string]any
+	aa := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		fmt.Fprint(w, `{
+			"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-test",
+			"content": [
+				{"type": "thinking", "thinking": "need weather", "signature": "sig"},
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_2", "name": "weather", "input": {"city": "Paris"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "output_tokens": 8, "cache_creation_input_tokens": 2, "cache_read_input_tokens": 5}
+		}`)
+	})
+
+	req := agent.CCReq{
+		Messages: []*agent.Message{
+			agent.NewTextMessage(agent.RoleSystem, "be brief"),
+			{Role: agent.RoleUser, Parts: []*agent.Part{
+				{Text: "read these"},
+				{Blob: &agent.Blob{Bytes: []byte("hello"), Mime: "image/png"}},
+				{Blob: &agent.Blob{Bytes: []byte("%PDF"), Mime: "application/pdf"}},
+				{Blob: &agent.Blob{Bytes: []byte("notes"), Mime: "text/plain"}},
+			}},
+			{Role: agent.RoleAssistant, Parts: []*agent.Part{{Thought: "look it up"}, {Toolcall: &agent.ToolCall{ID: "toolu_1", Type: "function", Function: agent.FunctionCall{Name: "lookup", Arguments: `{"q":"cat"}`}}}}},
+			{Role: agent.RoleTool, Parts: []*agent.Part{{ToolResponse: &agent.ToolResponse{ID: "toolu_1", Name: "lookup", Output: map[string]any{"found": "cat"}}}}},
+			agent.NewTextMessage(agent.RoleUser, "and the weather?"),
+		},
+		Tools: []agent.Tool{
+			{Type: "function", Function: agent.Function{Name: "weather", Description: "get weather", Parameters: agent.ParameterSchema{Type: "object"}}},
+			// tool without arguments may leave the schema empty.
+			{Type: "function", Function: agent.Function{Name: "now", Description: "current time"}},
+		},
+		ToolChoice: agent.ToolChoiceRequired,
+	}
+	res, err := aa.Chat(t.Context(), req)
+	require.NoError(t, err)
+
+	expectedBody := `{
+		"model": "claude-test",
+		"max_tokens": 4096,
+		"system": "be brief",
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "read these"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "aGVsbG8="}},
+				{"type": "document", "source": {"type": "base64", "media_type": "application/pdf", "data": "JVBERg=="}},
+				{"type": "document", "source": {"type": "text", "media_type": "text/plain", "data": "notes"}}
+			]},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": {"q": "cat"}}]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "{\"found\":\"cat\"}"},
+				{"type": "text", "text": "and the weather?"}
+			]}
+		],
+		"tools": [
+			{"name": "weather", "description": "get weather", "input_schema": {"type": "object", "properties": {}}},
+			{"name": "now", "description": "current time", "input_schema": {"type": "object", "properties": {}}}
+		],
+		"tool_choice": {"type": "any"}
+	}`
+	b, _ := json.Marshal(body)
+	assert.JSONEq(t, expectedBody, string(b))
+
+	assert.Equal(t, "msg_1", res.ID)
+	require.Len(t, res.Choices, 1)
+	choice := res.Choices[0]
+	assert.Equal(t, "Checking.", choice.Text)
+	assert.Equal(t, "need weather", choice.Thought)
+	assert.Equal(t, "tool_use", choice.FinishReason)
+	assert.Equal(t, []*agent.ToolCall{{ID: "toolu_2", Type: "function", Function: agent.FunctionCall{Name: "weather", Arguments: `{"city": "Paris"}`}}}, choice.ToolCalls)
+	assert.Equal(t, agent.Usage{PromptTokens: 17, CompletionTokens: 8, TotalTokens: 25, CachedTokens: 5}, res.Usage)
+}
+
+func Test_anthropicChatStream(t *testing.T) {
+	aa := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, true, body["stream"])
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range []string{
+			`{"type":"message_start","message":{"id":"msg_1","model":"claude-test","content":[],"usage":{"input_tokens":12,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"user wants "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"weather"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Let me "}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"check."}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}`,
+			`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":""}}`,
+			`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+			`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+			`{"type":"content_block_stop","index":2}`,
+			`{"type":"content_block_start","index":3,"content_block":{"type":"tool_use","id":"toolu_2","name":"clock","input":{}}}`,
+			`{"type":"content_block_stop","index":3}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":30}}`,
+			`{"type":"message_stop"}`,
+		} {
+			var typ struct{ Type string }
+			require.NoError(t, json.Unmarshal([]byte(ev), &typ))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, ev)
+		}
+	})
+
+	req := agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "weather in paris?")}, Think: true}
+	var text, thought, finish string
+	var calls []*agent.ToolCall
+	var usage *agent.Usage
+	for chunk, err := range aa.ChatStream(t.Context(), req) {
+		require.NoError(t, err)
+		assert.Equal(t, "msg_1", chunk.ID)
+		text += chunk.Text
+		thought += chunk.Thought
+		calls = append(calls, chunk.ToolCalls...)
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	assert.Equal(t, "Let me check.", text)
+	assert.Equal(t, "user wants weather", thought)
+	assert.Equal(t, "tool_use", finish)
+	assert.Equal(t, []*agent.ToolCall{
+		{ID: "toolu_1", Type: "function", Function: agent.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}},
+		{ID: "toolu_2", Type: "function", Function: agent.FunctionCall{Name: "clock", Arguments: `{}`}},
+	}, calls)
+	require.NotNil(t, usage)
+	assert.Equal(t, agent.Usage{PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42}, *usage)
+}
+
+func Test_anthropicStreamError(t *testing.T) {
+	aa := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\"}}\n\n")
+		fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	})
+
+	var err error
+	for _, err = range aa.ChatStream(t.Context(), agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}}) {
+	}
+	assert.EqualError(t, err, "anthropic_adapter stream error: overloaded_error: Overloaded")
+}
+
+func Test_anthropicRequest(t *testing.T) {
+	temperature := float32(0.2)
+	budget := int32(0)
+	user := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}
+	afterTool := []*agent.Message{
+		agent.NewTextMessage(agent.RoleUser, "hi"),
+		{Role: agent.RoleAssistant, Parts: []*agent.Part{{Toolcall: &agent.ToolCall{ID: "toolu_1", Function: agent.FunctionCall{Name: "clock", Arguments: `{}`}}}}},
+		{Role: agent.RoleTool, Parts: []*agent.Part{{ToolResponse: &agent.ToolResponse{ID: "toolu_1", Name: "clock", Output: map[string]any{}}}}},
+	}
+	tools := []agent.Tool{{Type: "function", Function: agent.Function{Name: "clock", Parameters: agent.ParameterSchema{Type: "object"}}}}
+
+	testCases := []struct {
+		name      string
+		conf      Config
+		req       agent.CCReq
+		maxTokens int
+		thinking  *anthropicThinkingConfig
+		sampling  bool
+	}{
+		{name: "no thinking", req: agent.CCReq{Messages: user, Temperature: &temperature}, maxTokens: 4096, sampling: true},
+		{
+			name:      "think",
+			req:       agent.CCReq{Messages: user, Think: true, Temperature: &temperature},
+			maxTokens: 4096 + 1024,
+			thinking:  &anthropicThinkingConfig{Type: "enabled", BudgetTokens: 1024},
+		},
+		{
+			name:      "level",
+			conf:      Config{Thinking: ThinkingConfig{Enable: true, Level: ThinkingHigh}},
+			req:       agent.CCReq{Messages: user},
+			maxTokens: 4096 + 24576,
+			thinking:  &anthropicThinkingConfig{Type: "enabled", BudgetTokens: 24576},
+		},
+		{name: "zero budget", conf: Config{Thinking: ThinkingConfig{Enable: true, Budget: &budget}}, req: agent.CCReq{Messages: user}, maxTokens: 4096, sampling: true},
+		{name: "after tool result", req: agent.CCReq{Messages: afterTool, Tools: tools, Think: true}, maxTokens: 4096, sampling: true},
+		{name: "forced tool", req: agent.CCReq{Messages: user, Tools: tools, ToolChoice: "clock", Think: true}, maxTokens: 4096, sampling: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.conf.Temperature = &temperature
+			aa, err := NewAnthropicAdapter("claude-test", "", &tc.conf)
+			require.NoError(t, err)
+			input, err := aa.request(tc.req, false)
+			require.NoError(t, err)
+			assert.Equal(t, tc.maxTokens, input.MaxTokens)
+			assert.Equal(t, tc.thinking, input.Thinking)
+			assert.Equal(t, tc.sampling, input.Temperature != nil)
+		})
+	}
+
+	aa, err := NewAnthropicAdapter("claude-test", "", &Config{})
+	require.NoError(t, err)
+	_, err = aa.request(agent.CCReq{Messages: []*agent.Message{
+		{Role: agent.RoleUser, Parts: []*agent.Part{{Blob: &agent.Blob{Bytes: []byte("a,b"), Mime: "text/csv"}}}},
+	}}, false)
+	assert.ErrorContains(t, err, "unsupported blob mime 'text/csv'")
+
+	schema := agent.ParameterDefinition{Type: "object"}
+	input, err := aa.request(agent.CCReq{Messages: append([]*agent.Message{agent.NewTextMessage(agent.RoleSystem, "be brief")}, user...), ResponseSchema: &schema}, false)
+	require.NoError(t, err)
+	assert.Equal(t, `be brief
+
+Answer only with a JSON value matching this JSON schema, without code fence: {"type":"object"}`, input.System)
+}
+
+func Test_anthropicDriver(t *testing.T) {
+	p, err := New(ProviderConfig{Name: "anthropic", Model: "claude-test", ApiKey: "key", Extra: map[string]any{"maxtokens": 1000, "maxretries": 1}})
+	require.NoError(t, err)
+	aa, ok := p.(*AnthropicAdapter)
+	require.True(t, ok)
+	assert.Equal(t, 1000, aa.maxTokens)
+	assert.Equal(t, 1, aa.maxRetry)
+	assert.Equal(t, _anthropic_base_url, aa.baseUrl)
+}
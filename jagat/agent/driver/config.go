@@ -8,4 +8,41 @@ type Config struct {
 	TopP        *float32
 	Temperature *float32
 	MinP        *float32
+	// Optional. model thinking, request can still enable it with CCReq.Think.
+	Thinking ThinkingConfig
+}
+
+// thinking level, mapped into thinking budget of the provider.
+const (
+	ThinkingLow    = "low"
+	ThinkingMedium = "medium"
+	ThinkingHigh   = "high"
+)
+
+type ThinkingConfig struct {
+	// think on every request.
+	Enable bool
+	// "low", "medium" or "high", ignored if Budget is set.
+	Level string
+	// thinking tokens, gemini only. 0 disables thinking and -1 let the model decide.
+	Budget *int32
+}
+
+// thinking token budget of the config, nil means provider default.
+func (tc ThinkingConfig) budget() *int32 {
+	if tc.Budget != nil {
+		return tc.Budget
+	}
+	var b int32
+	switch tc.Level {
+	case ThinkingLow:
+		b = 1024
+	case ThinkingMedium:
+		b = 8192
+	case ThinkingHigh:
+		b = 24576
+	default:
+		return nil
+	}
+	return &b
 }
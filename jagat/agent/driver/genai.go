@@ -4,13 +4,49 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"strings"
 
 	"github.com/odit-bit/jagatai/jagat/agent"
 	"google.golang.org/genai"
 )
 
-var _ agent.Provider = (*GeminiAdapter)(nil)
+var _ agent.StreamingProvider = (*GeminiAdapter)(nil)
+
+func init() {
+	Register("genai", newGeminiDriver)
+}
+
+// genai settings of ProviderConfig.Extra.
+type GeminiExtra struct {
+	// "gemini" (default) or "vertex".
+	Backend string `json:"backend"`
+	// GCP project and location, vertex only.
+	Project  string `json:"project"`
+	Location string `json:"location"`
+}
+
+func newGeminiDriver(cfg ProviderConfig) (agent.Provider, error) {
+	var extra GeminiExtra
+	if err := cfg.Decode(&extra); err != nil {
+		return nil, err
+	}
+	cc := &genai.ClientConfig{
+		APIKey:   cfg.ApiKey,
+		Backend:  genai.BackendGeminiAPI,
+		Project:  extra.Project,
+		Location: extra.Location,
+	}
+	switch extra.Backend {
+	case "", "gemini":
+	case "vertex":
+		cc.Backend = genai.BackendVertexAI
+	default:
+		return nil, fmt.Errorf("unknown genai backend: %s", extra.Backend)
+	}
+	conf := cfg.Options
+	return newGeminiAdapter(cfg.Model, cc, &conf)
+}
 
 type GeminiAdapter struct {
 	model string
@@ -19,17 +55,19 @@ type GeminiAdapter struct {
 }
 
 func NewGeminiAdapter(model, key string, config *Config) (*GeminiAdapter, error) {
+	return newGeminiAdapter(model, &genai.ClientConfig{
+		APIKey:  key,
+		Backend: genai.BackendGeminiAPI,
+	}, config)
+}
+
+func newGeminiAdapter(model string, cc *genai.ClientConfig, config *Config) (*GeminiAdapter, error) {
 	if model == "" {
 		return nil, fmt.Errorf("gemini_adapter model cannot be empty")
 	}
 
-	cli, err := genai.NewClient(context.Background(), &genai.ClientConfig{
-		APIKey:  key,
-		Backend: genai.BackendGeminiAPI,
-		HTTPOptions: genai.HTTPOptions{
-			ExtraBody: map[string]any{},
-		},
-	})
+	cc.HTTPOptions.ExtraBody = map[string]any{}
+	cli, err := genai.NewClient(context.Background(), cc)
 	if err != nil {
 		return nil, fmt.Errorf("failed start gemini_adapter: %s", err)
 	}
@@ -45,7 +83,90 @@ func NewGeminiAdapter(model, key string, config *Config) (*GeminiAdapter, error)
 
 // Chat implements agent.Provider.
 func (g *GeminiAdapter) Chat(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+	contents, config, err := g.request(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.cli.Models.GenerateContent(ctx, g.model, contents, config)
+	if err != nil {
+		return nil, fmt.Errorf("genai_adapater failed generating content: %w", err)
+	}
+
+	// message decoding from genai.Content
+
+	textPart := responseText(resp)
+
+	toolCall, err := responseToolCalls(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	//find text or toolCall
+	// respons message
+	candidate := resp.Candidates[0]
+	a := &agent.CCRes{
+		ID:    resp.ResponseID,
+		Model: resp.ModelVersion,
+		Choices: []agent.Choice{
+			{
+				Index:        0,
+				Text:         textPart,
+				Thought:      responseThought(resp),
+				ToolCalls:    toolCall,
+				FinishReason: string(candidate.FinishReason),
+			},
+		},
+		Created: resp.CreateTime,
+		Usage:   mappingUsage(resp.UsageMetadata),
+	}
+
+	return a, nil
+}
+
+// ChatStream implements agent.StreamingProvider.
+func (g *GeminiAdapter) ChatStream(ctx context.Context, req agent.CCReq) iter.Seq2[agent.Chunk, error] {
+	return func(yield func(agent.Chunk, error) bool) {
+		contents, config, err := g.request(req)
+		if err != nil {
+			yield(agent.Chunk{}, err)
+			return
+		}
+
+		for resp, err := range g.cli.Models.GenerateContentStream(ctx, g.model, contents, config) {
+			if err != nil {
+				yield(agent.Chunk{}, fmt.Errorf("genai_adapater failed streaming content: %w", err))
+				return
+			}
 
+			// gemini send complete function call in single chunk.
+			toolCall, err := responseToolCalls(resp)
+			if err != nil {
+				yield(agent.Chunk{}, err)
+				return
+			}
+			chunk := agent.Chunk{
+				ID:        resp.ResponseID,
+				Model:     resp.ModelVersion,
+				Text:      responseText(resp),
+				Thought:   responseThought(resp),
+				ToolCalls: toolCall,
+			}
+			if len(resp.Candidates) > 0 {
+				chunk.FinishReason = string(resp.Candidates[0].FinishReason)
+			}
+			if resp.UsageMetadata != nil {
+				usage := mappingUsage(resp.UsageMetadata)
+				chunk.Usage = &usage
+			}
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}
+}
+
+// encoding agent request into genai contents and generation config.
+func (g *GeminiAdapter) request(req agent.CCReq) ([]*genai.Content, *genai.GenerateContentConfig, error) {
 	var sys *genai.Content
 	contents := []*genai.Content{}
 
@@ -62,16 +183,21 @@ func (g *GeminiAdapter) Chat(ctx context.Context, req agent.CCReq) (*agent.CCRes
 		case agent.RoleSystem:
 
 		default:
-			return nil, fmt.Errorf("gemini_adapter unknown message role: %v", msg.Role)
+			return nil, nil, fmt.Errorf("gemini_adapter unknown message role: %v", msg.Role)
 
 		}
 
 		if err := messageToContent(msg, content); err != nil {
-			return nil, fmt.Errorf("gemini_adapter failed convert message: %w", err)
+			return nil, nil, fmt.Errorf("gemini_adapter failed convert message: %w", err)
 		}
 
+		// multiple system messages are merged into one instruction.
 		if msg.Role == agent.RoleSystem {
-			sys = content
+			if sys == nil {
+				sys = content
+			} else {
+				sys.Parts = append(sys.Parts, content.Parts...)
+			}
 			continue
 		}
 
@@ -79,58 +205,93 @@ func (g *GeminiAdapter) Chat(ctx context.Context, req agent.CCReq) (*agent.CCRes
 	}
 
 	if len(contents) == 0 {
-		return nil, fmt.Errorf("gemini_adapter content is empty")
+		return nil, nil, fmt.Errorf("gemini_adapter content is empty")
 	}
 
-	config := genai.GenerateContentConfig{
+	temperature := g.conf.Temperature
+	if req.Temperature != nil {
+		temperature = req.Temperature
+	}
+	config := &genai.GenerateContentConfig{
 		SystemInstruction: sys,
 		Tools:             toolEncoding(req.Tools),
+		ToolConfig:        toolConfig(req),
 		SafetySettings:    safetySetting,
-		Temperature:       g.conf.Temperature,
+		Temperature:       temperature,
 		TopP:              g.conf.TopP,
 		TopK:              g.conf.TopK,
+		ThinkingConfig:    thinkingConfig(req, g.conf.Thinking),
 	}
-	resp, err := g.cli.Models.GenerateContent(ctx, g.model, contents, &config)
-	if err != nil {
-		return nil, fmt.Errorf("genai_adapater failed generating content: %w", err)
+	// gemini does not support function calling with JSON response, the schema only apply to tool-less request.
+	if req.ResponseSchema != nil && len(req.Tools) == 0 {
+		config.ResponseMIMEType = "application/json"
+		config.ResponseSchema = toSchema(*req.ResponseSchema)
+	}
+	return contents, config, nil
+}
+
+// thought summary is only returned if include thoughts is set, budget alone can still limit or disable thinking.
+func thinkingConfig(req agent.CCReq, conf ThinkingConfig) *genai.ThinkingConfig {
+	think := req.Think || conf.Enable
+	budget := conf.budget()
+	if !think && budget == nil {
+		return nil
 	}
+	return &genai.ThinkingConfig{IncludeThoughts: think, ThinkingBudget: budget}
+}
 
-	// message decoding from genai.Content
+// text of thought parts, resp.Text skip them.
+// answer text of the response, unlike resp.Text it does not log a warning for function call parts.
+func responseText(resp *genai.GenerateContentResponse) string {
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if !part.Thought {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
 
-	textPart := resp.Text()
+func responseThought(resp *genai.GenerateContentResponse) string {
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if part.Thought {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
 
+func responseToolCalls(resp *genai.GenerateContentResponse) ([]*agent.ToolCall, error) {
 	toolCall := []*agent.ToolCall{}
-	if resp.FunctionCalls() != nil {
-		for _, fc := range resp.FunctionCalls() {
-			tc, err := mappingToToolCall(fc)
-			if err != nil {
-				return nil, fmt.Errorf("gemini_adapter failed conversion function call: %v", err)
-			}
-			toolCall = append(toolCall, tc)
+	for _, fc := range resp.FunctionCalls() {
+		tc, err := mappingToToolCall(fc)
+		if err != nil {
+			return nil, fmt.Errorf("gemini_adapter failed conversion function call: %v", err)
 		}
+		toolCall = append(toolCall, tc)
 	}
+	return toolCall, nil
+}
 
-	//find text or toolCall
-	// respons message
-	candidate := resp.Candidates[0]
-	a := &agent.CCRes{
-		ID:    resp.ResponseID,
-		Model: resp.ModelVersion,
-		Choices: []agent.Choice{
-			{
-				Index:        0,
-				Text:         textPart,
-				ToolCalls:    toolCall,
-				FinishReason: string(candidate.FinishReason),
-			},
-		},
-		Created: resp.CreateTime,
-		Usage: agent.Usage{
-			CompletionTokens: candidate.TokenCount,
-		},
+// map gemini usage metadata, thought tokens are counted as completion tokens.
+func mappingUsage(um *genai.GenerateContentResponseUsageMetadata) agent.Usage {
+	if um == nil {
+		return agent.Usage{}
+	}
+	return agent.Usage{
+		PromptTokens:     um.PromptTokenCount,
+		CompletionTokens: um.CandidatesTokenCount + um.ThoughtsTokenCount,
+		TotalTokens:      um.TotalTokenCount,
+		CachedTokens:     um.CachedContentTokenCount,
+		ThinkingTokens:   um.ThoughtsTokenCount,
 	}
-
-	return a, nil
 }
 
 // suppose to use for testing.
@@ -143,9 +304,13 @@ func messageToContent(src *agent.Message, dst *genai.Content) error {
 	for _, p := range src.Parts {
 		part := &genai.Part{}
 		var err error
+		// thought without its signature is not accepted back by gemini.
+		if p.Thought != "" {
+			continue
+		}
 		if p.Text != "" {
 			part = genai.NewPartFromText(p.Text)
-			
+
 		} else if p.Blob != nil {
 			part = genai.NewPartFromBytes(
 				p.Blob.Bytes,
@@ -160,6 +325,7 @@ func messageToContent(src *agent.Message, dst *genai.Content) error {
 				p.ToolResponse.Name,
 				p.ToolResponse.Output,
 			)
+			part.FunctionResponse.ID = p.ToolResponse.ID
 		}
 
 		if err != nil {
@@ -184,6 +350,26 @@ func toolEncoding(src []agent.Tool) []*genai.Tool {
 	return tools
 }
 
+// map tool choice into gemini function calling mode, a tool name is forced with mode ANY.
+func toolConfig(req agent.CCReq) *genai.ToolConfig {
+	if len(req.Tools) == 0 {
+		return nil
+	}
+	fc := &genai.FunctionCallingConfig{}
+	switch req.ToolChoice {
+	case "", agent.ToolChoiceAuto:
+		return nil
+	case agent.ToolChoiceNone:
+		fc.Mode = genai.FunctionCallingConfigModeNone
+	case agent.ToolChoiceRequired:
+		fc.Mode = genai.FunctionCallingConfigModeAny
+	default:
+		fc.Mode = genai.FunctionCallingConfigModeAny
+		fc.AllowedFunctionNames = []string{req.ToolChoice}
+	}
+	return &genai.ToolConfig{FunctionCallingConfig: fc}
+}
+
 // ToFunctionDeclaration converts a Tool into a genai.FunctionDeclaration.
 // This correctly maps data types to the format required by the gemini.
 func ToFunctionDeclaration(t *agent.Tool) *genai.FunctionDeclaration {
@@ -191,27 +377,6 @@ func ToFunctionDeclaration(t *agent.Tool) *genai.FunctionDeclaration {
 		return nil
 	}
 
-	// Helper function to map type strings to the gemini API's required types.
-	mapType := func(inputType string) genai.Type {
-		switch strings.ToLower(inputType) {
-		case "string":
-			return genai.TypeString
-		case "number", "float", "double": // Handles float, double, etc.
-			return genai.TypeNumber
-		case "integer", "int":
-			return genai.TypeInteger
-		case "boolean", "bool":
-			return genai.TypeBoolean
-		case "object":
-			return genai.TypeObject
-		case "array":
-			return genai.TypeArray
-		default:
-			// Fallback for any other types, converting to uppercase
-			return genai.Type(strings.ToUpper(inputType))
-		}
-	}
-
 	// Create the main parameter schema for the function declaration.
 	paramSchema := &genai.Schema{
 		Type:       mapType(t.Function.Parameters.Type),
@@ -219,13 +384,9 @@ func ToFunctionDeclaration(t *agent.Tool) *genai.FunctionDeclaration {
 		Required:   t.Function.Parameters.Required,
 	}
 
-	// Iterate over the properties and convert each one, using mapping logic.
+	// Iterate over the properties and convert each one, nested definition is converted recursively.
 	for name, propDef := range t.Function.Parameters.Properties {
-		paramSchema.Properties[name] = &genai.Schema{
-			Type:        mapType(propDef.Type),
-			Description: propDef.Description,
-			Enum:        propDef.Enum,
-		}
+		paramSchema.Properties[name] = toSchema(propDef)
 	}
 
 	// Construct the final FunctionDeclaration.
@@ -237,6 +398,75 @@ func ToFunctionDeclaration(t *agent.Tool) *genai.FunctionDeclaration {
 	return declaration
 }
 
+// Helper function to map type strings to the gemini API's required types.
+func mapType(inputType string) genai.Type {
+	switch strings.ToLower(inputType) {
+	case "string":
+		return genai.TypeString
+	case "number", "float", "double": // Handles float, double, etc.
+		return genai.TypeNumber
+	case "integer", "int":
+		return genai.TypeInteger
+	case "boolean", "bool":
+		return genai.TypeBoolean
+	case "object":
+		return genai.TypeObject
+	case "array":
+		return genai.TypeArray
+	default:
+		// Fallback for any other types, converting to uppercase
+		return genai.Type(strings.ToUpper(inputType))
+	}
+}
+
+// convert parameter definition into gemini schema, oneOf is mapped to anyOf since gemini has no oneOf.
+func toSchema(def agent.ParameterDefinition) *genai.Schema {
+	schema := &genai.Schema{
+		Type:        mapType(def.Type),
+		Description: def.Description,
+		Enum:        def.Enum,
+		Default:     def.Default,
+		Minimum:     def.Minimum,
+		Maximum:     def.Maximum,
+		MinLength:   int64Ptr(def.MinLength),
+		MaxLength:   int64Ptr(def.MaxLength),
+		MinItems:    int64Ptr(def.MinItems),
+		MaxItems:    int64Ptr(def.MaxItems),
+		Required:    def.Required,
+	}
+
+	// gemini function declaration only support enum and date-time format, the others is kept as hint.
+	switch def.Format {
+	case "":
+	case "date-time":
+		schema.Format = def.Format
+	default:
+		schema.Description = strings.TrimSpace(fmt.Sprintf("%s (format: %s)", def.Description, def.Format))
+	}
+
+	if def.Items != nil {
+		schema.Items = toSchema(*def.Items)
+	}
+	if len(def.Properties) > 0 {
+		schema.Properties = make(map[string]*genai.Schema, len(def.Properties))
+		for name, prop := range def.Properties {
+			schema.Properties[name] = toSchema(prop)
+		}
+	}
+	for _, alt := range def.OneOf {
+		schema.AnyOf = append(schema.AnyOf, toSchema(alt))
+	}
+	return schema
+}
+
+func int64Ptr(n *int) *int64 {
+	if n == nil {
+		return nil
+	}
+	v := int64(*n)
+	return &v
+}
+
 // converts a genai.FunctionCall response into a ToolCall that agent understand.
 // It returns an error if the arguments map cannot be marshaled to a JSON string.
 func mappingToToolCall(fc *genai.FunctionCall) (*agent.ToolCall, error) {
@@ -1,6 +1,9 @@
 package driver
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -54,3 +57,198 @@ func Test_messageToContent(t *testing.T) {
 
 	assert.Equal(t, (*genai.Blob)(nil), content.Parts[0].InlineData)
 }
+
+func Test_mappingUsage(t *testing.T) {
+	usage := mappingUsage(&genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:        100,
+		CachedContentTokenCount: 40,
+		CandidatesTokenCount:    20,
+		ThoughtsTokenCount:      30,
+		TotalTokenCount:         150,
+	})
+	assert.Equal(t, agent.Usage{
+		PromptTokens:     100,
+		CompletionTokens: 50,
+		TotalTokens:      150,
+		CachedTokens:     40,
+		ThinkingTokens:   30,
+	}, usage)
+	assert.Equal(t, agent.Usage{}, mappingUsage(nil))
+}
+
+func Test_toolConfig(t *testing.T) {
+	tools := []agent.Tool{{Type: "function", Function: agent.Function{Name: "geocode"}}}
+	testCases := []struct {
+		name     string
+		req      agent.CCReq
+		expected *genai.ToolConfig
+	}{
+		{name: "auto", req: agent.CCReq{Tools: tools, ToolChoice: "auto"}},
+		{name: "empty", req: agent.CCReq{Tools: tools}},
+		{name: "no tools", req: agent.CCReq{ToolChoice: "required"}},
+		{
+			name:     "none",
+			req:      agent.CCReq{Tools: tools, ToolChoice: "none"},
+			expected: &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeNone}},
+		},
+		{
+			name:     "required",
+			req:      agent.CCReq{Tools: tools, ToolChoice: "required"},
+			expected: &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeAny}},
+		},
+		{
+			name: "function",
+			req:  agent.CCReq{Tools: tools, ToolChoice: "geocode"},
+			expected: &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{
+				Mode:                 genai.FunctionCallingConfigModeAny,
+				AllowedFunctionNames: []string{"geocode"},
+			}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, toolConfig(tc.req))
+		})
+	}
+}
+
+func Test_toSchema(t *testing.T) {
+	minimum, maxItems := 1.0, 5
+	def := agent.ParameterDefinition{
+		Type:     "array",
+		MaxItems: &maxItems,
+		Items: &agent.ParameterDefinition{
+			Type: "object",
+			Properties: map[string]agent.ParameterDefinition{
+				"when":  {Type: "string", Format: "date-time"},
+				"email": {Type: "string", Format: "email", Description: "guest"},
+				"seats": {Type: "integer", Minimum: &minimum, Default: 2},
+				"room":  {OneOf: []agent.ParameterDefinition{{Type: "integer"}, {Type: "string"}}},
+			},
+			Required: []string{"email"},
+		},
+	}
+	maxItems64, minimum64 := int64(5), 1.0
+
+	expected := &genai.Schema{
+		Type:     genai.TypeArray,
+		MaxItems: &maxItems64,
+		Items: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"when":  {Type: genai.TypeString, Format: "date-time"},
+				"email": {Type: genai.TypeString, Description: "guest (format: email)"},
+				"seats": {Type: genai.TypeInteger, Minimum: &minimum64, Default: 2},
+				"room":  {AnyOf: []*genai.Schema{{Type: genai.TypeInteger}, {Type: genai.TypeString}}},
+			},
+			Required: []string{"email"},
+		},
+	}
+	assert.Equal(t, expected, toSchema(def))
+}
+
+func Test_geminiResponseSchema(t *testing.T) {
+	g := &GeminiAdapter{model: "test-model", conf: &Config{}}
+	schema := &agent.ParameterDefinition{
+		Type:       agent.Parameter_Type_Object,
+		Properties: map[string]agent.ParameterDefinition{"city": {Type: agent.Parameter_Type_String}},
+	}
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "largest city")}
+
+	_, config, err := g.request(agent.CCReq{Messages: msgs, ResponseSchema: schema})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", config.ResponseMIMEType)
+	require.NotNil(t, config.ResponseSchema)
+	assert.Equal(t, genai.TypeObject, config.ResponseSchema.Type)
+
+	// json response cannot be combined with function calling.
+	tools := []agent.Tool{{Type: "function", Function: agent.Function{Name: "geocode"}}}
+	_, config, err = g.request(agent.CCReq{Messages: msgs, Tools: tools, ResponseSchema: schema})
+	require.NoError(t, err)
+	assert.Empty(t, config.ResponseMIMEType)
+	assert.Nil(t, config.ResponseSchema)
+}
+
+func Test_thinkingConfig(t *testing.T) {
+	budget := int32(512)
+	testCases := []struct {
+		name     string
+		think    bool
+		conf     ThinkingConfig
+		expected *genai.ThinkingConfig
+	}{
+		{name: "default"},
+		{name: "request", think: true, expected: &genai.ThinkingConfig{IncludeThoughts: true}},
+		{name: "enable", conf: ThinkingConfig{Enable: true, Level: ThinkingLow}, expected: &genai.ThinkingConfig{IncludeThoughts: true, ThinkingBudget: genai.Ptr[int32](1024)}},
+		{name: "budget override level", think: true, conf: ThinkingConfig{Level: ThinkingHigh, Budget: &budget}, expected: &genai.ThinkingConfig{IncludeThoughts: true, ThinkingBudget: &budget}},
+		{name: "budget only", conf: ThinkingConfig{Budget: genai.Ptr[int32](0)}, expected: &genai.ThinkingConfig{ThinkingBudget: genai.Ptr[int32](0)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, thinkingConfig(agent.CCReq{Think: tc.think}, tc.conf))
+		})
+	}
+}
+
+func Test_geminiThought(t *testing.T) {
+	resp := &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{Content: &genai.Content{Parts: []*genai.Part{
+		{Text: "user greets", Thought: true},
+		{Text: "hello"},
+	}}}}}
+	assert.Equal(t, "user greets", responseThought(resp))
+	assert.Equal(t, "hello", responseText(resp))
+
+	// thought is not sent back in history.
+	content := &genai.Content{}
+	require.NoError(t, messageToContent(&agent.Message{Role: agent.RoleAssistant, Parts: []*agent.Part{
+		{Thought: "user greets"}, {Text: "hello"},
+	}}, content))
+	require.Len(t, content.Parts, 1)
+	assert.Equal(t, "hello", content.Parts[0].Text)
+}
+
+func Test_geminiChatStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1beta/models/test-model:streamGenerateContent", r.URL.Path)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range []string{
+			`{"responseId":"r1","modelVersion":"test-model","candidates":[{"content":{"role":"model","parts":[{"text":"user wants ","thought":true}]}}],"usageMetadata":{"promptTokenCount":10,"totalTokenCount":10}}`,
+			`{"responseId":"r1","modelVersion":"test-model","candidates":[{"content":{"role":"model","parts":[{"text":"Let me "}]}}]}`,
+			`{"responseId":"r1","modelVersion":"test-model","candidates":[{"content":{"role":"model","parts":[{"text":"check."},{"functionCall":{"name":"weather","args":{"city":"Paris"}}}]}}]}`,
+			`{"responseId":"r1","modelVersion":"test-model","candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":6,"thoughtsTokenCount":3,"totalTokenCount":19}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	g, err := newGeminiAdapter("test-model", &genai.ClientConfig{
+		APIKey:      "key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: ts.URL},
+	}, &Config{})
+	require.NoError(t, err)
+
+	var text, thought, finish string
+	var calls []*agent.ToolCall
+	var usage *agent.Usage
+	for chunk, err := range g.ChatStream(t.Context(), agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "weather in paris?")}}) {
+		require.NoError(t, err)
+		assert.Equal(t, "r1", chunk.ID)
+		text += chunk.Text
+		thought += chunk.Thought
+		calls = append(calls, chunk.ToolCalls...)
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	assert.Equal(t, "Let me check.", text)
+	assert.Equal(t, "user wants ", thought)
+	assert.Equal(t, "STOP", finish)
+	assert.Equal(t, []*agent.ToolCall{{Type: "function", Function: agent.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}}, calls)
+	require.NotNil(t, usage)
+	assert.Equal(t, agent.Usage{PromptTokens: 10, CompletionTokens: 9, TotalTokens: 19, ThinkingTokens: 3}, *usage)
+}
@@ -0,0 +1,140 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// http helper shared by the drivers that call the provider API directly.
+
+const (
+	_http_default_max_retry  = 2
+	_http_default_retry_wait = 500 * time.Millisecond
+	// longer Retry-After fails the request instead of stalling the run.
+	_http_default_max_wait = time.Minute
+)
+
+// send request and retry it with exponential backoff on 429, 5xx and network error.
+type retryClient struct {
+	hc *http.Client
+	// prefix of the errors.
+	name      string
+	maxRetry  int
+	retryWait time.Duration
+	maxWait   time.Duration
+}
+
+func newRetryClient(name string) retryClient {
+	return retryClient{
+		hc:        http.DefaultClient,
+		name:      name,
+		maxRetry:  _http_default_max_retry,
+		retryWait: _http_default_retry_wait,
+		maxWait:   _http_default_max_wait,
+	}
+}
+
+// newRequest is called for every attempt so the body can be read again.
+func (rc *retryClient) do(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var errTry error
+	for attempt := 0; ; attempt++ {
+		request, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		var wait time.Duration
+		res, err := rc.hc.Do(request)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("%s: %w", rc.name, err)
+			}
+			errTry = err
+		case res.StatusCode < 300:
+			return res, nil
+		default:
+			errTry = statusError(rc.name, res)
+			res.Body.Close()
+			if res.StatusCode != http.StatusTooManyRequests && res.StatusCode < 500 {
+				return nil, errTry
+			}
+			wait = retryAfter(res.Header.Get("Retry-After"))
+			if wait > rc.maxWait {
+				return nil, fmt.Errorf("%s retry after %s exceeds max wait %s: %w", rc.name, wait, rc.maxWait, errTry)
+			}
+		}
+
+		if attempt >= rc.maxRetry {
+			return nil, fmt.Errorf("%s max attempt reach: %w", rc.name, errTry)
+		}
+		// exponential backoff with full jitter, unless the server tell how long to wait.
+		if wait == 0 {
+			wait = time.Duration(rand.Int63n(int64(rc.retryWait<<attempt) + 1))
+		}
+		slog.Debug(rc.name+" retry", "attempt", attempt+1, "max", rc.maxRetry, "wait", wait, "error", errTry)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s: %w", rc.name, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// error of non 2xx response, OpenAI and Anthropic put the reason in {"error":{"message":...}}.
+func statusError(name string, res *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	msg := strings.TrimSpace(string(b))
+	if err := json.Unmarshal(b, &body); err == nil && body.Error.Message != "" {
+		msg = body.Error.Message
+	}
+	return fmt.Errorf("%s request failed status %s: %s", name, res.Status, msg)
+}
+
+// Retry-After in seconds, HTTP date is not supported.
+func retryAfter(v string) time.Duration {
+	sec, err := strconv.Atoi(v)
+	if err != nil || sec <= 0 {
+		return 0
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// data of server-sent events until "[DONE]" or end of body.
+func sseData(r io.Reader) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			data, ok := strings.CutPrefix(sc.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return
+			}
+			if !yield([]byte(data), nil) {
+				return
+			}
+		}
+		if err := sc.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package driver
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"iter"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/odit-bit/jagatai/jagat/agent"
 	ollama "github.com/ollama/ollama/api"
@@ -20,12 +24,38 @@ const (
 
 //-----------------------------------------------
 
-var _ agent.Provider = (*OllamaAPI)(nil)
+var _ agent.StreamingProvider = (*OllamaAPI)(nil)
+
+func init() {
+	Register("ollama", newOllamaDriver)
+}
+
+// ollama settings of ProviderConfig.Extra.
+type OllamaExtra struct {
+	// how long the model stay loaded after request, e.g "10m", negative keep it loaded.
+	KeepAlive *ollama.Duration `json:"keepAlive"`
+}
+
+func newOllamaDriver(cfg ProviderConfig) (agent.Provider, error) {
+	var extra OllamaExtra
+	if err := cfg.Decode(&extra); err != nil {
+		return nil, err
+	}
+	conf := cfg.Options
+	conf.Endpoint = cfg.endpoint()
+	oa, err := NewOllamaAdapter(cfg.Model, cfg.ApiKey, &conf)
+	if err != nil {
+		return nil, err
+	}
+	oa.keepAlive = extra.KeepAlive
+	return oa, nil
+}
 
 type OllamaAPI struct {
-	model string
-	c     *ollama.Client
-	conf  *Config
+	model     string
+	c         *ollama.Client
+	conf      *Config
+	keepAlive *ollama.Duration
 }
 
 func NewOllamaAdapter(model string, key string, config *Config) (*OllamaAPI, error) {
@@ -51,74 +81,327 @@ func NewOllamaAdapter(model string, key string, config *Config) (*OllamaAPI, err
 
 // Chat implements LLM.
 func (oapi *OllamaAPI) Chat(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+	oReq, err := oapi.request(req, false)
+	if err != nil {
+		return nil, fmt.Errorf("ollama adapter: %w", err)
+	}
+
+	// the response may still come in several parts, they are accumulated.
+	var last ollama.ChatResponse
+	var msg ollama.Message
+	err = oapi.c.Chat(ctx, oReq, func(cr ollama.ChatResponse) error {
+		msg.Content += cr.Message.Content
+		msg.Thinking += cr.Message.Thinking
+		msg.ToolCalls = append(msg.ToolCalls, cr.Message.ToolCalls...)
+		last = cr
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ollama adapter: %w", err)
+	}
 
+	thought, text := ollamaThinking(msg)
+	return &agent.CCRes{
+		Model:   last.Model,
+		Created: last.CreatedAt,
+		Choices: []agent.Choice{
+			{
+				Text:         text,
+				Thought:      thought,
+				FinishReason: last.DoneReason,
+				ToolCalls:    ollamaToolCalls(msg.ToolCalls),
+			},
+		},
+		Usage: ollamaUsage(last.Metrics),
+	}, nil
+}
+
+// returned from chat callback when the consumer stop the iteration.
+var errStopStream = errors.New("ollama adapter: stream stopped")
+
+// ChatStream implements agent.StreamingProvider.
+func (oapi *OllamaAPI) ChatStream(ctx context.Context, req agent.CCReq) iter.Seq2[agent.Chunk, error] {
+	return func(yield func(agent.Chunk, error) bool) {
+		oReq, err := oapi.request(req, true)
+		if err != nil {
+			yield(agent.Chunk{}, fmt.Errorf("ollama adapter: %w", err))
+			return
+		}
+		var tags ollamaThinkTags
+		err = oapi.c.Chat(ctx, oReq, func(cr ollama.ChatResponse) error {
+			// ollama send each tool call complete in single chunk.
+			thought, text := tags.split(cr.Message.Content)
+			chunk := agent.Chunk{
+				Model:        cr.Model,
+				Text:         text,
+				Thought:      cr.Message.Thinking + thought,
+				ToolCalls:    ollamaToolCalls(cr.Message.ToolCalls),
+				FinishReason: cr.DoneReason,
+			}
+			// metrics is only reported in the last chunk.
+			if cr.Done {
+				rest, restText := tags.flush()
+				chunk.Thought += rest
+				chunk.Text += restText
+				usage := ollamaUsage(cr.Metrics)
+				chunk.Usage = &usage
+			}
+			if !yield(chunk, nil) {
+				return errStopStream
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopStream) {
+			yield(agent.Chunk{}, fmt.Errorf("ollama adapter: %w", err))
+		}
+	}
+}
+
+func (oapi *OllamaAPI) request(req agent.CCReq, stream bool) (*ollama.ChatRequest, error) {
 	msgs := []ollama.Message{}
 	for _, msg := range req.Messages {
-		oMsg := ollama.Message{
-			Role:    string(msg.Role),
-			Content: msg.Text(),
+		oMsgs, err := ollamaMessages(msg)
+		if err != nil {
+			return nil, err
 		}
-
-		msgs = append(msgs, oMsg)
+		msgs = append(msgs, oMsgs...)
 	}
 
 	// implement tools
+	choiceTools, instruction := ollamaToolChoice(req)
+	if instruction != "" {
+		msgs = append(msgs, ollama.Message{Role: string(agent.RoleSystem), Content: instruction})
+	}
 	tools := []ollama.Tool{}
-	for _, tool := range req.Tools {
+	for _, tool := range choiceTools {
 		var t ollama.Tool
 		OllamaTransformTool(tool, &t)
 		tools = append(tools, t)
 	}
 
-	oReq := &ollama.ChatRequest{
+	temperature := oapi.conf.Temperature
+	if req.Temperature != nil {
+		temperature = req.Temperature
+	}
+	// constrained output does not go along with tool calls, the schema only apply to tool-less request.
+	var format json.RawMessage
+	if req.ResponseSchema != nil && len(tools) == 0 {
+		format, _ = json.Marshal(req.ResponseSchema)
+	}
+	think := req.Think || oapi.conf.Thinking.Enable
+	return &ollama.ChatRequest{
 		Model:    oapi.model,
 		Messages: msgs,
-		Stream:   &req.Stream,
-		Think:    &req.Think,
+		Stream:   &stream,
+		Think:    &think,
 		Options: map[string]any{
-			"temperature": oapi.conf.Temperature,
+			"temperature": temperature,
 			"top_p":       oapi.conf.TopP,
 			"top_k":       oapi.conf.TopK,
 			"min_p":       oapi.conf.MinP,
 		},
-		Tools: tools,
-	}
-
-	var resp *agent.CCRes
-	err := oapi.c.Chat(ctx, oReq, func(cr ollama.ChatResponse) error {
-		tcs := []*agent.ToolCall{}
-		for _, tc := range cr.Message.ToolCalls {
-			log.Println("GOT TOOLCALLS", tc)
-
-			tcs = append(tcs, &agent.ToolCall{
-				ID:   tc.Function.Name,
-				Type: tc.Function.Name,
-				Function: agent.FunctionCall{
-					Name:      tc.Function.Name,
-					Arguments: tc.Function.Arguments.String(),
-				},
+		Tools:     tools,
+		Format:    format,
+		KeepAlive: oapi.keepAlive,
+	}, nil
+}
+
+// convert the message, tool message become one message per tool response.
+func ollamaMessages(msg *agent.Message) ([]ollama.Message, error) {
+	switch msg.Role {
+	case agent.RoleTool:
+		out := []ollama.Message{}
+		for _, p := range msg.Parts {
+			if p.ToolResponse == nil {
+				continue
+			}
+			b, err := json.Marshal(p.ToolResponse.Output)
+			if err != nil {
+				return nil, fmt.Errorf("tool response '%s': %w", p.ToolResponse.Name, err)
+			}
+			out = append(out, ollama.Message{
+				Role:     string(agent.RoleTool),
+				Content:  string(b),
+				ToolName: p.ToolResponse.Name,
 			})
 		}
+		return out, nil
 
-		resp = &agent.CCRes{
-			Model:   cr.Model,
-			Created: cr.CreatedAt,
-			Choices: []agent.Choice{
-				{
-					Text:         cr.Message.Content,
-					FinishReason: cr.DoneReason,
-					ToolCalls:    tcs,
-				},
-			},
+	case agent.RoleAssistant, agent.RoleUser, agent.RoleSystem:
+		om := ollama.Message{Role: string(msg.Role), Content: msg.Text()}
+		for _, p := range msg.Parts {
+			switch {
+			case p.Blob != nil:
+				if !strings.HasPrefix(p.Blob.Mime, "image/") {
+					return nil, fmt.Errorf("unsupported blob mime '%s', only image is supported", p.Blob.Mime)
+				}
+				om.Images = append(om.Images, ollama.ImageData(p.Blob.Bytes))
+			case p.Toolcall != nil:
+				// arguments that is not JSON object is sent empty, the invalid call is already answered by the agent.
+				args := ollama.ToolCallFunctionArguments{}
+				if err := json.Unmarshal([]byte(p.Toolcall.Function.Arguments), &args); err != nil || args == nil {
+					args = ollama.ToolCallFunctionArguments{}
+				}
+				om.ToolCalls = append(om.ToolCalls, ollama.ToolCall{
+					Function: ollama.ToolCallFunction{Name: p.Toolcall.Function.Name, Arguments: args},
+				})
+			}
 		}
-		return nil
-	})
+		return []ollama.Message{om}, nil
 
-	if err != nil {
-		return nil, fmt.Errorf("ollama adapter: %w", err)
+	default:
+		return nil, fmt.Errorf("unknown message role: %v", msg.Role)
 	}
-	return resp, nil
+}
 
+// ollama has no tool choice, none is honoured by omitting the tools,
+// required and named choice narrow the tools and instruct the model to call it.
+func ollamaToolChoice(req agent.CCReq) ([]agent.Tool, string) {
+	if len(req.Tools) == 0 {
+		return nil, ""
+	}
+	switch req.ToolChoice {
+	case "", agent.ToolChoiceAuto:
+		return req.Tools, ""
+	case agent.ToolChoiceNone:
+		return nil, ""
+	case agent.ToolChoiceRequired:
+		return req.Tools, "You must call one of the available tools before answering."
+	default:
+		for _, t := range req.Tools {
+			if t.Function.Name == req.ToolChoice {
+				return []agent.Tool{t}, fmt.Sprintf("You must call the tool '%s' before answering.", req.ToolChoice)
+			}
+		}
+		return req.Tools, ""
+	}
+}
+
+// thinking of the message, model that does not support think option may still inline it in <think> tags.
+func ollamaThinking(msg ollama.Message) (thought, text string) {
+	if msg.Thinking != "" {
+		return msg.Thinking, msg.Content
+	}
+	// split like the stream, so an unclosed <think> is thinking on both paths.
+	var tags ollamaThinkTags
+	thought, text = tags.split(msg.Content)
+	restThought, restText := tags.flush()
+	return thought + restThought, text + restText
+}
+
+// split streamed content of model that inline the thinking in <think> tags,
+// a tag cut between chunks and the space around the thinking are held back until the next chunk.
+type ollamaThinkTags struct {
+	state   ollamaThinkState
+	pending string
+	// thinking is already emitted, its leading space is trimmed.
+	thought bool
+}
+
+type ollamaThinkState int
+
+const (
+	// before any content.
+	ollamaThinkStart ollamaThinkState = iota
+	// inside the <think> tags.
+	ollamaThinkInside
+	// after the closing tag, before the answer.
+	ollamaThinkAfter
+	// answer text, or content without thinking.
+	ollamaThinkText
+)
+
+const ollamaSpace = " \t\r\n"
+
+func (t *ollamaThinkTags) split(content string) (thought, text string) {
+	const open, closing = "<think>", "</think>"
+	switch t.state {
+	case ollamaThinkStart:
+		t.pending += content
+		head := strings.TrimLeft(t.pending, ollamaSpace)
+		if strings.HasPrefix(open, head) {
+			return "", ""
+		}
+		if !strings.HasPrefix(head, open) {
+			t.state = ollamaThinkText
+			text, t.pending = t.pending, ""
+			return "", text
+		}
+		t.state, t.pending = ollamaThinkInside, ""
+		return t.split(head[len(open):])
+	case ollamaThinkInside:
+		t.pending += content
+		if before, after, ok := strings.Cut(t.pending, closing); ok {
+			t.state, t.pending = ollamaThinkAfter, ""
+			_, text = t.split(after)
+			return t.emit(strings.TrimRight(before, ollamaSpace)), text
+		}
+		// keep the tail that may be the start of the closing tag and the space before it.
+		keep := 0
+		for i := 1; i < len(closing) && i <= len(t.pending); i++ {
+			if strings.HasSuffix(t.pending, closing[:i]) {
+				keep = i
+			}
+		}
+		thought = strings.TrimRight(t.pending[:len(t.pending)-keep], ollamaSpace)
+		t.pending = t.pending[len(thought):]
+		return t.emit(thought), ""
+	case ollamaThinkAfter:
+		// space between the thinking and the answer is dropped.
+		text = strings.TrimLeft(content, ollamaSpace)
+		if text != "" {
+			t.state = ollamaThinkText
+		}
+		return "", text
+	default:
+		return "", content
+	}
+}
+
+func (t *ollamaThinkTags) emit(thought string) string {
+	if !t.thought {
+		thought = strings.TrimLeft(thought, ollamaSpace)
+		t.thought = thought != ""
+	}
+	return thought
+}
+
+// content held back when the stream ends.
+func (t *ollamaThinkTags) flush() (thought, text string) {
+	pending := t.pending
+	t.pending = ""
+	switch t.state {
+	case ollamaThinkInside:
+		return t.emit(pending), ""
+	case ollamaThinkAfter:
+		return "", ""
+	default:
+		return "", pending
+	}
+}
+
+// ollama does not report cached and thinking tokens separately, eval count include thinking.
+func ollamaUsage(m ollama.Metrics) agent.Usage {
+	return agent.Usage{
+		PromptTokens:     int32(m.PromptEvalCount),
+		CompletionTokens: int32(m.EvalCount),
+		TotalTokens:      int32(m.PromptEvalCount + m.EvalCount),
+	}
+}
+
+// ollama does not generate the ID, the agent assign one.
+func ollamaToolCalls(src []ollama.ToolCall) []*agent.ToolCall {
+	tcs := []*agent.ToolCall{}
+	for _, tc := range src {
+		tcs = append(tcs, &agent.ToolCall{
+			Type: "function",
+			Function: agent.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments.String(),
+			},
+		})
+	}
+	return tcs
 }
 
 // Transform takes a ToolA and produces the equivalent ToolB.
@@ -154,8 +437,23 @@ func OllamaTransformTool(aTool agent.Tool, bTool *ollama.Tool) {
 			enumAny = append(enumAny, e)
 		}
 
-		// wrap the single‐string type into B.PropertyType (which is []string)
+		// wrap the single‐string type into B.PropertyType (which is []string),
+		// oneOf without type become the union of its types.
 		pt := ollama.PropertyType{pa.Type}
+		if pa.Type == "" {
+			pt = ollama.PropertyType{}
+			for _, alt := range pa.OneOf {
+				if alt.Type != "" && !slices.Contains(pt, alt.Type) {
+					pt = append(pt, alt.Type)
+				}
+			}
+		}
+
+		// items is free form, so the element schema is kept as is.
+		var items any
+		if pa.Items != nil {
+			items = pa.Items
+		}
 
 		bTool.Function.Parameters.Properties[propName] = struct {
 			Type        ollama.PropertyType `json:"type"`
@@ -164,9 +462,22 @@ func OllamaTransformTool(aTool agent.Tool, bTool *ollama.Tool) {
 			Enum        []any               `json:"enum,omitempty"`
 		}{
 			Type:        pt,
-			Description: pa.Description,
+			Items:       items,
+			Description: ollamaDescription(pa),
 			Enum:        enumAny,
 		}
 	}
 
 }
+
+// ollama property has no field for nested properties, bounds, default, format and oneOf,
+// they are appended to the description as JSON schema so the model still see them.
+func ollamaDescription(def agent.ParameterDefinition) string {
+	rest := def
+	rest.Type, rest.Description, rest.Enum, rest.Items = "", "", nil, nil
+	b, err := json.Marshal(rest)
+	if err != nil || string(b) == "{}" {
+		return def.Description
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s Schema: %s", def.Description, b))
+}
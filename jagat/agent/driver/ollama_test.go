@@ -0,0 +1,381 @@
+package driver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	ollama "github.com/ollama/ollama/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fake ollama server that stream the responses as json lines.
+func ollamaServer(t *testing.T, responses ...ollama.ChatResponse) *OllamaAPI {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/chat", r.URL.Path)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, res := range responses {
+			require.NoError(t, json.NewEncoder(w).Encode(res))
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	oa, err := NewOllamaAdapter("test-model", "", &Config{Endpoint: ts.URL})
+	require.NoError(t, err)
+	return oa
+}
+
+func Test_ollamaUsage(t *testing.T) {
+	oa := ollamaServer(t,
+		ollama.ChatResponse{Model: "test-model", Message: ollama.Message{Role: "assistant", Content: "hel"}},
+		ollama.ChatResponse{
+			Model:      "test-model",
+			Message:    ollama.Message{Role: "assistant", Content: "lo"},
+			Done:       true,
+			DoneReason: "stop",
+			Metrics:    ollama.Metrics{PromptEvalCount: 12, EvalCount: 5},
+		},
+	)
+	req := agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}}
+	expected := agent.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}
+
+	var chunks []agent.Chunk
+	for chunk, err := range oa.ChatStream(t.Context(), req) {
+		require.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+	require.Len(t, chunks, 2)
+	assert.Nil(t, chunks[0].Usage)
+	require.NotNil(t, chunks[1].Usage)
+	assert.Equal(t, expected, *chunks[1].Usage)
+	assert.Equal(t, "stop", chunks[1].FinishReason)
+}
+
+func Test_ollamaChatUsage(t *testing.T) {
+	oa := ollamaServer(t, ollama.ChatResponse{
+		Model:      "test-model",
+		Message:    ollama.Message{Role: "assistant", Content: "hello"},
+		Done:       true,
+		DoneReason: "stop",
+		Metrics:    ollama.Metrics{PromptEvalCount: 12, EvalCount: 5},
+	})
+	res, err := oa.Chat(t.Context(), agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", res.Choices[0].Text)
+	assert.Equal(t, agent.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}, res.Usage)
+}
+
+func Test_ollamaToolChoice(t *testing.T) {
+	tools := []agent.Tool{
+		{Type: "function", Function: agent.Function{Name: "geocode"}},
+		{Type: "function", Function: agent.Function{Name: "weather"}},
+	}
+	testCases := []struct {
+		choice      string
+		tools       []string
+		instruction bool
+	}{
+		{choice: "", tools: []string{"geocode", "weather"}},
+		{choice: "auto", tools: []string{"geocode", "weather"}},
+		{choice: "none", tools: []string{}},
+		{choice: "required", tools: []string{"geocode", "weather"}, instruction: true},
+		{choice: "geocode", tools: []string{"geocode"}, instruction: true},
+	}
+	oa := ollamaServer(t)
+	for _, tc := range testCases {
+		t.Run(tc.choice, func(t *testing.T) {
+			req, err := oa.request(agent.CCReq{
+				Messages:   []*agent.Message{agent.NewTextMessage(agent.RoleUser, "weather in Paris")},
+				Tools:      tools,
+				ToolChoice: tc.choice,
+			}, false)
+			require.NoError(t, err)
+
+			names := []string{}
+			for _, tool := range req.Tools {
+				names = append(names, tool.Function.Name)
+			}
+			assert.Equal(t, tc.tools, names)
+
+			last := req.Messages[len(req.Messages)-1]
+			if tc.instruction {
+				assert.Equal(t, "system", last.Role)
+			} else {
+				assert.Len(t, req.Messages, 1)
+			}
+		})
+	}
+}
+
+func Test_OllamaTransformTool(t *testing.T) {
+	maximum := 3.0
+	tool := agent.Tool{Type: "function", Function: agent.Function{
+		Name: "search",
+		Parameters: agent.ParameterSchema{
+			Type: agent.Parameter_Type_Object,
+			Properties: map[string]agent.ParameterDefinition{
+				"query": {Type: "string", Description: "search query"},
+				"limit": {Type: "integer", Description: "max results", Maximum: &maximum},
+				"tags":  {Type: "array", Items: &agent.ParameterDefinition{Type: "string", Enum: []string{"news", "blog"}}},
+				"id":    {OneOf: []agent.ParameterDefinition{{Type: "string"}, {Type: "integer"}}},
+			},
+			Required: []string{"query"},
+		},
+	}}
+
+	var ot ollama.Tool
+	OllamaTransformTool(tool, &ot)
+	props := ot.Function.Parameters.Properties
+
+	assert.Equal(t, "search query", props["query"].Description)
+	assert.Equal(t, `max results Schema: {"maximum":3}`, props["limit"].Description)
+	assert.Equal(t, ollama.PropertyType{"array"}, props["tags"].Type)
+	b, err := json.Marshal(props["tags"].Items)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"string","enum":["news","blog"]}`, string(b))
+	assert.Equal(t, ollama.PropertyType{"string", "integer"}, props["id"].Type)
+	assert.Equal(t, `Schema: {"oneOf":[{"type":"string"},{"type":"integer"}]}`, props["id"].Description)
+}
+
+func Test_ollamaResponseSchema(t *testing.T) {
+	schema := &agent.ParameterDefinition{
+		Type:       agent.Parameter_Type_Object,
+		Properties: map[string]agent.ParameterDefinition{"city": {Type: agent.Parameter_Type_String}},
+	}
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "largest city")}
+	oa := ollamaServer(t)
+
+	req, err := oa.request(agent.CCReq{Messages: msgs, ResponseSchema: schema}, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"object","properties":{"city":{"type":"string"}}}`, string(req.Format))
+
+	tools := []agent.Tool{{Type: "function", Function: agent.Function{Name: "geocode"}}}
+	req, err = oa.request(agent.CCReq{Messages: msgs, Tools: tools, ResponseSchema: schema}, false)
+	require.NoError(t, err)
+	assert.Empty(t, req.Format)
+}
+
+func Test_ollamaThinking(t *testing.T) {
+	testCases := []struct {
+		name    string
+		msg     ollama.Message
+		thought string
+		text    string
+	}{
+		{name: "native", msg: ollama.Message{Thinking: "user greets", Content: "hello"}, thought: "user greets", text: "hello"},
+		{name: "inline tags", msg: ollama.Message{Content: "<think>\nuser greets\n</think>\n\nhello"}, thought: "user greets", text: "hello"},
+		{name: "no thinking", msg: ollama.Message{Content: "hello"}, text: "hello"},
+		{name: "unclosed tag", msg: ollama.Message{Content: "<think>user greets"}, thought: "user greets"},
+		{name: "truncated closing tag", msg: ollama.Message{Content: "<think>user greets</thi"}, thought: "user greets</thi"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			thought, text := ollamaThinking(tc.msg)
+			assert.Equal(t, tc.thought, thought)
+			assert.Equal(t, tc.text, text)
+		})
+	}
+}
+
+func Test_ollamaThink(t *testing.T) {
+	oa := ollamaServer(t, ollama.ChatResponse{
+		Model:   "test-model",
+		Message: ollama.Message{Role: "assistant", Thinking: "user greets", Content: "hello"},
+		Done:    true,
+	})
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}
+
+	res, err := oa.Chat(t.Context(), agent.CCReq{Messages: msgs, Think: true})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", res.Choices[0].Text)
+	assert.Equal(t, "user greets", res.Choices[0].Thought)
+
+	think := func(req agent.CCReq) bool {
+		oReq, err := oa.request(req, false)
+		require.NoError(t, err)
+		return *oReq.Think
+	}
+	assert.False(t, think(agent.CCReq{Messages: msgs}))
+	assert.True(t, think(agent.CCReq{Messages: msgs, Think: true}))
+	oa.conf.Thinking.Enable = true
+	assert.True(t, think(agent.CCReq{Messages: msgs}))
+}
+
+func Test_ollamaMessages(t *testing.T) {
+	testCases := []struct {
+		name     string
+		msg      *agent.Message
+		expected []ollama.Message
+		err      string
+	}{
+		{
+			name:     "text",
+			msg:      agent.NewTextMessage(agent.RoleSystem, "be brief"),
+			expected: []ollama.Message{{Role: "system", Content: "be brief"}},
+		},
+		{
+			name: "image",
+			msg: &agent.Message{Role: agent.RoleUser, Parts: []*agent.Part{
+				{Text: "what is this?"},
+				{Blob: &agent.Blob{Bytes: []byte("png"), Mime: "image/png"}},
+			}},
+			expected: []ollama.Message{{Role: "user", Content: "what is this?", Images: []ollama.ImageData{[]byte("png")}}},
+		},
+		{
+			name: "unsupported blob",
+			msg: &agent.Message{Role: agent.RoleUser, Parts: []*agent.Part{
+				{Blob: &agent.Blob{Bytes: []byte("%PDF"), Mime: "application/pdf"}},
+			}},
+			err: "unsupported blob mime 'application/pdf', only image is supported",
+		},
+		{
+			name: "tool calls",
+			msg: &agent.Message{Role: agent.RoleAssistant, Parts: []*agent.Part{
+				{Thought: "need coordinate"},
+				{Toolcall: &agent.ToolCall{ID: "call_0_0", Type: "function", Function: agent.FunctionCall{Name: "geocode", Arguments: `{"city":"Paris"}`}}},
+				{Toolcall: &agent.ToolCall{ID: "call_0_1", Type: "function", Function: agent.FunctionCall{Name: "clock", Arguments: `{}`}}},
+			}},
+			expected: []ollama.Message{{Role: "assistant", ToolCalls: []ollama.ToolCall{
+				{Function: ollama.ToolCallFunction{Name: "geocode", Arguments: ollama.ToolCallFunctionArguments{"city": "Paris"}}},
+				{Function: ollama.ToolCallFunction{Name: "clock", Arguments: ollama.ToolCallFunctionArguments{}}},
+			}}},
+		},
+		{
+			name: "invalid arguments",
+			msg: &agent.Message{Role: agent.RoleAssistant, Parts: []*agent.Part{
+				{Toolcall: &agent.ToolCall{Function: agent.FunctionCall{Name: "geocode", Arguments: `{"city":`}}},
+				{Toolcall: &agent.ToolCall{Function: agent.FunctionCall{Name: "clock", Arguments: ``}}},
+				{Toolcall: &agent.ToolCall{Function: agent.FunctionCall{Name: "clock", Arguments: `null`}}},
+			}},
+			expected: []ollama.Message{{Role: "assistant", ToolCalls: []ollama.ToolCall{
+				{Function: ollama.ToolCallFunction{Name: "geocode", Arguments: ollama.ToolCallFunctionArguments{}}},
+				{Function: ollama.ToolCallFunction{Name: "clock", Arguments: ollama.ToolCallFunctionArguments{}}},
+				{Function: ollama.ToolCallFunction{Name: "clock", Arguments: ollama.ToolCallFunctionArguments{}}},
+			}}},
+		},
+		{
+			name: "tool responses",
+			msg: &agent.Message{Role: agent.RoleTool, Parts: []*agent.Part{
+				{ToolResponse: &agent.ToolResponse{ID: "call_0_0", Name: "geocode", Output: map[string]any{"lat": 48.85}}},
+				{ToolResponse: &agent.ToolResponse{ID: "call_0_1", Name: "clock", Output: map[string]any{"time": "12:00"}}},
+			}},
+			expected: []ollama.Message{
+				{Role: "tool", Content: `{"lat":48.85}`, ToolName: "geocode"},
+				{Role: "tool", Content: `{"time":"12:00"}`, ToolName: "clock"},
+			},
+		},
+		{
+			name: "unknown role",
+			msg:  agent.NewTextMessage("developer", "hi"),
+			err:  "unknown message role: developer",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs, err := ollamaMessages(tc.msg)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, msgs)
+		})
+	}
+}
+
+func Test_ollamaToolCalls(t *testing.T) {
+	oa := ollamaServer(t, ollama.ChatResponse{
+		Model: "test-model",
+		Message: ollama.Message{Role: "assistant", ToolCalls: []ollama.ToolCall{
+			{Function: ollama.ToolCallFunction{Name: "geocode", Arguments: ollama.ToolCallFunctionArguments{"city": "Paris"}}},
+			{Function: ollama.ToolCallFunction{Name: "geocode", Arguments: ollama.ToolCallFunctionArguments{"city": "Rome"}}},
+		}},
+		Done:       true,
+		DoneReason: "stop",
+	})
+	res, err := oa.Chat(t.Context(), agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "geocode Paris and Rome")}})
+	require.NoError(t, err)
+	// the ID is left to the agent, the same tool can be called twice.
+	assert.Equal(t, []*agent.ToolCall{
+		{Type: "function", Function: agent.FunctionCall{Name: "geocode", Arguments: `{"city":"Paris"}`}},
+		{Type: "function", Function: agent.FunctionCall{Name: "geocode", Arguments: `{"city":"Rome"}`}},
+	}, res.Choices[0].ToolCalls)
+
+	_, err = oa.Chat(t.Context(), agent.CCReq{Messages: []*agent.Message{
+		{Role: agent.RoleUser, Parts: []*agent.Part{{Blob: &agent.Blob{Bytes: []byte("a,b"), Mime: "text/csv"}}}},
+	}})
+	assert.ErrorContains(t, err, "ollama adapter: unsupported blob mime 'text/csv'")
+}
+
+func Test_ollamaChatParts(t *testing.T) {
+	// the parts are accumulated, not only the last one is kept.
+	oa := ollamaServer(t,
+		ollama.ChatResponse{Model: "test-model", Message: ollama.Message{Role: "assistant", Content: "<think>user "}},
+		ollama.ChatResponse{Model: "test-model", Message: ollama.Message{Role: "assistant", Content: "greets</think>hel"}},
+		ollama.ChatResponse{Model: "test-model", Message: ollama.Message{Role: "assistant", ToolCalls: []ollama.ToolCall{
+			{Function: ollama.ToolCallFunction{Name: "clock", Arguments: ollama.ToolCallFunctionArguments{}}},
+		}}},
+		ollama.ChatResponse{
+			Model:      "test-model",
+			Message:    ollama.Message{Role: "assistant", Content: "lo"},
+			Done:       true,
+			DoneReason: "stop",
+			Metrics:    ollama.Metrics{PromptEvalCount: 12, EvalCount: 5},
+		},
+	)
+	req := agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}}
+
+	res, err := oa.Chat(t.Context(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", res.Choices[0].Text)
+	assert.Equal(t, "user greets", res.Choices[0].Thought)
+	assert.Len(t, res.Choices[0].ToolCalls, 1)
+	assert.Equal(t, "stop", res.Choices[0].FinishReason)
+	assert.Equal(t, agent.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}, res.Usage)
+
+	var text, thought string
+	var calls []*agent.ToolCall
+	for chunk, err := range oa.ChatStream(t.Context(), req) {
+		require.NoError(t, err)
+		text += chunk.Text
+		thought += chunk.Thought
+		calls = append(calls, chunk.ToolCalls...)
+	}
+	assert.Equal(t, "hello", text)
+	assert.Equal(t, "user greets", thought)
+	assert.Len(t, calls, 1)
+}
+
+func Test_ollamaThinkTags(t *testing.T) {
+	testCases := []struct {
+		name    string
+		chunks  []string
+		thought string
+		text    string
+	}{
+		{name: "no tags", chunks: []string{"hel", "lo"}, text: "hello"},
+		{name: "leading space", chunks: []string{"\n", " hello"}, text: "\n hello"},
+		{name: "tags", chunks: []string{"<think>", "\nuser greets\n", "</think>", "\n\nhello"}, thought: "user greets", text: "hello"},
+		{name: "cut tags", chunks: []string{"<th", "ink>user gr", "eets</th", "ink>hel", "lo"}, thought: "user greets", text: "hello"},
+		{name: "not a tag", chunks: []string{"<th", "is>"}, text: "<this>"},
+		{name: "closing look alike", chunks: []string{"<think>a </", "b</think>c"}, thought: "a </b", text: "c"},
+		{name: "unclosed", chunks: []string{"<think>user", " greets</thi"}, thought: "user greets</thi"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tags ollamaThinkTags
+			var thought, text string
+			for _, c := range tc.chunks {
+				th, tx := tags.split(c)
+				thought += th
+				text += tx
+			}
+			th, tx := tags.flush()
+			assert.Equal(t, tc.thought, thought+th)
+			assert.Equal(t, tc.text, text+tx)
+		})
+	}
+}
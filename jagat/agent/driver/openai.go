@@ -1,288 +1,533 @@
 package driver
 
-// import (
-// 	"bytes"
-// 	"context"
-// 	"encoding/json"
-// 	"errors"
-// 	"fmt"
-// 	"io"
-// 	"log/slog"
-// 	"math"
-// 	"math/rand"
-// 	"net/http"
-// 	"net/url"
-// 	"strings"
-// 	"time"
-
-// 	"github.com/odit-bit/jagatai/jagat/agent"
-// )
-
-// const (
-// 	_openai_domain           = "https://api.openai.com"
-// 	_openai_completions_path = "v1/chat/completions"
-// 	_models_path             = "v1/models"
-// )
-
-// const (
-// 	_http_default_max_retry = 2
-// )
-
-// var _ agent.Provider = (*Default)(nil)
-
-// // wrap simple OpenAI compatible api
-// type Default struct {
-// 	model  string
-// 	hc     *http.Client
-// 	apiKey string
-// 	// domain    string
-// 	baseUrl  string
-// 	maxRetry int
-
-// 	config Config
-// }
-
-// func NewOpenAIAdapter(model, key string, config *Config) (agent.Provider, error) {
-// 	if model == "" {
-// 		return nil, fmt.Errorf("openai_adapter model cannot be empty")
-// 	}
-// 	baseUrl, err := url.Parse(config.Endpoint)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("openai_adapter failed parse base url: %w", err)
-// 	}
-// 	baseUrl.Path = ""
-
-// 	return &Default{
-// 		model: model,
-// 		hc:    http.DefaultClient,
-// 		// domain:    _openai_domain,
-// 		apiKey:   key,
-// 		maxRetry: _http_default_max_retry,
-// 		baseUrl:  baseUrl.String(),
-// 		config:   *config,
-// 	}, nil
-// }
-
-// func (d *Default) doRety(req *http.Request) (*http.Response, error) {
-// 	baseDelay := time.Duration(1 * time.Second)
-// 	maxAttempt := d.maxRetry
-
-// 	var errTry error
-// 	for attempt := range maxAttempt {
-// 		res, err := d.hc.Do(req)
-// 		if err == nil && res.StatusCode < 400 {
-// 			return res, nil
-// 		}
-
-// 		switch res.StatusCode {
-// 		case 400, 404:
-// 			return res, fmt.Errorf("driver failed send request status: %v", res.Status)
-// 		}
-
-// 		if res != nil {
-// 			io.Copy(io.Discard, res.Body)
-// 			res.Body.Close()
-// 		}
-// 		// exponential backoff with full jitter
-// 		sleep := time.Duration(float64(baseDelay) * math.Pow(2, float64(attempt)))
-// 		jitter := time.Duration(rand.Int63n(int64(sleep)))
-// 		time.Sleep(jitter)
-// 		slog.Debug("retry", "attempt", attempt, "max", maxAttempt, "status", res.StatusCode, "error", err)
-// 		errTry = err
-// 	}
-
-// 	err1 := fmt.Errorf("api model request error: %v", errTry)
-// 	err2 := fmt.Errorf("max attempt reach")
-// 	errTry = errors.Join(err1, err2)
-
-// 	return nil, errTry
-
-// }
-
-// // chat completions
-// func (d *Default) Chat(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
-
-// 	input := Request{
-// 		Model:       d.model,
-// 		Messages:    toMessages(req.Messages),
-// 		Temperature: *d.config.Temperature,
-// 		TopP:        *d.config.TopP,
-// 		Tools:       req.Tools,
-// 		ToolChoice:  "auto",
-// 	}
-
-// 	b, err := json.Marshal(input)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	endpoint := fmt.Sprintf("%s/%s", d.baseUrl, _openai_completions_path)
-// 	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(b))
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	slog.Debug("provider request", "endpoint", request.URL.String())
-// 	request.Header.Set("Content-Type", "application/json")
-// 	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", d.apiKey))
-
-// 	resp, err := d.doRety(request)
-// 	if err != nil {
-// 		bb, _ := io.ReadAll(resp.Body)
-// 		// jsonData, _ := json.MarshalIndent(req, "", "  ")
-// 		// log.Println(string(jsonData))
-// 		return nil, fmt.Errorf("openai adapter failed get response: %w  message: %s", err, string(bb))
-// 	}
-// 	defer resp.Body.Close()
-
-// 	var out Response
-// 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-// 		return nil, fmt.Errorf("openai_adapter response error: %v", err)
-// 	}
-
-// 	tcalls := []*agent.ToolCall{}
-// 	for _, tc := range out.Choices[0].Message.ToolCalls {
-// 		tcalls = append(tcalls, &agent.ToolCall{
-// 			ID:   tc.ID,
-// 			Type: tc.Type,
-// 			Function: agent.FunctionCall{
-// 				Name:      tc.Function.Name,
-// 				Arguments: tc.Function.Arguments,
-// 			},
-// 		})
-// 	}
-
-// 	// bb, _ := json.MarshalIndent(tcalls, "", " ")
-// 	// log.Println("TOOLCAA:", string(bb))
-
-// 	return &agent.CCRes{
-// 		ID:     out.ID,
-// 		Model:  out.Model,
-// 		Object: out.Model,
-// 		Choices: []agent.Choice{
-// 			{
-// 				Index:        out.Choices[0].Index,
-// 				Text:         *out.Choices[0].Message.Content,
-// 				ToolCalls:    tcalls,
-// 				FinishReason: out.Choices[0].FinishReason,
-// 			},
-// 		},
-// 	}, nil
-
-// }
-
-// type Request struct {
-// 	Model       string       `json:"model"`
-// 	Messages    []Message    `json:"messages"`
-// 	Temperature float32      `json:"temperature,omitempty"`
-// 	TopP        float32      `json:"top_p,omitempty"`
-// 	Tools       []agent.Tool `json:"tools,omitempty"`
-// 	ToolChoice  string       `json:"tool_choice,omitempty"`
-// }
-
-// func toMessages(src []*agent.Message) []Message {
-// 	out := []Message{}
-// 	for _, msg := range src {
-
-// 		out = append(out, Message{
-// 			Role:    string(msg.Role),
-// 			Content: toParts(msg.Parts),
-// 		})
-
-// 	}
-// 	return out
-// }
-
-// func toParts(src []*agent.Part) []Part {
-// 	parts := []Part{}
-// 	for _, in := range src {
-// 		part := Part{}
-// 		topart(in, &part)
-// 		parts = append(parts, part)
-// 	}
-// 	return parts
-// }
-
-// func topart(in *agent.Part, out *Part) {
-// 	// map text
-// 	if in.Text != "" {
-// 		out.Type = "text"
-// 		out.Text = in.Text
-// 		return
-// 	}
-// 	if in.ToolResponse != nil {
-// 		out.Type = "text"
-// 		out.Text = in.ToolResponse.String()
-// 		return
-// 	}
-
-// 	// map blob
-// 	if in.Blob != nil {
-// 		if strings.Contains(in.Blob.Mime, "image") {
-// 			buf := bytes.NewBufferString("data:")
-// 			buf.WriteString(in.Blob.Mime)
-// 			buf.WriteString(";base64,")
-// 			buf.Write(in.Blob.Bytes)
-
-// 			out.Type = "image_url"
-// 			out.ImageURL = &ImageURL{
-// 				URL: buf.String(),
-// 			}
-// 			return
-// 		}
-// 		return
-// 	}
-// }
-
-// type Message struct {
-// 	Role    string `json:"role"`
-// 	Content []Part `json:"content"`
-// }
-
-// type Part struct {
-// 	Type string `json:"type"` // "text" or "image_url"
-
-// 	// Fields for a text block
-// 	Text string `json:"text,omitempty"`
-
-// 	// Fields for an image_url block
-// 	ImageURL *ImageURL `json:"image_url,omitempty"`
-// }
-
-// type ImageURL struct {
-// 	URL string `json:"url"`
-// }
-
-// //------------
-
-// type Response struct {
-// 	ID      string   `json:"id"`
-// 	Object  string   `json:"object"`
-// 	Created int64    `json:"created"`
-// 	Model   string   `json:"model"`
-// 	Choices []Choice `json:"choices"`
-// }
-
-// type Choice struct {
-// 	Index        int          `json:"index"`
-// 	Message      ResMessage   `json:"message"`
-// 	Logprobs     *interface{} `json:"logprobs"` // null or object
-// 	FinishReason string       `json:"finish_reason"`
-// }
-
-// type ResMessage struct {
-// 	Role      string     `json:"role"`
-// 	Content   *string    `json:"content"` // null or string
-// 	ToolCalls []ToolCall `json:"tool_calls"`
-// }
-
-// type ToolCall struct {
-// 	ID       string   `json:"id"`
-// 	Type     string   `json:"type"`
-// 	Function Function `json:"function"`
-// }
-
-// type Function struct {
-// 	Name      string `json:"name"`
-// 	Arguments string `json:"arguments"`
-// }
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+)
+
+// OpenAI Chat Completions compatible, e.g vLLM, llama.cpp server, LM Studio or OpenRouter.
+
+const (
+	_openai_base_url         = "https://api.openai.com/v1"
+	_openai_completions_path = "chat/completions"
+)
+
+var _ agent.StreamingProvider = (*OpenAIAdapter)(nil)
+
+func init() {
+	Register("openai", newOpenAIDriver)
+}
+
+// openai settings of ProviderConfig.Extra.
+type OpenAIExtra struct {
+	// retries of request that failed with 429, 5xx or network error, default 2.
+	MaxRetries *int `json:"maxRetries"`
+	// extra http headers of every request, e.g OpenRouter "HTTP-Referer".
+	Headers map[string]string `json:"headers"`
+}
+
+func newOpenAIDriver(cfg ProviderConfig) (agent.Provider, error) {
+	var extra OpenAIExtra
+	if err := cfg.Decode(&extra); err != nil {
+		return nil, err
+	}
+	conf := cfg.Options
+	conf.Endpoint = cfg.endpoint()
+	oa, err := NewOpenAIAdapter(cfg.Model, cfg.ApiKey, &conf)
+	if err != nil {
+		return nil, err
+	}
+	if extra.MaxRetries != nil {
+		oa.maxRetry = *extra.MaxRetries
+	}
+	oa.headers = extra.Headers
+	return oa, nil
+}
+
+type OpenAIAdapter struct {
+	retryClient
+	model   string
+	apiKey  string
+	baseUrl string
+	headers map[string]string
+
+	conf *Config
+}
+
+// config.Endpoint is the base URL including the version path, e.g "http://localhost:8000/v1".
+func NewOpenAIAdapter(model, key string, config *Config) (*OpenAIAdapter, error) {
+	if model == "" {
+		return nil, fmt.Errorf("openai_adapter model cannot be empty")
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = _openai_base_url
+	}
+	baseUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("openai_adapter failed parse base url: %w", err)
+	}
+	if baseUrl.Scheme == "" || baseUrl.Host == "" {
+		return nil, fmt.Errorf("openai_adapter base url need scheme and host: %s", endpoint)
+	}
+
+	return &OpenAIAdapter{
+		retryClient: newRetryClient("openai_adapter"),
+		model:       model,
+		apiKey:      key,
+		baseUrl:     strings.TrimSuffix(baseUrl.String(), "/"),
+		conf:        config,
+	}, nil
+}
+
+// Chat implements agent.Provider.
+func (oa *OpenAIAdapter) Chat(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+	input, err := oa.request(req, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := oa.do(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out openaiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("openai_adapter failed decode response: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("openai_adapter response has no choices")
+	}
+
+	choice := out.Choices[0]
+	res := &agent.CCRes{
+		ID:     out.ID,
+		Model:  out.Model,
+		Object: out.Object,
+		Choices: []agent.Choice{
+			{
+				Index:        choice.Index,
+				Text:         choice.Message.Content,
+				Thought:      choice.Message.thought(),
+				ToolCalls:    openaiToolCalls(choice.Message.ToolCalls),
+				FinishReason: choice.FinishReason,
+			},
+		},
+	}
+	if out.Created > 0 {
+		res.Created = time.Unix(out.Created, 0)
+	}
+	if out.Usage != nil {
+		res.Usage = out.Usage.usage()
+	}
+	return res, nil
+}
+
+// ChatStream implements agent.StreamingProvider.
+// tool call arguments are streamed in fragments, the calls are only yielded once the choice finished.
+func (oa *OpenAIAdapter) ChatStream(ctx context.Context, req agent.CCReq) iter.Seq2[agent.Chunk, error] {
+	return func(yield func(agent.Chunk, error) bool) {
+		input, err := oa.request(req, true)
+		if err != nil {
+			yield(agent.Chunk{}, err)
+			return
+		}
+		resp, err := oa.do(ctx, input)
+		if err != nil {
+			yield(agent.Chunk{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		calls := &openaiToolCallBuilder{}
+		flushed := false
+		for data, err := range sseData(resp.Body) {
+			if err != nil {
+				yield(agent.Chunk{}, fmt.Errorf("openai_adapter failed read stream: %w", err))
+				return
+			}
+
+			var out openaiResponse
+			if err := json.Unmarshal(data, &out); err != nil {
+				yield(agent.Chunk{}, fmt.Errorf("openai_adapter failed decode stream: %w", err))
+				return
+			}
+			chunk := agent.Chunk{ID: out.ID, Model: out.Model}
+			// usage is sent in the last chunk that has no choice.
+			if out.Usage != nil {
+				usage := out.Usage.usage()
+				chunk.Usage = &usage
+			}
+			if len(out.Choices) > 0 {
+				choice := out.Choices[0]
+				chunk.Text = choice.Delta.Content
+				chunk.Thought = choice.Delta.thought()
+				calls.add(choice.Delta.ToolCalls)
+				if choice.FinishReason != "" {
+					chunk.FinishReason = choice.FinishReason
+					chunk.ToolCalls = calls.build()
+					flushed = true
+				}
+			}
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+
+		// server that close the stream without finish reason.
+		if !flushed {
+			if tcs := calls.build(); len(tcs) > 0 {
+				yield(agent.Chunk{ToolCalls: tcs}, nil)
+			}
+		}
+	}
+}
+
+// send the request, it is retried with exponential backoff on 429, 5xx and network error.
+func (oa *OpenAIAdapter) do(ctx context.Context, input *openaiRequest) (*http.Response, error) {
+	b, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("openai_adapter failed encode request: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/%s", oa.baseUrl, _openai_completions_path)
+
+	return oa.retryClient.do(ctx, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if oa.apiKey != "" {
+			request.Header.Set("Authorization", "Bearer "+oa.apiKey)
+		}
+		for k, v := range oa.headers {
+			request.Header.Set(k, v)
+		}
+		return request, nil
+	})
+}
+
+func (oa *OpenAIAdapter) request(req agent.CCReq, stream bool) (*openaiRequest, error) {
+	msgs := []openaiMessage{}
+	for _, msg := range req.Messages {
+		oMsgs, err := openaiMessages(msg)
+		if err != nil {
+			return nil, fmt.Errorf("openai_adapter failed convert message: %w", err)
+		}
+		msgs = append(msgs, oMsgs...)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("openai_adapter messages is empty")
+	}
+
+	temperature := oa.conf.Temperature
+	if req.Temperature != nil {
+		temperature = req.Temperature
+	}
+	input := &openaiRequest{
+		Model:       oa.model,
+		Messages:    msgs,
+		Temperature: temperature,
+		TopP:        oa.conf.TopP,
+		Stream:      stream,
+	}
+	if stream {
+		input.StreamOptions = &openaiStreamOptions{IncludeUsage: true}
+	}
+	if len(req.Tools) > 0 {
+		for _, t := range req.Tools {
+			t.Function.Parameters = objectSchema(t.Function.Parameters)
+			input.Tools = append(input.Tools, t)
+		}
+		input.ToolChoice = openaiToolChoice(req.ToolChoice)
+	}
+	// the schema only apply to tool-less request, like the other drivers.
+	if req.ResponseSchema != nil && len(req.Tools) == 0 {
+		input.ResponseFormat = &openaiResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &openaiJSONSchema{Name: "response", Schema: req.ResponseSchema},
+		}
+	}
+	if req.Think || oa.conf.Thinking.Enable {
+		input.ReasoningEffort = oa.conf.Thinking.Level
+	}
+	return input, nil
+}
+
+// tool without arguments may leave its schema empty, the API reject it and null properties.
+func objectSchema(ps agent.ParameterSchema) agent.ParameterSchema {
+	if ps.Type == "" {
+		ps.Type = agent.Parameter_Type_Object
+	}
+	if ps.Properties == nil {
+		ps.Properties = map[string]agent.ParameterDefinition{}
+	}
+	return ps
+}
+
+// tool choice is a string, except the named tool that is an object.
+func openaiToolChoice(choice string) any {
+	switch choice {
+	case "":
+		return agent.ToolChoiceAuto
+	case agent.ToolChoiceAuto, agent.ToolChoiceNone, agent.ToolChoiceRequired:
+		return choice
+	default:
+		return map[string]any{"type": "function", "function": map[string]string{"name": choice}}
+	}
+}
+
+// convert the message, tool message become one message per tool response.
+func openaiMessages(msg *agent.Message) ([]openaiMessage, error) {
+	switch msg.Role {
+	case agent.RoleTool:
+		out := []openaiMessage{}
+		for _, p := range msg.Parts {
+			if p.ToolResponse == nil {
+				continue
+			}
+			b, err := json.Marshal(p.ToolResponse.Output)
+			if err != nil {
+				return nil, fmt.Errorf("tool response '%s': %w", p.ToolResponse.Name, err)
+			}
+			out = append(out, openaiMessage{
+				Role:       string(agent.RoleTool),
+				ToolCallID: p.ToolResponse.ID,
+				Name:       p.ToolResponse.Name,
+				Content:    string(b),
+			})
+		}
+		return out, nil
+
+	case agent.RoleAssistant:
+		om := openaiMessage{Role: string(agent.RoleAssistant)}
+		// content is null when the message only has tool calls.
+		if text := msg.Text(); text != "" {
+			om.Content = text
+		}
+		for _, tc := range msg.ToolCalls() {
+			om.ToolCalls = append(om.ToolCalls, openaiToolCall{
+				ID:   tc.ID,
+				Type: "function",
+				Function: openaiFunctionCall{
+					Name:      tc.Function.Name,
+					Arguments: tc.Function.Arguments,
+				},
+			})
+		}
+		return []openaiMessage{om}, nil
+
+	case agent.RoleUser, agent.RoleSystem:
+		parts, err := openaiContentParts(msg.Parts)
+		if err != nil {
+			return nil, err
+		}
+		om := openaiMessage{Role: string(msg.Role), Content: parts}
+		// plain text is sent as string, some compatible servers only accept that.
+		if !slices.ContainsFunc(parts, func(p openaiContentPart) bool { return p.Type != "text" }) {
+			om.Content = msg.Text()
+		}
+		return []openaiMessage{om}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown message role: %v", msg.Role)
+	}
+}
+
+// image blob become base64 data URL, thought part is left out.
+func openaiContentParts(src []*agent.Part) ([]openaiContentPart, error) {
+	parts := []openaiContentPart{}
+	for _, p := range src {
+		switch {
+		case p.Text != "":
+			parts = append(parts, openaiContentPart{Type: "text", Text: p.Text})
+		case p.Blob != nil:
+			if !strings.HasPrefix(p.Blob.Mime, "image/") {
+				return nil, fmt.Errorf("unsupported blob mime '%s', only image is supported", p.Blob.Mime)
+			}
+			dataURL := fmt.Sprintf("data:%s;base64,%s", p.Blob.Mime, base64.StdEncoding.EncodeToString(p.Blob.Bytes))
+			parts = append(parts, openaiContentPart{Type: "image_url", ImageURL: &openaiImageURL{URL: dataURL}})
+		}
+	}
+	return parts, nil
+}
+
+// some compatible servers does not generate the ID, the agent assign one.
+func openaiToolCalls(src []openaiToolCall) []*agent.ToolCall {
+	tcs := []*agent.ToolCall{}
+	for _, tc := range src {
+		tcs = append(tcs, &agent.ToolCall{
+			ID:   tc.ID,
+			Type: "function",
+			Function: agent.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			},
+		})
+	}
+	return tcs
+}
+
+// assemble streamed tool call fragments by their index.
+type openaiToolCallBuilder struct {
+	calls []openaiToolCall
+}
+
+func (b *openaiToolCallBuilder) add(deltas []openaiToolCall) {
+	for _, d := range deltas {
+		i := len(b.calls)
+		if d.Index != nil {
+			i = *d.Index
+		}
+		for len(b.calls) <= i {
+			b.calls = append(b.calls, openaiToolCall{})
+		}
+		tc := &b.calls[i]
+		if d.ID != "" {
+			tc.ID = d.ID
+		}
+		if d.Function.Name != "" {
+			tc.Function.Name = d.Function.Name
+		}
+		tc.Function.Arguments += d.Function.Arguments
+	}
+}
+
+// completed tool calls, the builder is reset.
+func (b *openaiToolCallBuilder) build() []*agent.ToolCall {
+	tcs := openaiToolCalls(b.calls)
+	b.calls = nil
+	return tcs
+}
+
+//------------
+
+type openaiRequest struct {
+	Model           string                `json:"model"`
+	Messages        []openaiMessage       `json:"messages"`
+	Temperature     *float32              `json:"temperature,omitempty"`
+	TopP            *float32              `json:"top_p,omitempty"`
+	Tools           []agent.Tool          `json:"tools,omitempty"`
+	ToolChoice      any                   `json:"tool_choice,omitempty"`
+	ResponseFormat  *openaiResponseFormat `json:"response_format,omitempty"`
+	ReasoningEffort string                `json:"reasoning_effort,omitempty"`
+	Stream          bool                  `json:"stream,omitempty"`
+	StreamOptions   *openaiStreamOptions  `json:"stream_options,omitempty"`
+}
+
+type openaiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openaiResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *openaiJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openaiJSONSchema struct {
+	Name   string                     `json:"name"`
+	Schema *agent.ParameterDefinition `json:"schema"`
+}
+
+type openaiMessage struct {
+	Role string `json:"role"`
+	// string or []openaiContentPart.
+	Content    any              `json:"content"`
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openaiContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openaiImageURL `json:"image_url,omitempty"`
+}
+
+type openaiImageURL struct {
+	URL string `json:"url"`
+}
+
+type openaiToolCall struct {
+	// only set in stream delta.
+	Index    *int               `json:"index,omitempty"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function openaiFunctionCall `json:"function"`
+}
+
+type openaiFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type openaiResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openaiChoice `json:"choices"`
+	Usage   *openaiUsage   `json:"usage"`
+}
+
+type openaiChoice struct {
+	Index        int              `json:"index"`
+	Message      openaiResMessage `json:"message"`
+	Delta        openaiResMessage `json:"delta"`
+	FinishReason string           `json:"finish_reason"`
+}
+
+type openaiResMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []openaiToolCall `json:"tool_calls"`
+	// thinking of reasoning model, the field name differ between servers.
+	ReasoningContent string `json:"reasoning_content"`
+	Reasoning        string `json:"reasoning"`
+}
+
+func (m openaiResMessage) thought() string {
+	if m.ReasoningContent != "" {
+		return m.ReasoningContent
+	}
+	return m.Reasoning
+}
+
+type openaiUsage struct {
+	PromptTokens        int32 `json:"prompt_tokens"`
+	CompletionTokens    int32 `json:"completion_tokens"`
+	TotalTokens         int32 `json:"total_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int32 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails *struct {
+		ReasoningTokens int32 `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+}
+
+func (u *openaiUsage) usage() agent.Usage {
+	usage := agent.Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CachedTokens = u.PromptTokensDetails.CachedTokens
+	}
+	if u.CompletionTokensDetails != nil {
+		usage.ThinkingTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	return usage
+}
@@ -0,0 +1,263 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fake OpenAI server, handler is called for every request to the completions path.
+func openaiServer(t *testing.T, handler http.HandlerFunc) *OpenAIAdapter {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		handler(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	oa, err := NewOpenAIAdapter("test-model", "test-key", &Config{Endpoint: ts.URL + "/v1/"})
+	require.NoError(t, err)
+	oa.retryWait = time.Millisecond
+	return oa
+}
+
+func Test_openaiChat(t *testing.T) {
+	var body map[string]any
+	oa := openaiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		fmt.Fprint(w, `{
+			"id": "chatcmpl-1", "object": "chat.completion", "created": 1700000000, "model": "test-model",
+			"choices": [{"index": 0, "finish_reason": "tool_calls", "message": {
+				"role": "assistant", "content": null, "reasoning_content": "need weather",
+				"tool_calls": [{"id": "call_9", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"Paris\"}"}}]
+			}}],
+			"usage": {"prompt_tokens": 20, "completion_tokens": 8, "total_tokens": 28,
+				"prompt_tokens_details": {"cached_tokens": 4}, "completion_tokens_details": {"reasoning_tokens": 3}}
+		}`)
+	})
+
+	req := agent.CCReq{
+		Messages: []*agent.Message{
+			agent.NewTextMessage(agent.RoleSystem, "be brief"),
+			{Role: agent.RoleUser, Parts: []*agent.Part{{Text: "what is this?"}, {Blob: &agent.Blob{Bytes: []byte("hello"), Mime: "image/png"}}}},
+			{Role: agent.RoleAssistant, Parts: []*agent.Part{{Thought: "look it up"}, {Toolcall: &agent.ToolCall{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "lookup", Arguments: `{}`}}}}},
+			{Role: agent.RoleTool, Parts: []*agent.Part{{ToolResponse: &agent.ToolResponse{ID: "call_1", Name: "lookup", Output: map[string]any{"found": "cat"}}}}},
+		},
+		Tools: []agent.Tool{
+			{Type: "function", Function: agent.Function{Name: "weather", Parameters: agent.ParameterSchema{Type: "object"}}},
+			// tool without arguments may leave the schema empty.
+			{Type: "function", Function: agent.Function{Name: "now"}},
+		},
+		ToolChoice: "weather",
+	}
+	res, err := oa.Chat(t.Context(), req)
+	require.NoError(t, err)
+
+	expectedBody := `{
+		"model": "test-model",
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": [
+				{"type": "text", "text": "what is this?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,aGVsbG8="}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "name": "lookup", "content": "{\"found\":\"cat\"}"}
+		],
+		"tools": [
+			{"type": "function", "function": {"name": "weather", "description": "", "parameters": {"type": "object", "properties": {}}}},
+			{"type": "function", "function": {"name": "now", "description": "", "parameters": {"type": "object", "properties": {}}}}
+		],
+		"tool_choice": {"type": "function", "function": {"name": "weather"}}
+	}`
+	b, _ := json.Marshal(body)
+	assert.JSONEq(t, expectedBody, string(b))
+
+	assert.Equal(t, "chatcmpl-1", res.ID)
+	assert.Equal(t, time.Unix(1700000000, 0), res.Created)
+	require.Len(t, res.Choices, 1)
+	choice := res.Choices[0]
+	assert.Empty(t, choice.Text)
+	assert.Equal(t, "need weather", choice.Thought)
+	assert.Equal(t, "tool_calls", choice.FinishReason)
+	assert.Equal(t, []*agent.ToolCall{{ID: "call_9", Type: "function", Function: agent.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}}, choice.ToolCalls)
+	assert.Equal(t, agent.Usage{PromptTokens: 20, CompletionTokens: 8, TotalTokens: 28, CachedTokens: 4, ThinkingTokens: 3}, res.Usage)
+}
+
+func Test_openaiRequest(t *testing.T) {
+	temperature := float32(0.2)
+	oa, err := NewOpenAIAdapter("test-model", "", &Config{Thinking: ThinkingConfig{Level: ThinkingLow}})
+	require.NoError(t, err)
+	schema := agent.ParameterDefinition{Type: "object"}
+
+	testCases := []struct {
+		name     string
+		req      agent.CCReq
+		expected string
+	}{
+		{
+			name:     "plain text",
+			req:      agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}, Temperature: &temperature},
+			expected: `{"model":"test-model","messages":[{"role":"user","content":"hi"}],"temperature":0.2,"stream":true,"stream_options":{"include_usage":true}}`,
+		},
+		{
+			name:     "response schema and think",
+			req:      agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}, ResponseSchema: &schema, Think: true},
+			expected: `{"model":"test-model","messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_schema","json_schema":{"name":"response","schema":{"type":"object"}}},"reasoning_effort":"low","stream":true,"stream_options":{"include_usage":true}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input, err := oa.request(tc.req, true)
+			require.NoError(t, err)
+			b, err := json.Marshal(input)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(b))
+		})
+	}
+
+	_, err = oa.request(agent.CCReq{Messages: []*agent.Message{
+		{Role: agent.RoleUser, Parts: []*agent.Part{{Blob: &agent.Blob{Bytes: []byte("%PDF"), Mime: "application/pdf"}}}},
+	}}, false)
+	assert.ErrorContains(t, err, "unsupported blob mime 'application/pdf'")
+}
+
+func Test_openaiChatStream(t *testing.T) {
+	oa := openaiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, true, body["stream"])
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range []string{
+			`{"id":"c1","model":"test-model","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me "}}]}`,
+			`{"id":"c1","model":"test-model","choices":[{"index":0,"delta":{"content":"check."}}]}`,
+			`{"id":"c1","model":"test-model","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}]}}]}`,
+			`{"id":"c1","model":"test-model","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+			`{"id":"c1","model":"test-model","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"type":"function","function":{"name":"clock","arguments":"{}"}}]}}]}`,
+			`{"id":"c1","model":"test-model","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+			`{"id":"c1","model":"test-model","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`{"id":"c1","model":"test-model","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":6,"total_tokens":16}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+	})
+
+	req := agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "weather in paris?")}}
+	var text string
+	var calls []*agent.ToolCall
+	var finish string
+	var usage *agent.Usage
+	for chunk, err := range oa.ChatStream(t.Context(), req) {
+		require.NoError(t, err)
+		text += chunk.Text
+		calls = append(calls, chunk.ToolCalls...)
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	assert.Equal(t, "Let me check.", text)
+	assert.Equal(t, "tool_calls", finish)
+	assert.Equal(t, []*agent.ToolCall{
+		{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}},
+		// missing ID is assigned by the agent, unique in the run.
+		{Type: "function", Function: agent.FunctionCall{Name: "clock", Arguments: `{}`}},
+	}, calls)
+	require.NotNil(t, usage)
+	assert.Equal(t, agent.Usage{PromptTokens: 10, CompletionTokens: 6, TotalTokens: 16}, *usage)
+}
+
+func Test_openaiRetry(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		attempts   int32
+		err        string
+	}{
+		{name: "rate limited", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, attempts: 2},
+		{
+			name:       "retry after exceeds max wait",
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter: "86400",
+			attempts:   1,
+			err:        "openai_adapter retry after 24h0m0s exceeds max wait 1m0s: openai_adapter request failed status 429 Too Many Requests: overloaded",
+		},
+		{name: "server error", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, attempts: 3},
+		{
+			name:     "max retry",
+			statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK},
+			attempts: 3,
+			err:      "openai_adapter max attempt reach: openai_adapter request failed status 500 Internal Server Error: overloaded",
+		},
+		{
+			name:     "bad request",
+			statuses: []int{http.StatusBadRequest, http.StatusOK},
+			attempts: 1,
+			err:      "openai_adapter request failed status 400 Bad Request: overloaded",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			oa := openaiServer(t, func(w http.ResponseWriter, r *http.Request) {
+				// every attempt carry the whole body.
+				b, _ := io.ReadAll(r.Body)
+				assert.Contains(t, string(b), `"model":"test-model"`)
+
+				status := tc.statuses[attempts.Add(1)-1]
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(status)
+				if status != http.StatusOK {
+					fmt.Fprint(w, `{"error":{"message":"overloaded"}}`)
+					return
+				}
+				fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]}`)
+			})
+
+			res, err := oa.Chat(t.Context(), agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}})
+			assert.Equal(t, tc.attempts, attempts.Load())
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "hello", res.Choices[0].Text)
+		})
+	}
+}
+
+func Test_openaiDriver(t *testing.T) {
+	var header string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("HTTP-Referer")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ts.Close)
+
+	p, err := New(ProviderConfig{
+		Name:     "openai",
+		Model:    "test-model",
+		Endpoint: ts.URL,
+		Extra:    map[string]any{"maxretries": 0, "headers": map[string]any{"HTTP-Referer": "https://example.com"}},
+	})
+	require.NoError(t, err)
+	_, err = p.Chat(t.Context(), agent.CCReq{Messages: []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}})
+	assert.ErrorContains(t, err, "status 503")
+	assert.Equal(t, "https://example.com", header)
+}
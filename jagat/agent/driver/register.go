@@ -0,0 +1,100 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+)
+
+// managing provider driver life cycle, driver register itself in init
+// and is selected by ProviderConfig.Name, e.g blank import of a package that call Register.
+
+// configuration of the provider passed to the driver.
+type ProviderConfig struct {
+	// name of driver that Register function use for discover.
+	Name  string
+	Model string
+	// secret or api key of the provider.
+	ApiKey string
+	// connection string of the provider, Options.Endpoint takes precedence.
+	Endpoint string
+	// generation options understood by every driver.
+	Options Config
+	// driver specific settings, the driver decode it into its own schema, see Decode.
+	Extra map[string]any
+}
+
+// decode Extra into the driver schema v, a pointer to struct with json tags.
+// key is matched case-insensitively and key that v does not declare is an error.
+func (pc ProviderConfig) Decode(v any) error {
+	if len(pc.Extra) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(pc.Extra)
+	if err != nil {
+		return fmt.Errorf("extra: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("extra: %w", err)
+	}
+	return nil
+}
+
+// connection string of the provider.
+func (pc ProviderConfig) endpoint() string {
+	if pc.Options.Endpoint != "" {
+		return pc.Options.Endpoint
+	}
+	return pc.Endpoint
+}
+
+type ProviderConstructFunc func(cfg ProviderConfig) (agent.Provider, error)
+
+var drivers = make(map[string]ProviderConstructFunc)
+
+var dmutex sync.RWMutex
+
+func Register(name string, fn ProviderConstructFunc) {
+	dmutex.Lock()
+	defer dmutex.Unlock()
+	if fn == nil {
+		panic("driver: Register driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("driver: Register called twice for driver " + name)
+	}
+	drivers[name] = fn
+}
+
+// build the provider with the driver named by cfg.Name.
+func New(cfg ProviderConfig) (agent.Provider, error) {
+	dmutex.RLock()
+	fn, ok := drivers[cfg.Name]
+	dmutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider '%s', registered drivers are %v, forget to import the driver ?", cfg.Name, RegisteredDrivers())
+	}
+	p, err := fn(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("driver '%s': %w", cfg.Name, err)
+	}
+	return p, nil
+}
+
+// RegisteredDrivers returns sorted list of all registered driver names.
+func RegisteredDrivers() []string {
+	dmutex.RLock()
+	defer dmutex.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	model string
+	extra fakeExtra
+}
+
+type fakeExtra struct {
+	Region  string `json:"region"`
+	Retries int    `json:"retries"`
+}
+
+func (fp *fakeProvider) Chat(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+	return &agent.CCRes{Model: fp.model}, nil
+}
+
+func Test_Register(t *testing.T) {
+	Register("fake", func(cfg ProviderConfig) (agent.Provider, error) {
+		fp := &fakeProvider{model: cfg.Model}
+		if err := cfg.Decode(&fp.extra); err != nil {
+			return nil, err
+		}
+		return fp, nil
+	})
+	assert.Contains(t, RegisteredDrivers(), "fake")
+	assert.Contains(t, RegisteredDrivers(), "ollama")
+	assert.Contains(t, RegisteredDrivers(), "genai")
+	assert.Panics(t, func() { Register("fake", newOllamaDriver) })
+
+	testCases := []struct {
+		name     string
+		cfg      ProviderConfig
+		expected fakeExtra
+		err      string
+	}{
+		{name: "no extra", cfg: ProviderConfig{Name: "fake", Model: "m"}},
+		{
+			// key is matched case-insensitively, viper lowercase the yaml keys.
+			name:     "extra",
+			cfg:      ProviderConfig{Name: "fake", Model: "m", Extra: map[string]any{"Region": "eu", "retries": 3}},
+			expected: fakeExtra{Region: "eu", Retries: 3},
+		},
+		{name: "unknown key", cfg: ProviderConfig{Name: "fake", Extra: map[string]any{"zone": "a"}}, err: `driver 'fake': extra: json: unknown field "zone"`},
+		{name: "wrong type", cfg: ProviderConfig{Name: "fake", Extra: map[string]any{"retries": "3"}}, err: "cannot unmarshal string"},
+		{name: "unknown driver", cfg: ProviderConfig{Name: "acme"}, err: "unknown provider 'acme'"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := New(tc.cfg)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			fp, ok := p.(*fakeProvider)
+			require.True(t, ok)
+			assert.Equal(t, tc.cfg.Model, fp.model)
+			assert.Equal(t, tc.expected, fp.extra)
+		})
+	}
+}
+
+func Test_builtinDrivers(t *testing.T) {
+	p, err := New(ProviderConfig{Name: "ollama", Model: "m", Extra: map[string]any{"keepalive": "10m"}})
+	require.NoError(t, err)
+	oa, ok := p.(*OllamaAPI)
+	require.True(t, ok)
+	require.NotNil(t, oa.keepAlive)
+	assert.Equal(t, 10*time.Minute, oa.keepAlive.Duration)
+	oReq, err := oa.request(agent.CCReq{}, false)
+	require.NoError(t, err)
+	assert.Equal(t, oa.keepAlive, oReq.KeepAlive)
+
+	_, err = New(ProviderConfig{Name: "genai", Model: "m", ApiKey: "key", Extra: map[string]any{"backend": "azure"}})
+	assert.ErrorContains(t, err, "unknown genai backend: azure")
+}
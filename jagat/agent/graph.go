@@ -2,8 +2,14 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -11,9 +17,10 @@ import (
 )
 
 var (
-	tracer      = otel.Tracer("jagat.agent.graph")
-	meter       = otel.Meter("jagat.agent.graph")
-	toolCounter metric.Int64Counter
+	tracer       = otel.Tracer("jagat.agent.graph")
+	meter        = otel.Meter("jagat.agent.graph")
+	toolCounter  metric.Int64Counter
+	tokenCounter metric.Int64Counter
 )
 
 // We use it here to create our counter metric so it's ready when needed.
@@ -28,149 +35,699 @@ func init() {
 		// If we can't create the metric, the application can't start correctly.
 		panic(err)
 	}
+	tokenCounter, err = meter.Int64Counter(
+		"agent.tokens",
+		metric.WithDescription("Counts the tokens used by provider, by token type."),
+		metric.WithUnit("{token}"),
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// record provider usage, cached and thinking tokens are part of prompt and completion tokens.
+func recordUsage(ctx context.Context, model string, u Usage) {
+	for typ, n := range map[string]int32{
+		"prompt":     u.PromptTokens,
+		"completion": u.CompletionTokens,
+		"cached":     u.CachedTokens,
+		"thinking":   u.ThinkingTokens,
+	} {
+		if n > 0 {
+			tokenCounter.Add(ctx, int64(n), metric.WithAttributes(
+				attribute.String("token.type", typ),
+				attribute.String("model", model),
+			))
+		}
+	}
 }
 
 // represent state that exchange between node.
 type State struct {
+	// identify the run for checkpoint.
+	RunID   string
 	Message []*Message
+	// number of node executed.
+	Steps int
+	// number of tool calls executed by tool name.
+	ToolCalls map[string]int
+	// number of tool calls rejected by argument validation, by tool name.
+	InvalidCalls map[string]int
+	// human decision of tool calls that need approval, keyed by ToolCall.ID.
+	Approvals map[string]Approval
+	// number of messages given by the caller, later messages are produced by the run.
+	Input int
+	// model and finish reason of the last provider response.
+	Model        string
+	FinishReason string
+	// token usage summed over provider responses.
+	Usage Usage
+	// execution time of each node, in order.
+	Timings []StepTiming
+	// final answer parsed by OutputNode, it match the response schema.
+	Output json.RawMessage
+	// options the run is started with, the graph is built from it again when the run is resumed.
+	Options *CompletionOptions
+}
+
+// execution time of single node.
+type StepTiming struct {
+	Node     string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// modify state of paused run before it is resumed.
+type StateUpdate func(state *State) error
+
+// returned by node to pause the run, the run is resumed from the same node.
+type Interrupt struct {
+	RunID string
+	// node that pause the run.
+	Node string
+	// describe why the run is paused, e.g *PendingApproval
+	Value any
+}
+
+func (i *Interrupt) Error() string {
+	return fmt.Sprintf("run '%s' is paused by node '%s'", i.RunID, i.Node)
 }
 
 // node is the unit of execution in the graph
 type Node interface {
 	// processing state and generate new state.
-	Execute(ctx context.Context, state State) (next string, newState State, err error)
-	// the name of the node, it will use by graph to determine which node is next.
+	Execute(ctx context.Context, state State) (newState State, err error)
+	// the name of the node, it is use by edges to refer the node.
 	Name() string
 }
 
+// decide the next node from the state produced by the node.
+type RouterFunc func(state State) string
+
+// pseudo node name, routing to End finish the run.
+const End = "end"
+
+// outgoing route of a node, it either static (to) or conditional (route).
+type edge struct {
+	to    string
+	route RouterFunc
+	// every possible result of route, it is use to validate the graph.
+	targets []string
+}
+
+func (e edge) destinations() []string {
+	if e.route != nil {
+		return e.targets
+	}
+	return []string{e.to}
+}
+
+// time given to the final node to answer after the run timeout is hit.
+const finalNodeTimeout = 30 * time.Second
+
 // graph holds node and manage execution flow
 type Graph struct {
 	nodes map[string]Node
+	edges map[string]edge
+	// node where the run start.
+	entry string
+	// node that finish the run after executed.
+	terminals map[string]bool
+	built     bool
+
+	budget Budget
+	// node that produce the answer when budget is exceeded.
+	final Node
+
+	checkpointer Checkpointer
 }
 
 func NewGraph() *Graph {
 	return &Graph{
-		nodes: map[string]Node{},
+		nodes:     map[string]Node{},
+		edges:     map[string]edge{},
+		terminals: map[string]bool{},
 	}
 }
 
 func (g *Graph) AddNode(node Node) {
 	g.nodes[node.Name()] = node
+	g.built = false
 }
 
-// running execution
-func (g *Graph) Run(ctx context.Context, entrypoint string, initState State) (*Message, error) {
-	currentNode, ok := g.nodes[entrypoint]
-	if !ok {
-		return nil, fmt.Errorf("entrypoint node '%s' not found", entrypoint)
+// route from node to another node after it executed.
+// it replace previous edge of from.
+func (g *Graph) AddEdge(from, to string) {
+	g.edges[from] = edge{to: to}
+	g.built = false
+}
+
+// route from node to the node returned by route after it executed.
+// targets list every node route may return, it replace previous edge of from.
+func (g *Graph) AddConditionalEdge(from string, route RouterFunc, targets ...string) {
+	g.edges[from] = edge{route: route, targets: targets}
+	g.built = false
+}
+
+// set the node where the run start.
+func (g *Graph) SetEntryPoint(name string) {
+	g.entry = name
+	g.built = false
+}
+
+// mark nodes as terminal, the run finish after one of them executed.
+func (g *Graph) SetFinishPoint(names ...string) {
+	for _, name := range names {
+		g.terminals[name] = true
+	}
+	g.built = false
+}
+
+// limit the run with budget, when it is exceeded the final node is executed to produce the answer.
+// if final is nil the run return ErrBudgetExceeded.
+func (g *Graph) SetBudget(budget Budget, final Node) {
+	g.budget = budget
+	g.final = final
+}
+
+// save checkpoint after every node execution, see Resume.
+func (g *Graph) SetCheckpointer(cp Checkpointer) {
+	g.checkpointer = cp
+}
+
+// validate the graph structure, it must be called before Run.
+// every edge must point to known node, every node must be reachable from entry point
+// and every non terminal node must have outgoing edge.
+func (g *Graph) Build() error {
+	if _, ok := g.nodes[g.entry]; !ok {
+		return fmt.Errorf("graph entry point '%s' not found", g.entry)
+	}
+
+	for from, e := range g.edges {
+		if _, ok := g.nodes[from]; !ok {
+			return fmt.Errorf("graph edge from unknown node '%s'", from)
+		}
+		if g.terminals[from] {
+			return fmt.Errorf("graph terminal node '%s' cannot have outgoing edge", from)
+		}
+		if e.route != nil && len(e.targets) == 0 {
+			return fmt.Errorf("graph conditional edge from '%s' has no targets", from)
+		}
+		for _, to := range e.destinations() {
+			if _, ok := g.nodes[to]; !ok && to != End {
+				return fmt.Errorf("graph edge from '%s' to unknown node '%s'", from, to)
+			}
+		}
+	}
+
+	for name := range g.terminals {
+		if _, ok := g.nodes[name]; !ok {
+			return fmt.Errorf("graph terminal node '%s' not found", name)
+		}
+	}
+
+	for name := range g.nodes {
+		if _, ok := g.edges[name]; !ok && !g.terminals[name] {
+			return fmt.Errorf("graph node '%s' is dangling, it has no edge and not terminal", name)
+		}
+	}
+
+	// walk from entry point to find unreachable node.
+	reached := map[string]bool{g.entry: true}
+	queue := []string{g.entry}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, to := range g.edges[name].destinations() {
+			if to == End || reached[to] {
+				continue
+			}
+			reached[to] = true
+			queue = append(queue, to)
+		}
+	}
+	for name := range g.nodes {
+		if !reached[name] {
+			return fmt.Errorf("graph node '%s' is unreachable from entry point '%s'", name, g.entry)
+		}
+	}
+
+	g.built = true
+	return nil
+}
+
+// return the node after from, End if the run should finish.
+func (g *Graph) next(from string, state State) (string, error) {
+	if g.terminals[from] {
+		return End, nil
+	}
+	e := g.edges[from]
+	if e.route == nil {
+		return e.to, nil
+	}
+	to := e.route(state)
+	if !slices.Contains(e.targets, to) {
+		return "", fmt.Errorf("node '%s' routed to undeclared target '%s'", from, to)
+	}
+	return to, nil
+}
+
+// running execution from entry point.
+// if checkpointer is set and state has no RunID, new one is generated.
+func (g *Graph) Run(ctx context.Context, initState State) (*Message, error) {
+	state, err := g.runState(ctx, initState)
+	if err != nil {
+		return nil, err
+	}
+	return state.lastMessage(), nil
+}
+
+func (g *Graph) runState(ctx context.Context, initState State) (State, error) {
+	if !g.built {
+		return initState, fmt.Errorf("graph is not built")
+	}
+	if g.checkpointer != nil && initState.RunID == "" {
+		initState.RunID = NewRunID()
+	}
+	// the run can be resumed even if the first node failed.
+	if err := g.saveCheckpoint(ctx, g.entry, initState); err != nil {
+		return initState, err
+	}
+	return g.run(ctx, g.entry, initState)
+}
+
+// continue the run from its last checkpoint.
+// the node that failed or paused is executed again, node that already finished is not.
+func (g *Graph) Resume(ctx context.Context, runID string, updates ...StateUpdate) (*Message, error) {
+	state, err := g.resumeState(ctx, runID, updates...)
+	if err != nil {
+		return nil, err
+	}
+	return state.lastMessage(), nil
+}
+
+func (g *Graph) resumeState(ctx context.Context, runID string, updates ...StateUpdate) (State, error) {
+	if !g.built {
+		return State{}, fmt.Errorf("graph is not built")
+	}
+	if g.checkpointer == nil {
+		return State{}, fmt.Errorf("graph has no checkpointer")
+	}
+	cp, err := g.checkpointer.Load(ctx, runID)
+	if err != nil {
+		return State{}, fmt.Errorf("failed load checkpoint '%s': %w", runID, err)
+	}
+	if _, ok := g.nodes[cp.Next]; !ok {
+		return State{}, fmt.Errorf("checkpoint next node '%s' not found", cp.Next)
+	}
+	cp.State.RunID = runID
+	for _, update := range updates {
+		if err := update(&cp.State); err != nil {
+			return State{}, fmt.Errorf("failed update state of run '%s': %w", runID, err)
+		}
+	}
+	return g.run(ctx, cp.Next, cp.State)
+}
+
+func (s State) lastMessage() *Message {
+	return s.Message[len(s.Message)-1]
+}
+
+func (g *Graph) run(ctx context.Context, start string, initState State) (State, error) {
+	currentNode := g.nodes[start]
+
+	// every event of this run carry the run ID.
+	if fn, ok := emitterFrom(ctx); ok {
+		ctx = WithEmitter(ctx, func(ev Event) {
+			ev.RunID = initState.RunID
+			fn(ev)
+		})
+	}
+
+	parentCtx := ctx
+	if g.budget.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.budget.Timeout)
+		defer cancel()
 	}
 
-	var nextNodeName string
 	currentState := initState
+	if currentState.ToolCalls == nil {
+		currentState.ToolCalls = map[string]int{}
+	}
 	for {
-		next, newState, err := currentNode.Execute(ctx, currentState)
+		if err := g.budget.checkStep(currentState); err != nil {
+			return g.exceeded(parentCtx, currentState, err)
+		}
+
+		Emit(ctx, Event{Type: EventNodeStart, Node: currentNode.Name()})
+		started := time.Now()
+		newState, err := currentNode.Execute(ctx, currentState)
+		var interrupt *Interrupt
+		if errors.As(err, &interrupt) {
+			return currentState, g.interrupt(ctx, currentNode.Name(), currentState, interrupt)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed executing node '%s' : %w", currentNode.Name(), err)
+			// the run timeout is hit but the caller still waiting for answer.
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && parentCtx.Err() == nil {
+				exceedErr := &ErrBudgetExceeded{Limit: LimitTimeout, Detail: fmt.Sprintf("timeout %s", g.budget.Timeout)}
+				return g.exceeded(parentCtx, currentState, exceedErr)
+			}
+			return currentState, fmt.Errorf("failed executing node '%s' : %w", currentNode.Name(), err)
 		}
+		Emit(ctx, Event{Type: EventNodeEnd, Node: currentNode.Name()})
+		newState.Timings = append(newState.Timings, StepTiming{Node: currentNode.Name(), Start: started, Duration: time.Since(started)})
 
-		nextNodeName = next
+		// only message appended by this node is new.
+		produced := len(newState.Message) > len(currentState.Message)
 		currentState = newState
+		currentState.Steps++
+
+		nextNodeName, err := g.next(currentNode.Name(), currentState)
+		if err != nil {
+			return currentState, err
+		}
+
+		// the graph execution ends when it routed to End
+		if nextNodeName == End {
+			g.deleteCheckpoint(ctx, currentState)
+			return currentState, nil
+		}
 
-		// the graph execution ends when it return empty string for next node
-		if nextNodeName == "" || nextNodeName == "end" {
-			finalMessage := currentState.Message[len(currentState.Message)-1]
-			return finalMessage, nil
+		// tool calls requested by the node are counted before it is executed.
+		pending := currentState.Message[len(currentState.Message)-1].ToolCalls()
+		if produced && len(pending) > 0 {
+			if err := g.budget.checkToolCalls(currentState, pending); err != nil {
+				return g.exceeded(parentCtx, currentState, err)
+			}
+			for _, tc := range pending {
+				currentState.ToolCalls[tc.Function.Name]++
+			}
 		}
 
-		// next node
-		nextNode, ok := g.nodes[nextNodeName]
-		if !ok {
-			return nil, fmt.Errorf("next node '%s' is not found", nextNodeName)
+		if err := g.saveCheckpoint(ctx, nextNodeName, currentState); err != nil {
+			return currentState, err
+		}
+		currentNode = g.nodes[nextNodeName]
+	}
+}
+
+// save the state so the paused node is executed again when the run is resumed.
+func (g *Graph) interrupt(ctx context.Context, node string, state State, interrupt *Interrupt) error {
+	if g.checkpointer == nil {
+		return fmt.Errorf("node '%s' cannot pause the run without checkpointer", node)
+	}
+	interrupt.RunID = state.RunID
+	interrupt.Node = node
+	if err := g.saveCheckpoint(ctx, node, state); err != nil {
+		return err
+	}
+	return interrupt
+}
+
+func (g *Graph) saveCheckpoint(ctx context.Context, next string, state State) error {
+	if g.checkpointer == nil {
+		return nil
+	}
+	err := g.checkpointer.Save(ctx, &Checkpoint{
+		RunID:   state.RunID,
+		Next:    next,
+		State:   state,
+		Updated: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed save checkpoint '%s': %w", state.RunID, err)
+	}
+	return nil
+}
+
+// finished run does not need to be resumed.
+func (g *Graph) deleteCheckpoint(ctx context.Context, state State) {
+	if g.checkpointer == nil {
+		return
+	}
+	if err := g.checkpointer.Delete(ctx, state.RunID); err != nil {
+		slog.Warn("failed delete checkpoint", "run_id", state.RunID, "error", err)
+	}
+}
+
+// produce the answer with final node after budget is exceeded.
+func (g *Graph) exceeded(ctx context.Context, state State, exceedErr error) (State, error) {
+	slog.Debug("graph_budget_exceeded", "error", exceedErr)
+	if g.final == nil {
+		return state, exceedErr
+	}
+
+	// the final node run with its own time, the run timeout may already be hit.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finalNodeTimeout)
+	defer cancel()
+
+	// every tool call must have response, answer pending calls with the budget error.
+	lastMsg := state.lastMessage()
+	if pending := lastMsg.ToolCalls(); len(pending) > 0 {
+		toolRespMsg := &Message{Role: RoleTool}
+		for _, tc := range pending {
+			toolRespMsg.Parts = append(toolRespMsg.Parts, &Part{ToolResponse: errToolResponse(tc, exceedErr)})
 		}
-		currentNode = nextNode
+		state.Message = append(state.Message, toolRespMsg)
 	}
+
+	started := time.Now()
+	newState, err := g.final.Execute(ctx, state)
+	if err != nil {
+		return state, fmt.Errorf("%w, final node '%s' failed: %v", exceedErr, g.final.Name(), err)
+	}
+	newState.Timings = append(newState.Timings, StepTiming{Node: g.final.Name(), Start: started, Duration: time.Since(started)})
+
+	if len(newState.lastMessage().ToolCalls()) > 0 {
+		state.Usage = newState.Usage
+		return state, exceedErr
+	}
+	g.deleteCheckpoint(ctx, newState)
+	return newState, nil
 }
 
-// represent a single tool call.
+const (
+	// name of the node that talk to the provider.
+	AgentNodeName = "agent"
+	// name of the node that execute tool calls requested by the provider.
+	ToolNodeName = "tools"
+)
+
+// default number of tool calls ToolNode execute at the same time.
+const defaultToolConcurrency = 4
+
+// default number of retries the model get after a tool call with invalid arguments.
+const defaultArgumentRetries = 2
+
+// execute every tool call from the last assistant message concurrently.
 type ToolNode struct {
-	tp ToolProvider
+	tools Tools
+	// maximum number of tool calls running at the same time.
+	concurrency int
+	// retries of each tool after its arguments are invalid, the tool is refused afterward.
+	argumentRetries int
 }
 
-func NewToolNode(tool ToolProvider) *ToolNode {
+func NewToolNode(tools Tools, concurrency int) *ToolNode {
+	if concurrency <= 0 {
+		concurrency = defaultToolConcurrency
+	}
 	return &ToolNode{
-		tp: tool,
+		tools:           tools,
+		concurrency:     concurrency,
+		argumentRetries: defaultArgumentRetries,
+	}
+}
+
+// set how many times the model may retry a tool after calling it with invalid arguments,
+// 0 refuse the tool after the first invalid call, negative keep the default.
+func (tn *ToolNode) SetArgumentRetries(n int) {
+	if n >= 0 {
+		tn.argumentRetries = n
 	}
 }
 
 func (tn *ToolNode) Name() string {
-	return tn.tp.Def().Function.Name
+	return ToolNodeName
 }
 
-func (tn *ToolNode) Execute(ctx context.Context, state State) (string, State, error) {
+func (tn *ToolNode) Execute(ctx context.Context, state State) (State, error) {
 	//start new span
 	ctx, span := tracer.Start(ctx, "ToolNode.Execute")
 	defer span.End()
 
-	span.SetAttributes(attribute.String("tool.name", tn.Name()))
-
 	lastMsg := state.Message[len(state.Message)-1]
+	toolCalls := lastMsg.ToolCalls()
+	if len(toolCalls) == 0 {
+		return state, fmt.Errorf("expected a tool call, but found none in the last message")
+	}
+	span.SetAttributes(attribute.Int("tool.calls", len(toolCalls)))
+
+	// usage of tools that call provider, e.g sub agent.
+	rec := &usageRecorder{}
+	ctx = context.WithValue(ctx, usageKey{}, rec)
+
+	// each goroutine only write into its own index, the order of response follow the order of call.
+	responses := make([]*ToolResponse, len(toolCalls))
+	sem := make(chan struct{}, tn.concurrency)
+	var wg sync.WaitGroup
+	for i, tc := range toolCalls {
+		// invalid arguments is answered without invoking the tool.
+		if resp := tn.checkArguments(tc, &state); resp != nil {
+			responses[i] = resp
+			Emit(ctx, Event{Type: EventToolResult, Node: ToolNodeName, ToolCall: tc, ToolResponse: resp})
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				responses[i] = errToolResponse(tc, ctx.Err())
+				return
+			}
+			responses[i] = tn.call(ctx, tc, state.Approvals)
+			Emit(ctx, Event{Type: EventToolResult, Node: ToolNodeName, ToolCall: tc, ToolResponse: responses[i]})
+		}()
+	}
+	wg.Wait()
 
-	var toolResp *ToolResponse
-	var err error
-
-	tc, hasToolCall := lastMsg.ToolCall()
-	if !hasToolCall {
-		return "", state, fmt.Errorf("expected a tool call, but found none in the last message")
+	toolRespMsg := &Message{Role: RoleTool}
+	for _, resp := range responses {
+		toolRespMsg.Parts = append(toolRespMsg.Parts, &Part{ToolResponse: resp})
 	}
-	if tc.Function.Name != tn.Name() {
-		return "", state, fmt.Errorf("routing error, expected tool call for '%s', but got '%s'", tn.Name(), tc.Function.Name)
+	state.Message = append(state.Message, toolRespMsg)
+	state.Usage = state.Usage.Add(rec.usage)
+
+	// decision apply to single call, a later call with the same ID need its own.
+	if len(state.Approvals) > 0 {
+		state.Approvals = maps.Clone(state.Approvals)
+		for _, tc := range toolCalls {
+			delete(state.Approvals, tc.ID)
+		}
 	}
 
-	toolCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("tool.name", tn.Name())))
+	return state, nil
+}
+
+// invoke single tool call, error is reported back to the model as tool response.
+func (tn *ToolNode) call(ctx context.Context, tc *ToolCall, approvals map[string]Approval) *ToolResponse {
+	ctx, span := tracer.Start(ctx, "ToolNode.call")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("tool.name", tc.Function.Name),
+		attribute.String("tool.call_id", tc.ID),
+	)
 
-	toolResp, err = tn.tp.Call(ctx, tc.Function)
-	if err != nil {
-		toolResp = &ToolResponse{
-			Name:   tn.Name(),
-			Output: map[string]any{"error": err.Error()},
+	if approval, ok := approvals[tc.ID]; ok && approval.Action == ApprovalReject {
+		return &ToolResponse{
+			ID:     tc.ID,
+			Name:   tc.Function.Name,
+			Output: map[string]any{"error": "tool call is rejected by user", "reason": approval.Reason},
 		}
 	}
-	slog.Debug("graph_nodes_tool", "response", toolResp)
 
+	tp, ok := tn.tools.Get(tc.Function.Name)
+	if !ok {
+		return errToolResponse(tc, fmt.Errorf("tool '%s' is not available", tc.Function.Name))
+	}
+
+	toolCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("tool.name", tc.Function.Name)))
+
+	toolResp, err := tp.Call(ctx, tc.Function)
+	if err != nil {
+		toolResp = errToolResponse(tc, err)
+	}
 	if toolResp == nil {
-		return "", state, fmt.Errorf("tool response is empty '%s'", tn.Name())
+		toolResp = errToolResponse(tc, fmt.Errorf("tool response is empty"))
 	}
+	slog.Debug("graph_nodes_tool", "id", tc.ID, "response", toolResp)
 
-	toolRespMsg := &Message{
-		Role: RoleTool,
-		Parts: []*Part{
-			{ToolResponse: toolResp},
-		},
+	// the response must be matched to the call that produce it.
+	toolResp.ID = tc.ID
+	if toolResp.Name == "" {
+		toolResp.Name = tc.Function.Name
 	}
-	state.Message = append(state.Message, toolRespMsg)
+	return toolResp
+}
+
+// validate the call arguments against the tool schema, the returned response tell the model what to fix.
+// after too many invalid calls the tool is refused for the rest of the run.
+func (tn *ToolNode) checkArguments(tc *ToolCall, state *State) *ToolResponse {
+	if approval, ok := state.Approvals[tc.ID]; ok && approval.Action == ApprovalReject {
+		return nil
+	}
+	tp, ok := tn.tools.Get(tc.Function.Name)
+	if !ok {
+		return nil
+	}
+
+	name := tc.Function.Name
+	if state.InvalidCalls[name] > tn.argumentRetries {
+		return errToolResponse(tc, fmt.Errorf("tool '%s' is not available anymore after %d calls with invalid arguments", name, state.InvalidCalls[name]))
+	}
+
+	err := tp.Def().Function.ValidateArguments(tc.Function.Arguments)
+	var argErr *ArgumentError
+	if !errors.As(err, &argErr) {
+		return nil
+	}
+
+	if state.InvalidCalls == nil {
+		state.InvalidCalls = map[string]int{}
+	}
+	state.InvalidCalls[name]++
+	retries := tn.argumentRetries - state.InvalidCalls[name] + 1
+	output := map[string]any{
+		"error":    "invalid arguments",
+		"problems": argErr.Problems,
+	}
+	if retries > 0 {
+		output["retries_left"] = retries
+	} else {
+		output["error"] = "invalid arguments, retry limit is reached, do not call this tool again"
+	}
+	return &ToolResponse{ID: tc.ID, Name: name, Output: output}
+}
 
-	return "agent", state, nil
+func errToolResponse(tc *ToolCall, err error) *ToolResponse {
+	return &ToolResponse{
+		ID:     tc.ID,
+		Name:   tc.Function.Name,
+		Output: map[string]any{"error": err.Error()},
+	}
 }
 
 type AgentNode struct {
-	provider Provider
-	tools    []Tool
+	provider       Provider
+	tools          []Tool
+	toolChoice     string
+	think          bool
+	temperature    *float32
+	responseSchema *ParameterDefinition
 }
 
 func (an *AgentNode) Name() string {
-	return "agent"
+	return AgentNodeName
 }
 
-func (an *AgentNode) Execute(ctx context.Context, state State) (string, State, error) {
+func (an *AgentNode) Execute(ctx context.Context, state State) (State, error) {
 	ctx, span := tracer.Start(ctx, "AgentNode.Execute")
 	defer span.End()
 
-	resp, err := an.provider.Chat(ctx, CCReq{
-		Messages: state.Message,
-		Tools:    an.tools,
+	resp, err := an.chat(ctx, CCReq{
+		Messages:       state.Message,
+		Tools:          an.tools,
+		ToolChoice:     an.choice(state),
+		Think:          an.think,
+		Temperature:    an.temperature,
+		ResponseSchema: an.responseSchema,
 	})
 	if err != nil {
-		return "", state, err
+		return state, err
 	}
 
 	modelMsg := Message{
@@ -184,17 +741,76 @@ func (an *AgentNode) Execute(ctx context.Context, state State) (string, State, e
 	if hasToolCall {
 		// clear the text part for tool call
 		modelMsg.Parts = []*Part{}
-		for _, tc := range toolCalls {
+		for i, tc := range toolCalls {
+			// tool response and approval are matched by ID, some provider does not generate it.
+			if tc.ID == "" {
+				tc.ID = fmt.Sprintf("call_%d_%d", state.Steps, i)
+			}
 			modelMsg.Parts = append(modelMsg.Parts, &Part{Toolcall: tc})
+			Emit(ctx, Event{Type: EventToolCall, Node: an.Name(), ToolCall: tc})
 		}
 
 	}
 
+	// thinking is kept apart from the answer, before it like the model produced it.
+	// empty answer text beside the thinking is dropped, each part must have one field.
+	if thought := resp.Choices[0].Thought; thought != "" {
+		if !hasToolCall && resp.Choices[0].Text == "" {
+			modelMsg.Parts = nil
+		}
+		modelMsg.Parts = append([]*Part{{Thought: thought}}, modelMsg.Parts...)
+	}
+
 	state.Message = append(state.Message, &modelMsg)
+	state.Model = resp.Model
+	state.FinishReason = resp.Choices[0].FinishReason
+	state.Usage = state.Usage.Add(resp.Usage)
+	recordUsage(ctx, resp.Model, resp.Usage)
+	span.SetAttributes(
+		attribute.Int("usage.prompt_tokens", int(resp.Usage.PromptTokens)),
+		attribute.Int("usage.completion_tokens", int(resp.Usage.CompletionTokens)),
+	)
 
-	if hasToolCall {
-		return toolCalls[0].Function.Name, state, nil
+	return state, nil
+}
+
+// required and named tool choice is forced until the run has tool result, otherwise the model could never answer.
+func (an *AgentNode) choice(state State) string {
+	switch an.toolChoice {
+	case "", ToolChoiceAuto, ToolChoiceNone:
+		return an.toolChoice
 	}
+	for _, msg := range state.Message[min(state.Input, len(state.Message)):] {
+		if msg.Role == RoleTool {
+			return ToolChoiceAuto
+		}
+	}
+	return an.toolChoice
+}
+
+// use streaming if the run has emitter and provider support it, so text is emitted as it generated.
+func (an *AgentNode) chat(ctx context.Context, req CCReq) (*CCRes, error) {
+	sp, ok := an.provider.(StreamingProvider)
+	if _, hasEmitter := emitterFrom(ctx); !ok || !hasEmitter {
+		return an.provider.Chat(ctx, req)
+	}
+
+	req.Stream = true
+	return collectStream(sp.ChatStream(ctx, req), func(c Chunk) {
+		if c.Thought != "" {
+			Emit(ctx, Event{Type: EventThoughtDelta, Node: an.Name(), Text: c.Thought})
+		}
+		if c.Text != "" {
+			Emit(ctx, Event{Type: EventTextDelta, Node: an.Name(), Text: c.Text})
+		}
+	})
+}
 
-	return "end", state, nil
+// route to tool node if the last message has tool calls, otherwise finish the run.
+func RouteToolCalls(state State) string {
+	lastMsg := state.Message[len(state.Message)-1]
+	if len(lastMsg.ToolCalls()) > 0 {
+		return ToolNodeName
+	}
+	return End
 }
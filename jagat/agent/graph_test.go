@@ -0,0 +1,156 @@
+package agent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// append text message with its name.
+type textNode struct {
+	name string
+}
+
+func (n *textNode) Name() string {
+	return n.name
+}
+
+func (n *textNode) Execute(ctx context.Context, state agent.State) (agent.State, error) {
+	state.Message = append(state.Message, agent.NewTextMessage(agent.RoleAssistant, n.name))
+	return state, nil
+}
+
+func TestGraph_Build(t *testing.T) {
+	route := func(agent.State) string { return agent.End }
+
+	testCases := []struct {
+		name          string
+		setup         func(g *agent.Graph)
+		expectedError string
+	}{
+		{
+			name: "valid graph",
+			setup: func(g *agent.Graph) {
+				g.AddNode(&textNode{name: "a"})
+				g.AddNode(&textNode{name: "b"})
+				g.SetEntryPoint("a")
+				g.AddConditionalEdge("a", route, "b", agent.End)
+				g.SetFinishPoint("b")
+			},
+		},
+		{
+			name: "unknown entry point",
+			setup: func(g *agent.Graph) {
+				g.AddNode(&textNode{name: "a"})
+				g.SetFinishPoint("a")
+			},
+			expectedError: "graph entry point '' not found",
+		},
+		{
+			name: "edge to unknown node",
+			setup: func(g *agent.Graph) {
+				g.AddNode(&textNode{name: "a"})
+				g.SetEntryPoint("a")
+				g.AddEdge("a", "b")
+			},
+			expectedError: "graph edge from 'a' to unknown node 'b'",
+		},
+		{
+			name: "dangling node",
+			setup: func(g *agent.Graph) {
+				g.AddNode(&textNode{name: "a"})
+				g.AddNode(&textNode{name: "b"})
+				g.SetEntryPoint("a")
+				g.AddEdge("a", "b")
+			},
+			expectedError: "graph node 'b' is dangling, it has no edge and not terminal",
+		},
+		{
+			name: "unreachable node",
+			setup: func(g *agent.Graph) {
+				g.AddNode(&textNode{name: "a"})
+				g.AddNode(&textNode{name: "b"})
+				g.SetEntryPoint("a")
+				g.AddEdge("a", agent.End)
+				g.AddEdge("b", agent.End)
+			},
+			expectedError: "graph node 'b' is unreachable from entry point 'a'",
+		},
+		{
+			name: "conditional edge without targets",
+			setup: func(g *agent.Graph) {
+				g.AddNode(&textNode{name: "a"})
+				g.SetEntryPoint("a")
+				g.AddConditionalEdge("a", route)
+			},
+			expectedError: "graph conditional edge from 'a' has no targets",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := agent.NewGraph()
+			tc.setup(g)
+			err := g.Build()
+			if tc.expectedError != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedError, err.Error())
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestGraph_Run(t *testing.T) {
+	g := agent.NewGraph()
+	g.AddNode(&textNode{name: "guard"})
+	g.AddNode(&textNode{name: "a"})
+	g.AddNode(&textNode{name: "b"})
+	g.SetEntryPoint("guard")
+	g.AddEdge("guard", "a")
+	g.AddConditionalEdge("a", func(s agent.State) string {
+		if len(s.Message) < 4 {
+			return "b"
+		}
+		return agent.End
+	}, "b", agent.End)
+	g.AddEdge("b", "a")
+
+	_, err := g.Run(t.Context(), agent.State{})
+	require.Error(t, err, "run before build")
+
+	require.NoError(t, g.Build())
+	msg, err := g.Run(t.Context(), agent.State{})
+	require.NoError(t, err)
+	assert.Equal(t, "a", msg.Text())
+
+	// route to target that not declared
+	g.AddConditionalEdge("a", func(s agent.State) string { return "guard" }, "b", agent.End)
+	require.NoError(t, g.Build())
+	_, err = g.Run(t.Context(), agent.State{})
+	require.EqualError(t, err, "node 'a' routed to undeclared target 'guard'")
+}
+
+func TestAgent_GraphBuilder(t *testing.T) {
+	provider := &mockProvider{}
+	a := agent.New(provider, agent.WithGraphBuilder(func(g *agent.Graph) error {
+		// summarize after agent answer
+		g.AddNode(&textNode{name: "summary"})
+		g.AddConditionalEdge(agent.AgentNodeName, func(s agent.State) string {
+			if agent.RouteToolCalls(s) == agent.End {
+				return "summary"
+			}
+			return agent.ToolNodeName
+		}, agent.ToolNodeName, "summary")
+		g.SetFinishPoint("summary")
+		return nil
+	}))
+
+	msg, err := a.Completion(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hello")})
+	require.NoError(t, err)
+	assert.Equal(t, "summary", msg.Text())
+}
@@ -1,8 +1,14 @@
 package agent
 
 type options struct {
-	tools       Tools
-	toolMaxCall int
+	tools           Tools
+	budget          Budget
+	toolConcurrency int
+	argumentRetries int
+	graphBuilders   []GraphBuilder
+	checkpointer    Checkpointer
+	contextWindow   ContextWindow
+	instruction     string
 }
 
 type OptionFunc func(o *options)
@@ -14,9 +20,66 @@ func WithTool(tools ...ToolProvider) OptionFunc {
 	}
 }
 
-// set maximum tool call agent can invoke, not implemented yet
+// set maximum tool call agent can invoke in one run.
 func WithMaxToolCall(n int) OptionFunc {
 	return func(o *options) {
-		o.toolMaxCall = n
+		o.budget.MaxToolCalls = n
+	}
+}
+
+// limit every run of the agent, see Budget.
+// it overrides previous WithMaxToolCall.
+func WithBudget(b Budget) OptionFunc {
+	return func(o *options) {
+		o.budget = b
+	}
+}
+
+// set maximum number of tool calls executed concurrently in one step.
+func WithToolConcurrency(n int) OptionFunc {
+	return func(o *options) {
+		o.toolConcurrency = n
+	}
+}
+
+// set how many times the model may retry a tool after calling it with invalid arguments,
+// 0 refuse the tool after the first invalid call and negative keep the default 2.
+// the tool is refused for the rest of the run afterward.
+func WithArgumentRetries(n int) OptionFunc {
+	return func(o *options) {
+		o.argumentRetries = n
+	}
+}
+
+// customize the agent graph before it is built.
+// the graph already has AgentNodeName and ToolNodeName node with their edges,
+// builder may add node, replace edge or change entry point.
+type GraphBuilder func(g *Graph) error
+
+// add graph builder, builders are applied in order.
+func WithGraphBuilder(fn GraphBuilder) OptionFunc {
+	return func(o *options) {
+		o.graphBuilders = append(o.graphBuilders, fn)
+	}
+}
+
+// save checkpoint of every run so failed run can be resumed, see Agent.Resume.
+func WithCheckpointer(cp Checkpointer) OptionFunc {
+	return func(o *options) {
+		o.checkpointer = cp
+	}
+}
+
+// compact the history before it is sent to the provider, see ContextWindow.
+func WithContextWindow(cw ContextWindow) OptionFunc {
+	return func(o *options) {
+		o.contextWindow = cw
+	}
+}
+
+// system prompt prepended to the messages of every run.
+func WithInstruction(text string) OptionFunc {
+	return func(o *options) {
+		o.instruction = text
 	}
 }
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// name of the node that validate the final answer against the response schema.
+const OutputNodeName = "output"
+
+// default number of re-prompts after the final answer does not match the response schema.
+const defaultOutputRetries = 2
+
+// returned when the final answer still does not match the response schema after all re-prompts.
+type ErrInvalidOutput struct {
+	// each problem is prefixed by the path of the value, e.g "items[0].name".
+	Problems []string
+}
+
+func (e *ErrInvalidOutput) Error() string {
+	return fmt.Sprintf("final answer does not match response schema: %s", strings.Join(e.Problems, "; "))
+}
+
+// parse the text as JSON value that match the schema, markdown code fence around it is ignored.
+func (pd ParameterDefinition) ParseJSON(text string) (json.RawMessage, error) {
+	text = strings.TrimSpace(text)
+	if fenced, ok := strings.CutPrefix(text, "```"); ok {
+		fenced = strings.TrimPrefix(fenced, "json")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fenced), "```"))
+	}
+
+	value, err := decodeJSON([]byte(text))
+	if err != nil {
+		return nil, &ErrInvalidOutput{Problems: []string{"answer is not valid JSON"}}
+	}
+	if problems := pd.validate("", value); len(problems) > 0 {
+		return nil, &ErrInvalidOutput{Problems: problems}
+	}
+	return json.RawMessage(text), nil
+}
+
+// validate the final answer against the response schema, invalid answer is re-prompted without tools.
+type OutputNode struct {
+	provider    Provider
+	schema      ParameterDefinition
+	retries     int
+	temperature *float32
+}
+
+func NewOutputNode(provider Provider, schema ParameterDefinition, temperature *float32) *OutputNode {
+	return &OutputNode{
+		provider:    provider,
+		schema:      schema,
+		retries:     defaultOutputRetries,
+		temperature: temperature,
+	}
+}
+
+func (on *OutputNode) Name() string {
+	return OutputNodeName
+}
+
+func (on *OutputNode) Execute(ctx context.Context, state State) (State, error) {
+	ctx, span := tracer.Start(ctx, "OutputNode.Execute")
+	defer span.End()
+
+	for attempt := 0; ; attempt++ {
+		output, err := on.schema.ParseJSON(state.lastMessage().Text())
+		if err == nil {
+			state.Output = output
+			span.SetAttributes(attribute.Int("output.retries", attempt))
+			return state, nil
+		}
+		if attempt >= on.retries {
+			return state, err
+		}
+
+		invalid := err.(*ErrInvalidOutput)
+		state.Message = append(state.Message, NewTextMessage(RoleUser, fmt.Sprintf(
+			"Your answer does not match the required JSON schema: %s. Reply only with the corrected JSON.",
+			strings.Join(invalid.Problems, "; "),
+		)))
+		resp, err := on.provider.Chat(ctx, CCReq{
+			Messages:       state.Message,
+			ResponseSchema: &on.schema,
+			Temperature:    on.temperature,
+		})
+		if err != nil {
+			return state, err
+		}
+		state.Message = append(state.Message, NewTextMessage(RoleAssistant, resp.Choices[0].Text))
+		state.Model = resp.Model
+		state.FinishReason = resp.Choices[0].FinishReason
+		state.Usage = state.Usage.Add(resp.Usage)
+		recordUsage(ctx, resp.Model, resp.Usage)
+	}
+}
+
+// final node of run with response schema, the answer after budget exceeded is validated like any other.
+type outputFinalNode struct {
+	answer Node
+	output *OutputNode
+}
+
+func (n *outputFinalNode) Name() string {
+	return n.answer.Name()
+}
+
+func (n *outputFinalNode) Execute(ctx context.Context, state State) (State, error) {
+	state, err := n.answer.Execute(ctx, state)
+	if err != nil || len(state.lastMessage().ToolCalls()) > 0 {
+		return state, err
+	}
+	return n.output.Execute(ctx, state)
+}
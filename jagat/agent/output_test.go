@@ -0,0 +1,175 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func citySchema() agent.ParameterDefinition {
+	return agent.ParameterDefinition{
+		Type: agent.Parameter_Type_Object,
+		Properties: map[string]agent.ParameterDefinition{
+			"city":       {Type: agent.Parameter_Type_String},
+			"population": {Type: agent.Parameter_Type_Integer, Minimum: ptr(0.0)},
+		},
+		Required: []string{"city", "population"},
+	}
+}
+
+func TestAgent_ResponseSchema(t *testing.T) {
+	testCases := []struct {
+		name     string
+		answers  []string
+		calls    int
+		expected string
+		problems []string
+	}{
+		{
+			name:     "valid first answer",
+			answers:  []string{`{"city":"Jakarta","population":10000000}`},
+			calls:    1,
+			expected: `{"city":"Jakarta","population":10000000}`,
+		},
+		{
+			name:     "fenced answer",
+			answers:  []string{"```json\n{\"city\":\"Bandung\",\"population\":2500000}\n```"},
+			calls:    1,
+			expected: `{"city":"Bandung","population":2500000}`,
+		},
+		{
+			name:     "trailing text",
+			answers:  []string{"{\"city\":\"Jakarta\",\"population\":10000000}\nHope this helps!", `{"city":"Jakarta","population":10000000}`},
+			calls:    2,
+			expected: `{"city":"Jakarta","population":10000000}`,
+		},
+		{
+			name:     "re-prompt then valid",
+			answers:  []string{`{"city":"Jakarta"}`, `{"city":"Jakarta","population":10000000}`},
+			calls:    2,
+			expected: `{"city":"Jakarta","population":10000000}`,
+		},
+		{
+			name:     "retries exhausted",
+			answers:  []string{"Jakarta", `{"city":1}`, `{"city":"Jakarta","population":-1}`},
+			calls:    3,
+			problems: []string{"population: must be >= 0, got -1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reqs []agent.CCReq
+			provider := &mockProvider{
+				ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+					reqs = append(reqs, req)
+					return &agent.CCRes{
+						Choices: []agent.Choice{{Text: tc.answers[len(reqs)-1]}},
+						Usage:   agent.Usage{TotalTokens: 10},
+					}, nil
+				},
+			}
+			a := agent.New(provider, agent.WithTool(&countingTool{}))
+			msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "largest city")}
+
+			res, err := a.Completion(t.Context(), msgs, agent.WithResponseSchema(citySchema()))
+			require.Len(t, reqs, tc.calls)
+			for i, req := range reqs {
+				require.NotNil(t, req.ResponseSchema)
+				// only the re-prompt is sent without tools.
+				assert.Equal(t, i == 0, len(req.Tools) > 0)
+			}
+			if tc.problems != nil {
+				var invalid *agent.ErrInvalidOutput
+				require.True(t, errors.As(err, &invalid), err)
+				assert.Equal(t, tc.problems, invalid.Problems)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(res.Output))
+			assert.Equal(t, int32(10*tc.calls), res.Usage.TotalTokens)
+
+			var out struct {
+				City       string `json:"city"`
+				Population int    `json:"population"`
+			}
+			require.NoError(t, res.DecodeOutput(&out))
+			assert.NotEmpty(t, out.City)
+		})
+	}
+}
+
+func TestAgent_ResponseSchemaBudget(t *testing.T) {
+	var final []agent.CCReq
+	answers := []string{`{"city":"Jakarta"}`, `{"city":"Jakarta","population":10000000}`}
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			// keep calling tool as long as tools are provided.
+			if len(req.Tools) > 0 {
+				return &agent.CCRes{Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+					{ID: "call", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}},
+				}}}}, nil
+			}
+			final = append(final, req)
+			return &agent.CCRes{Choices: []agent.Choice{{Text: answers[len(final)-1]}}}, nil
+		},
+	}
+	a := agent.New(provider, agent.WithTool(&countingTool{}), agent.WithBudget(agent.Budget{MaxToolCalls: 1}))
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "largest city")}
+
+	res, err := a.Completion(t.Context(), msgs, agent.WithResponseSchema(citySchema()))
+	require.NoError(t, err)
+	// the answer after budget exceeded is asked with the schema and re-prompted until valid.
+	require.Len(t, final, 2)
+	for _, req := range final {
+		assert.NotNil(t, req.ResponseSchema)
+	}
+	assert.JSONEq(t, `{"city":"Jakarta","population":10000000}`, string(res.Output))
+}
+
+func TestAgent_ResponseSchemaInvalid(t *testing.T) {
+	a := agent.New(&mockProvider{})
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hello")}
+
+	_, err := a.Completion(t.Context(), msgs, agent.WithResponseSchema(agent.ParameterDefinition{Type: "float"}))
+	var invalid *agent.ErrInvalidOption
+	require.True(t, errors.As(err, &invalid), err)
+	assert.Contains(t, err.Error(), "response_schema: unknown type 'float'")
+
+	res, err := a.Completion(t.Context(), msgs)
+	require.NoError(t, err)
+	assert.Nil(t, res.Output)
+	assert.Error(t, res.DecodeOutput(&struct{}{}))
+}
+
+func TestAgent_ResumeOutput(t *testing.T) {
+	calls := 0
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			calls++
+			switch calls {
+			case 1:
+				return &agent.CCRes{Choices: []agent.Choice{{Text: `{"city":"Jakarta"}`}}}, nil
+			case 2:
+				return nil, errors.New("provider unavailable")
+			default:
+				require.NotNil(t, req.ResponseSchema)
+				return &agent.CCRes{Choices: []agent.Choice{{Text: `{"city":"Jakarta","population":10000000}`}}}, nil
+			}
+		},
+	}
+	a := agent.New(provider, agent.WithCheckpointer(agent.NewMemoryCheckpointer()))
+	msgs := []*agent.Message{agent.NewTextMessage(agent.RoleUser, "largest city")}
+
+	_, err := a.Completion(t.Context(), msgs, agent.WithRunID("run-1"), agent.WithResponseSchema(citySchema()))
+	require.ErrorContains(t, err, "failed executing node 'output'")
+
+	// the run failed in the output node is resumed there with its schema.
+	res, err := a.Resume(t.Context(), "run-1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"city":"Jakarta","population":10000000}`, string(res.Output))
+}
@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// version of the message wire format, each part is JSON object tagged by type:
+//
+//	{"type": "text", "text": "hello"}
+//	{"type": "thought", "thought": "user greets"}
+//	{"type": "blob", "blob": {"mime": "image/png", "data": "<base64>"}}
+//	{"type": "tool_call", "tool_call": {"id": "call_1", "type": "function", "function": {"name": "...", "arguments": "{}"}}}
+//	{"type": "tool_response", "tool_response": {"id": "call_1", "name": "...", "output": {}}}
+//
+// part without type is decoded from the legacy shape of go field names (Text, Blob, Toolcall, ToolResponse).
+// the legacy shape is deprecated, it is accepted until the next release.
+const MessageVersion = 1
+
+var partTypes = []string{TextPart, ThoughtPart, BlobPart, ToolCallPart, ToolRespPart}
+
+type wirePart struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text,omitempty"`
+	Thought      string        `json:"thought,omitempty"`
+	Blob         *wireBlob     `json:"blob,omitempty"`
+	ToolCall     *ToolCall     `json:"tool_call,omitempty"`
+	ToolResponse *ToolResponse `json:"tool_response,omitempty"`
+}
+
+type wireBlob struct {
+	Mime string `json:"mime"`
+	Data []byte `json:"data"`
+}
+
+// shape before MessageVersion 1, keys are matched case-insensitively.
+type legacyPart struct {
+	Text         string
+	Thought      string
+	Blob         *Blob
+	Toolcall     *ToolCall
+	ToolResponse *ToolResponse
+}
+
+// type of the filled fields in order, empty part has none.
+func (p *Part) types() []string {
+	types := []string{}
+	if p.Text != "" {
+		types = append(types, TextPart)
+	}
+	if p.Thought != "" {
+		types = append(types, ThoughtPart)
+	}
+	if p.Blob != nil {
+		types = append(types, BlobPart)
+	}
+	if p.Toolcall != nil {
+		types = append(types, ToolCallPart)
+	}
+	if p.ToolResponse != nil {
+		types = append(types, ToolRespPart)
+	}
+	return types
+}
+
+// type of the part in wire format, empty part is empty text.
+func (p *Part) Type() string {
+	if types := p.types(); len(types) > 0 {
+		return types[0]
+	}
+	return TextPart
+}
+
+// part was decoded from the legacy shape without type.
+func (p *Part) IsLegacy() bool {
+	return p.legacy
+}
+
+// check the part has exactly one field filled and its content is usable.
+func (p *Part) Validate() error {
+	if p.problem != "" {
+		return fmt.Errorf("%s", p.problem)
+	}
+	types := p.types()
+	switch {
+	case len(types) == 0:
+		return fmt.Errorf("part is empty")
+	case len(types) > 1:
+		return fmt.Errorf("part must have exactly one field, got %s", strings.Join(types, " and "))
+	}
+	switch {
+	case p.Blob != nil && p.Blob.Mime == "":
+		return fmt.Errorf("blob need mime")
+	case p.Toolcall != nil && p.Toolcall.Function.Name == "":
+		return fmt.Errorf("tool_call need function name")
+	case p.ToolResponse != nil && p.ToolResponse.Name == "":
+		return fmt.Errorf("tool_response need name")
+	}
+	return nil
+}
+
+func (p Part) MarshalJSON() ([]byte, error) {
+	w := wirePart{
+		Type:         p.Type(),
+		Text:         p.Text,
+		Thought:      p.Thought,
+		ToolCall:     p.Toolcall,
+		ToolResponse: p.ToolResponse,
+	}
+	if p.Blob != nil {
+		w.Blob = &wireBlob{Mime: p.Blob.Mime, Data: p.Blob.Bytes}
+	}
+	return json.Marshal(w)
+}
+
+// decode both wire format and legacy shape, problem of the content is reported by Validate
+// so the caller can point at the part.
+func (p *Part) UnmarshalJSON(b []byte) error {
+	var w wirePart
+	if err := json.Unmarshal(b, &w); err != nil {
+		return err
+	}
+	if w.Type == "" {
+		var l legacyPart
+		if err := json.Unmarshal(b, &l); err != nil {
+			return err
+		}
+		*p = Part{Text: l.Text, Thought: l.Thought, Blob: l.Blob, Toolcall: l.Toolcall, ToolResponse: l.ToolResponse, legacy: true}
+		return nil
+	}
+
+	*p = Part{Text: w.Text, Thought: w.Thought, Toolcall: w.ToolCall, ToolResponse: w.ToolResponse}
+	if w.Blob != nil {
+		p.Blob = &Blob{Bytes: w.Blob.Data, Mime: w.Blob.Mime}
+	}
+
+	types := p.types()
+	switch {
+	case !slices.Contains(partTypes, w.Type):
+		p.problem = fmt.Sprintf("unknown part type '%s', expected one of [%s]", w.Type, strings.Join(partTypes, ", "))
+	case len(types) == 0 && w.Type != TextPart:
+		p.problem = fmt.Sprintf("part type '%s' need %s field", w.Type, w.Type)
+	case len(types) == 1 && types[0] != w.Type:
+		p.problem = fmt.Sprintf("part type '%s' but has %s field", w.Type, types[0])
+	}
+	return nil
+}
+
+// check the role and every part, the error point at the bad part, e.g "parts[1]: part is empty".
+func (m *Message) Validate() error {
+	switch m.Role {
+	case RoleUser, RoleAssistant, RoleSystem, RoleTool:
+	default:
+		return fmt.Errorf("unknown role '%s'", m.Role)
+	}
+	if len(m.Parts) == 0 {
+		return fmt.Errorf("parts cannot be empty")
+	}
+	for i, p := range m.Parts {
+		if p == nil {
+			return fmt.Errorf("parts[%d]: part is empty", i)
+		}
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("parts[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
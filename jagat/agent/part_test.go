@@ -0,0 +1,112 @@
+package agent_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPart_JSON(t *testing.T) {
+	testCases := []struct {
+		name string
+		part agent.Part
+		wire string
+	}{
+		{name: "text", part: agent.Part{Text: "hello"}, wire: `{"type":"text","text":"hello"}`},
+		{name: "thought", part: agent.Part{Thought: "user greets"}, wire: `{"type":"thought","thought":"user greets"}`},
+		{
+			name: "blob",
+			part: agent.Part{Blob: &agent.Blob{Bytes: []byte("hello"), Mime: "image/png"}},
+			wire: `{"type":"blob","blob":{"mime":"image/png","data":"aGVsbG8="}}`,
+		},
+		{
+			name: "tool call",
+			part: agent.Part{Toolcall: &agent.ToolCall{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "clock", Arguments: "{}"}}},
+			wire: `{"type":"tool_call","tool_call":{"id":"call_1","type":"function","function":{"name":"clock","arguments":"{}"}}}`,
+		},
+		{
+			name: "tool response",
+			part: agent.Part{ToolResponse: &agent.ToolResponse{ID: "call_1", Name: "clock", Output: map[string]any{"time": "12:00"}}},
+			wire: `{"type":"tool_response","tool_response":{"id":"call_1","name":"clock","output":{"time":"12:00"}}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(tc.part)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.wire, string(b))
+
+			var got agent.Part
+			require.NoError(t, json.Unmarshal(b, &got))
+			assert.Equal(t, tc.part, got)
+			assert.NoError(t, got.Validate())
+			assert.False(t, got.IsLegacy())
+		})
+	}
+}
+
+func TestPart_Legacy(t *testing.T) {
+	var msg agent.Message
+	wire := `{"Role":"user","Parts":[{"Text":"hello"},{"blob":{"Bytes":"aGVsbG8=","Mime":"image/png"}},{"ToolResponse":{"ID":"call_1","Name":"clock","Output":{}}}]}`
+	require.NoError(t, json.Unmarshal([]byte(wire), &msg))
+	require.NoError(t, msg.Validate())
+
+	assert.Equal(t, agent.RoleUser, msg.Role)
+	require.Len(t, msg.Parts, 3)
+	assert.True(t, msg.Parts[0].IsLegacy())
+	assert.Equal(t, "hello", msg.Parts[0].Text)
+	assert.Equal(t, []byte("hello"), msg.Parts[1].Blob.Bytes)
+	assert.Equal(t, "clock", msg.Parts[2].ToolResponse.Name)
+}
+
+func TestMessage_Validate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		wire     string
+		expected string
+	}{
+		{name: "valid", wire: `{"role":"user","parts":[{"type":"text","text":"hi"}]}`},
+		{name: "unknown role", wire: `{"role":"robot","parts":[{"type":"text","text":"hi"}]}`, expected: "unknown role 'robot'"},
+		{name: "no parts", wire: `{"role":"user","parts":[]}`, expected: "parts cannot be empty"},
+		{name: "empty part", wire: `{"role":"user","parts":[{"type":"text","text":"hi"},{}]}`, expected: "parts[1]: part is empty"},
+		{name: "null part", wire: `{"role":"user","parts":[null]}`, expected: "parts[0]: part is empty"},
+		{
+			name:     "two fields",
+			wire:     `{"role":"user","parts":[{"type":"text","text":"hi","blob":{"mime":"image/png","data":"aGVsbG8="}}]}`,
+			expected: "parts[0]: part must have exactly one field, got text and blob",
+		},
+		{
+			name:     "legacy two fields",
+			wire:     `{"role":"user","parts":[{"Text":"hi","Thought":"greet"}]}`,
+			expected: "parts[0]: part must have exactly one field, got text and thought",
+		},
+		{
+			name:     "unknown type",
+			wire:     `{"role":"user","parts":[{"type":"image","text":"hi"}]}`,
+			expected: "parts[0]: unknown part type 'image', expected one of [text, thought, blob, tool_call, tool_response]",
+		},
+		{name: "type without field", wire: `{"role":"user","parts":[{"type":"blob"}]}`, expected: "parts[0]: part type 'blob' need blob field"},
+		{name: "type mismatch", wire: `{"role":"user","parts":[{"type":"blob","text":"hi"}]}`, expected: "parts[0]: part type 'blob' but has text field"},
+		{name: "blob without mime", wire: `{"role":"user","parts":[{"type":"blob","blob":{"data":"aGVsbG8="}}]}`, expected: "parts[0]: blob need mime"},
+		{
+			name:     "tool call without name",
+			wire:     `{"role":"assistant","parts":[{"type":"tool_call","tool_call":{"id":"call_1"}}]}`,
+			expected: "parts[0]: tool_call need function name",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var msg agent.Message
+			require.NoError(t, json.Unmarshal([]byte(tc.wire), &msg))
+			err := msg.Validate()
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// outcome of a finished run.
+type Result struct {
+	RunID string
+	// the final answer.
+	Message *Message
+	// messages appended by the run: assistant tool calls, tool responses and the final answer.
+	Messages []*Message
+	// model and finish reason of the last provider response.
+	Model        string
+	FinishReason string
+	// token usage summed over the run.
+	Usage Usage
+	// execution time of each node, in order.
+	Timings []StepTiming
+	// final answer as JSON, only set when the run has response schema.
+	Output json.RawMessage
+}
+
+func newResult(state State) *Result {
+	return &Result{
+		RunID:        state.RunID,
+		Message:      state.lastMessage(),
+		Messages:     state.Message[min(state.Input, len(state.Message)):],
+		Model:        state.Model,
+		FinishReason: state.FinishReason,
+		Usage:        state.Usage,
+		Timings:      state.Timings,
+		Output:       state.Output,
+	}
+}
+
+// decode the structured output into v, the run must have response schema.
+func (r *Result) DecodeOutput(v any) error {
+	if r.Output == nil {
+		return fmt.Errorf("result has no structured output")
+	}
+	return json.Unmarshal(r.Output, v)
+}
+
+// text of the final answer.
+func (r *Result) Text() string {
+	return r.Message.Text()
+}
+
+// thinking of every model turn in the run, separated by blank line.
+func (r *Result) Reasoning() string {
+	thoughts := []string{}
+	for _, msg := range r.Messages {
+		if t := msg.Thought(); t != "" {
+			thoughts = append(thoughts, t)
+		}
+	}
+	return strings.Join(thoughts, "\n\n")
+}
@@ -0,0 +1,53 @@
+package agent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Result(t *testing.T) {
+	tool := &countingTool{}
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			usage := agent.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}
+			if len(req.Messages) == 2 {
+				return &agent.CCRes{Model: "m-1", Usage: usage, Choices: []agent.Choice{{FinishReason: "STOP", ToolCalls: []*agent.ToolCall{
+					{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}},
+				}}}}, nil
+			}
+			return &agent.CCRes{Model: "m-2", Usage: usage, Choices: []agent.Choice{{Text: "sent", FinishReason: "STOP"}}}, nil
+		},
+	}
+
+	a := agent.New(provider, agent.WithTool(tool))
+	msgs := []*agent.Message{
+		agent.NewTextMessage(agent.RoleSystem, "be brief"),
+		agent.NewTextMessage(agent.RoleUser, "send hello"),
+	}
+	res, err := a.Completion(t.Context(), msgs, agent.WithRunID("run-1"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "run-1", res.RunID)
+	assert.Equal(t, "sent", res.Text())
+	assert.Equal(t, "m-2", res.Model)
+	assert.Equal(t, "STOP", res.FinishReason)
+	assert.Equal(t, agent.Usage{PromptTokens: 20, CompletionTokens: 4, TotalTokens: 24}, res.Usage)
+
+	// only messages produced by the run
+	require.Len(t, res.Messages, 3)
+	assert.Equal(t, agent.RoleAssistant, res.Messages[0].Role)
+	assert.Len(t, res.Messages[0].ToolCalls(), 1)
+	assert.Equal(t, agent.RoleTool, res.Messages[1].Role)
+	assert.Same(t, res.Message, res.Messages[2])
+
+	nodes := []string{}
+	for _, timing := range res.Timings {
+		nodes = append(nodes, timing.Node)
+		assert.False(t, timing.Start.IsZero())
+	}
+	assert.Equal(t, []string{agent.AgentNodeName, agent.ToolNodeName, agent.AgentNodeName}, nodes)
+}
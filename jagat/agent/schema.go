@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var parameterTypes = []string{
+	Parameter_Type_Object,
+	Parameter_Type_Array,
+	Parameter_Type_String,
+	Parameter_Type_Number,
+	Parameter_Type_Integer,
+	Parameter_Type_Boolean,
+}
+
+// check the tool definition is valid schema, e.g "float" is not JSON Schema type.
+// tooldef.Build rejects tool that fail the lint.
+func (t Tool) Lint() error {
+	if t.Function.Name == "" {
+		return errors.New("function name is empty")
+	}
+	ps := t.Function.Parameters
+	if ps.isEmpty() {
+		return nil
+	}
+	if ps.Type != Parameter_Type_Object {
+		return fmt.Errorf("%s: parameters type must be object, got '%s'", t.Function.Name, ps.Type)
+	}
+	if err := ps.definition().lint("parameters"); err != nil {
+		return fmt.Errorf("%s: %w", t.Function.Name, err)
+	}
+	return nil
+}
+
+// function that accept no arguments may leave the schema empty.
+func (ps ParameterSchema) isEmpty() bool {
+	return ps.Type == "" && len(ps.Properties) == 0 && len(ps.Required) == 0
+}
+
+// the schema as object definition.
+func (ps ParameterSchema) definition() ParameterDefinition {
+	return ParameterDefinition{
+		Type:       Parameter_Type_Object,
+		Properties: ps.Properties,
+		Required:   ps.Required,
+	}
+}
+
+func (pd ParameterDefinition) lint(path string) error {
+	if pd.Type == "" && len(pd.OneOf) == 0 {
+		return fmt.Errorf("%s: type is required", path)
+	}
+	if pd.Type != "" && !slices.Contains(parameterTypes, pd.Type) {
+		return fmt.Errorf("%s: unknown type '%s', expected one of [%s]", path, pd.Type, strings.Join(parameterTypes, ", "))
+	}
+
+	// keyword that only apply to some types.
+	only := func(keyword string, set bool, types ...string) error {
+		if set && !slices.Contains(types, pd.Type) {
+			return fmt.Errorf("%s: %s is not allowed for type '%s'", path, keyword, pd.Type)
+		}
+		return nil
+	}
+	if err := errors.Join(
+		only("enum", len(pd.Enum) > 0, Parameter_Type_String),
+		only("format", pd.Format != "", Parameter_Type_String),
+		only("minLength", pd.MinLength != nil, Parameter_Type_String),
+		only("maxLength", pd.MaxLength != nil, Parameter_Type_String),
+		only("minimum", pd.Minimum != nil, Parameter_Type_Number, Parameter_Type_Integer),
+		only("maximum", pd.Maximum != nil, Parameter_Type_Number, Parameter_Type_Integer),
+		only("items", pd.Items != nil, Parameter_Type_Array),
+		only("minItems", pd.MinItems != nil, Parameter_Type_Array),
+		only("maxItems", pd.MaxItems != nil, Parameter_Type_Array),
+		only("properties", len(pd.Properties) > 0, Parameter_Type_Object),
+		only("required", len(pd.Required) > 0, Parameter_Type_Object),
+	); err != nil {
+		return err
+	}
+
+	if pd.Format != "" && !slices.Contains(stringFormats, pd.Format) {
+		return fmt.Errorf("%s: unknown format '%s', expected one of [%s]", path, pd.Format, strings.Join(stringFormats, ", "))
+	}
+	if pd.Minimum != nil && pd.Maximum != nil && *pd.Minimum > *pd.Maximum {
+		return fmt.Errorf("%s: minimum is greater than maximum", path)
+	}
+	if err := lintLength(path, "Length", pd.MinLength, pd.MaxLength); err != nil {
+		return err
+	}
+	if err := lintLength(path, "Items", pd.MinItems, pd.MaxItems); err != nil {
+		return err
+	}
+
+	if pd.Type == Parameter_Type_Array {
+		if pd.Items == nil {
+			return fmt.Errorf("%s: array need items", path)
+		}
+		if err := pd.Items.lint(path + ".items"); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(pd.Properties))
+	for name := range pd.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := pd.Properties[name].lint(path + "." + name); err != nil {
+			return err
+		}
+	}
+	for _, name := range pd.Required {
+		if _, ok := pd.Properties[name]; !ok {
+			return fmt.Errorf("%s: required '%s' is not in properties", path, name)
+		}
+	}
+
+	for i, alt := range pd.OneOf {
+		if err := alt.lint(fmt.Sprintf("%s.oneOf[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+
+	// default go through JSON, so it is checked the same way as the arguments.
+	if pd.Default != nil {
+		b, err := json.Marshal(pd.Default)
+		if err != nil {
+			return fmt.Errorf("%s: default is not JSON value: %w", path, err)
+		}
+		v, _ := decodeJSON(b)
+		if problems := pd.validate(path, v); len(problems) > 0 {
+			return fmt.Errorf("invalid default, %s", problems[0])
+		}
+	}
+	return nil
+}
+
+func lintLength(path, keyword string, min, max *int) error {
+	if (min != nil && *min < 0) || (max != nil && *max < 0) {
+		return fmt.Errorf("%s: min%s and max%s cannot be negative", path, keyword, keyword)
+	}
+	if min != nil && max != nil && *min > *max {
+		return fmt.Errorf("%s: min%s is greater than max%s", path, keyword, keyword)
+	}
+	return nil
+}
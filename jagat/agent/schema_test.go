@@ -0,0 +1,122 @@
+package agent_test
+
+import (
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func toolWith(props map[string]agent.ParameterDefinition, required ...string) agent.Tool {
+	return agent.Tool{Type: "function", Function: agent.Function{
+		Name: "search",
+		Parameters: agent.ParameterSchema{
+			Type:       agent.Parameter_Type_Object,
+			Properties: props,
+			Required:   required,
+		},
+	}}
+}
+
+func TestTool_Lint(t *testing.T) {
+	testCases := []struct {
+		name          string
+		tool          agent.Tool
+		expectedError string
+	}{
+		{name: "no parameters", tool: agent.Tool{Function: agent.Function{Name: "now"}}},
+		{
+			name: "nested schema",
+			tool: toolWith(map[string]agent.ParameterDefinition{
+				"query": {Type: "string", MinLength: ptr(1), Default: "go"},
+				"limit": {Type: "integer", Minimum: ptr(1.0), Maximum: ptr(10.0), Default: 3},
+				"since": {Type: "string", Format: "date"},
+				"tags":  {Type: "array", Items: &agent.ParameterDefinition{Type: "string"}, MaxItems: ptr(5)},
+				"location": {Type: "object", Properties: map[string]agent.ParameterDefinition{
+					"city": {Type: "string"},
+				}, Required: []string{"city"}},
+				"id": {OneOf: []agent.ParameterDefinition{{Type: "string"}, {Type: "integer"}}},
+			}, "query"),
+		},
+		{name: "empty name", tool: agent.Tool{}, expectedError: "function name is empty"},
+		{
+			name:          "parameters not object",
+			tool:          agent.Tool{Function: agent.Function{Name: "search", Parameters: agent.ParameterSchema{Type: "string"}}},
+			expectedError: "search: parameters type must be object, got 'string'",
+		},
+		{
+			name:          "float type",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"latitude": {Type: "float"}}),
+			expectedError: "search: parameters.latitude: unknown type 'float', expected one of [object, array, string, number, integer, boolean]",
+		},
+		{
+			name:          "missing type",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"query": {Description: "query"}}),
+			expectedError: "search: parameters.query: type is required",
+		},
+		{
+			name:          "array without items",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"tags": {Type: "array"}}),
+			expectedError: "search: parameters.tags: array need items",
+		},
+		{
+			name: "nested unknown type",
+			tool: toolWith(map[string]agent.ParameterDefinition{"tags": {Type: "array", Items: &agent.ParameterDefinition{
+				Type: "object", Properties: map[string]agent.ParameterDefinition{"score": {Type: "double"}},
+			}}}),
+			expectedError: "search: parameters.tags.items.score: unknown type 'double', expected one of [object, array, string, number, integer, boolean]",
+		},
+		{
+			name:          "enum on number",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"limit": {Type: "number", Enum: []string{"1"}}}),
+			expectedError: "search: parameters.limit: enum is not allowed for type 'number'",
+		},
+		{
+			name:          "unknown format",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"since": {Type: "string", Format: "timestamp"}}),
+			expectedError: "search: parameters.since: unknown format 'timestamp', expected one of [date-time, date, time, email, uri, uuid]",
+		},
+		{
+			name:          "minimum over maximum",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"limit": {Type: "integer", Minimum: ptr(5.0), Maximum: ptr(1.0)}}),
+			expectedError: "search: parameters.limit: minimum is greater than maximum",
+		},
+		{
+			name:          "negative length",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"query": {Type: "string", MinLength: ptr(-1)}}),
+			expectedError: "search: parameters.query: minLength and maxLength cannot be negative",
+		},
+		{
+			name:          "required not in properties",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"query": {Type: "string"}}, "q"),
+			expectedError: "search: parameters: required 'q' is not in properties",
+		},
+		{
+			name:          "invalid default",
+			tool:          toolWith(map[string]agent.ParameterDefinition{"limit": {Type: "integer", Maximum: ptr(3.0), Default: 5}}),
+			expectedError: "search: invalid default, parameters.limit: must be <= 3, got 5",
+		},
+		{
+			name: "invalid oneOf",
+			tool: toolWith(map[string]agent.ParameterDefinition{"id": {OneOf: []agent.ParameterDefinition{
+				{Type: "string"}, {Type: "int"},
+			}}}),
+			expectedError: "search: parameters.id.oneOf[1]: unknown type 'int', expected one of [object, array, string, number, integer, boolean]",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.tool.Lint()
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"iter"
+)
+
+// Remote llm backend that can stream the response while it is generated.
+type StreamingProvider interface {
+	Provider
+	// stream response chunks, the iteration ends after the last chunk or the first error.
+	ChatStream(ctx context.Context, req CCReq) iter.Seq2[Chunk, error]
+}
+
+// partial response from streaming provider.
+type Chunk struct {
+	ID    string
+	Model string
+	// text generated since previous chunk.
+	Text string
+	// thinking generated since previous chunk.
+	Thought string
+	// tool calls completed in this chunk.
+	ToolCalls []*ToolCall
+	// set in the last chunk.
+	FinishReason string
+	// usage of the whole response so far, the last reported one is used.
+	Usage *Usage
+}
+
+// collect streamed chunks into single response, onChunk is called for every chunk.
+func collectStream(seq iter.Seq2[Chunk, error], onChunk func(Chunk)) (*CCRes, error) {
+	res := &CCRes{Choices: []Choice{{}}}
+	choice := &res.Choices[0]
+	for chunk, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		if onChunk != nil {
+			onChunk(chunk)
+		}
+		if chunk.ID != "" {
+			res.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			res.Model = chunk.Model
+		}
+		choice.Text += chunk.Text
+		choice.Thought += chunk.Thought
+		choice.ToolCalls = append(choice.ToolCalls, chunk.ToolCalls...)
+		if chunk.FinishReason != "" {
+			choice.FinishReason = chunk.FinishReason
+		}
+		if chunk.Usage != nil {
+			res.Usage = *chunk.Usage
+		}
+	}
+	return res, nil
+}
+
+type EventType string
+
+const (
+	EventNodeStart EventType = "node_start"
+	EventNodeEnd   EventType = "node_end"
+	// the model request a tool call.
+	EventToolCall EventType = "tool_call"
+	// the tool call is executed.
+	EventToolResult EventType = "tool_result"
+	// partial text from streaming provider.
+	EventTextDelta EventType = "text_delta"
+	// partial thinking from streaming provider.
+	EventThoughtDelta EventType = "thought_delta"
+	// the run finished with final message.
+	EventFinal EventType = "final"
+	// the run failed or paused, see Err.
+	EventError EventType = "error"
+)
+
+// progress of the run, emitted while the graph is executed.
+type Event struct {
+	Type         EventType     `json:"type"`
+	RunID        string        `json:"run_id,omitempty"`
+	Node         string        `json:"node,omitempty"`
+	Text         string        `json:"text,omitempty"`
+	ToolCall     *ToolCall     `json:"tool_call,omitempty"`
+	ToolResponse *ToolResponse `json:"tool_response,omitempty"`
+	Message      *Message      `json:"message,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	// set in EventFinal.
+	Result *Result `json:"-"`
+	// original error of EventError, e.g *Interrupt.
+	Err error `json:"-"`
+}
+
+// receive events of the run, it may be called from multiple goroutine.
+type Emitter func(ev Event)
+
+type emitterKey struct{}
+
+// attach emitter into context, nodes emit their events to it.
+func WithEmitter(ctx context.Context, fn Emitter) context.Context {
+	return context.WithValue(ctx, emitterKey{}, fn)
+}
+
+func emitterFrom(ctx context.Context) (Emitter, bool) {
+	fn, ok := ctx.Value(emitterKey{}).(Emitter)
+	return fn, ok && fn != nil
+}
+
+// send event to the emitter in context, it does nothing if there is none.
+func Emit(ctx context.Context, ev Event) {
+	if fn, ok := emitterFrom(ctx); ok {
+		fn(ev)
+	}
+}
@@ -0,0 +1,154 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ agent.StreamingProvider = (*mockStreamProvider)(nil)
+
+// stream the chunks of each turn, indexed by number of messages in request.
+type mockStreamProvider struct {
+	mockProvider
+	turns map[int][]agent.Chunk
+}
+
+func (mp *mockStreamProvider) ChatStream(ctx context.Context, req agent.CCReq) iter.Seq2[agent.Chunk, error] {
+	return func(yield func(agent.Chunk, error) bool) {
+		chunks, ok := mp.turns[len(req.Messages)]
+		if !ok {
+			yield(agent.Chunk{}, errors.New("unexpected turn"))
+			return
+		}
+		for _, c := range chunks {
+			if !yield(c, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestAgent_CompletionStream(t *testing.T) {
+	provider := &mockStreamProvider{turns: map[int][]agent.Chunk{
+		1: {{ToolCalls: []*agent.ToolCall{
+			{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}},
+		}}},
+		3: {{Text: "message "}, {Text: "sent", FinishReason: "stop", Usage: &agent.Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10}}},
+	}}
+	tool := &countingTool{}
+	a := agent.New(provider, agent.WithTool(tool))
+
+	events, err := a.CompletionStream(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "send hello")})
+	require.NoError(t, err)
+
+	var types []agent.EventType
+	var text string
+	var final *agent.Message
+	var result *agent.Result
+	for ev := range events {
+		types = append(types, ev.Type)
+		switch ev.Type {
+		case agent.EventTextDelta:
+			text += ev.Text
+		case agent.EventToolCall:
+			assert.Equal(t, "send_message", ev.ToolCall.Function.Name)
+		case agent.EventToolResult:
+			assert.Equal(t, "call_1", ev.ToolResponse.ID)
+		case agent.EventFinal:
+			final = ev.Message
+			result = ev.Result
+		}
+	}
+
+	assert.Equal(t, []agent.EventType{
+		agent.EventNodeStart, agent.EventToolCall, agent.EventNodeEnd,
+		agent.EventNodeStart, agent.EventToolResult, agent.EventNodeEnd,
+		agent.EventNodeStart, agent.EventTextDelta, agent.EventTextDelta, agent.EventNodeEnd,
+		agent.EventFinal,
+	}, types)
+	assert.Equal(t, "message sent", text)
+	require.NotNil(t, final)
+	assert.Equal(t, "message sent", final.Text())
+	assert.Equal(t, int32(1), tool.calls.Load())
+	require.NotNil(t, result)
+	assert.Equal(t, agent.Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10}, result.Usage)
+}
+
+func TestAgent_CompletionStreamError(t *testing.T) {
+	provider := &mockStreamProvider{}
+	a := agent.New(provider)
+
+	events, err := a.CompletionStream(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hello")})
+	require.NoError(t, err)
+
+	var last agent.Event
+	for ev := range events {
+		last = ev
+	}
+	assert.Equal(t, agent.EventError, last.Type)
+	assert.ErrorContains(t, last.Err, "unexpected turn")
+}
+
+func TestAgent_CompletionStreamThought(t *testing.T) {
+	provider := &mockStreamProvider{turns: map[int][]agent.Chunk{
+		1: {{Thought: "user "}, {Thought: "greets"}, {Text: "hello", FinishReason: "stop"}},
+	}}
+	a := agent.New(provider)
+
+	events, err := a.CompletionStream(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")}, agent.WithThink(true))
+	require.NoError(t, err)
+
+	var thought, text string
+	var result *agent.Result
+	for ev := range events {
+		switch ev.Type {
+		case agent.EventThoughtDelta:
+			thought += ev.Text
+		case agent.EventTextDelta:
+			text += ev.Text
+		case agent.EventFinal:
+			result = ev.Result
+		}
+	}
+	assert.Equal(t, "user greets", thought)
+	assert.Equal(t, "hello", text)
+	require.NotNil(t, result)
+	assert.Equal(t, "hello", result.Text())
+	assert.Equal(t, "user greets", result.Reasoning())
+}
+
+func TestAgent_CompletionStreamRunID(t *testing.T) {
+	testCases := []struct {
+		name     string
+		turns    map[int][]agent.Chunk
+		expected agent.EventType
+	}{
+		{name: "final", turns: map[int][]agent.Chunk{1: {{Text: "hello", FinishReason: "stop"}}}, expected: agent.EventFinal},
+		{name: "error", expected: agent.EventError},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := agent.New(&mockStreamProvider{turns: tc.turns}, agent.WithCheckpointer(agent.NewMemoryCheckpointer()))
+			events, err := a.CompletionStream(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "hi")})
+			require.NoError(t, err)
+
+			// the run ID is generated by the checkpointer, every event carry it.
+			var first, last agent.Event
+			for ev := range events {
+				if first.Type == "" {
+					first = ev
+				}
+				last = ev
+			}
+			assert.Equal(t, tc.expected, last.Type)
+			assert.NotEmpty(t, first.RunID)
+			assert.Equal(t, first.RunID, last.RunID)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var _ ToolProvider = (*SubAgent)(nil)
+
+// expose an agent as tool, the calling agent delegate a task and get the final answer back.
+// the nested run has its own provider, instruction, tools and budget, its usage is added to the calling run.
+type SubAgent struct {
+	def         Tool
+	instruction string
+	agent       *Agent
+}
+
+// wrap the agent as tool named name, instruction is sent as system message of every nested run.
+func NewSubAgent(name, description, instruction string, a *Agent) (*SubAgent, error) {
+	if a == nil {
+		return nil, fmt.Errorf("sub agent '%s' has no agent", name)
+	}
+	def := Tool{
+		Type: "function",
+		Function: Function{
+			Name:        name,
+			Description: description,
+			Parameters: ParameterSchema{
+				Type: Parameter_Type_Object,
+				Properties: map[string]ParameterDefinition{
+					"task": {
+						Type:        Parameter_Type_String,
+						Description: "the task to delegate, include every detail needed because the agent does not see this conversation",
+					},
+				},
+				Required: []string{"task"},
+			},
+		},
+	}
+	if err := def.Lint(); err != nil {
+		return nil, fmt.Errorf("sub agent '%s' invalid definition: %w", name, err)
+	}
+	return &SubAgent{def: def, instruction: instruction, agent: a}, nil
+}
+
+func (sa *SubAgent) Def() Tool {
+	return sa.def
+}
+
+func (sa *SubAgent) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Call implements XTool.
+func (sa *SubAgent) Call(ctx context.Context, fc FunctionCall) (*ToolResponse, error) {
+	ctx, span := tracer.Start(ctx, "SubAgent.Call")
+	defer span.End()
+	span.SetAttributes(attribute.String("agent.name", sa.def.Function.Name))
+
+	var args struct {
+		Task string `json:"task"`
+	}
+	if err := json.Unmarshal([]byte(fc.Arguments), &args); err != nil {
+		return nil, fmt.Errorf("failed decode arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Task) == "" {
+		return nil, fmt.Errorf("task is empty")
+	}
+
+	msgs := []*Message{}
+	if sa.instruction != "" {
+		msgs = append(msgs, NewTextMessage(RoleSystem, sa.instruction))
+	}
+	msgs = append(msgs, NewTextMessage(RoleUser, args.Task))
+
+	opts := newCompletionOptions(nil)
+	graph, err := sa.agent.graph(opts)
+	if err != nil {
+		return nil, err
+	}
+	// events of the nested run are not part of the calling run stream.
+	state, err := sa.agent.runState(WithEmitter(ctx, nil), graph, msgs, opts)
+	// usage spent before the nested run failed is still counted.
+	AddUsage(ctx, state.Usage)
+	span.SetAttributes(attribute.Int("usage.total_tokens", int(state.Usage.TotalTokens)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ToolResponse{Name: fc.Name, Output: map[string]any{"answer": newResult(state).Text()}}, nil
+}
+
+// collect usage reported by tools while ToolNode execute them.
+type usageRecorder struct {
+	mx    sync.Mutex
+	usage Usage
+}
+
+type usageKey struct{}
+
+// report provider usage spent by a tool, e.g sub agent, it is added to the usage of the calling run.
+// it does nothing outside of tool call.
+func AddUsage(ctx context.Context, u Usage) {
+	rec, ok := ctx.Value(usageKey{}).(*usageRecorder)
+	if !ok {
+		return
+	}
+	rec.mx.Lock()
+	rec.usage = rec.usage.Add(u)
+	rec.mx.Unlock()
+}
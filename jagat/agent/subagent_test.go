@@ -0,0 +1,136 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubAgent(t *testing.T) {
+	var subReq agent.CCReq
+	sub := agent.New(&mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			subReq = req
+			return &agent.CCRes{
+				Choices: []agent.Choice{{Text: "Paris"}},
+				Usage:   agent.Usage{PromptTokens: 5, CompletionTokens: 1, TotalTokens: 6},
+			}, nil
+		},
+	})
+	research, err := agent.NewSubAgent("research", "find facts", "you are a researcher", sub)
+	require.NoError(t, err)
+
+	provider := &mockStreamProvider{turns: map[int][]agent.Chunk{
+		1: {{ToolCalls: []*agent.ToolCall{
+			{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "research", Arguments: `{"task":"capital of france"}`}},
+		}, Usage: &agent.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}}},
+		3: {{Text: "Paris", FinishReason: "stop", Usage: &agent.Usage{PromptTokens: 20, CompletionTokens: 1, TotalTokens: 21}}},
+	}}
+	a := agent.New(provider, agent.WithTool(research))
+
+	events, err := a.CompletionStream(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "what is the capital of france?")})
+	require.NoError(t, err)
+
+	var types []agent.EventType
+	var toolResp *agent.ToolResponse
+	var result *agent.Result
+	for ev := range events {
+		types = append(types, ev.Type)
+		switch ev.Type {
+		case agent.EventToolResult:
+			toolResp = ev.ToolResponse
+		case agent.EventFinal:
+			result = ev.Result
+		}
+	}
+
+	// events of the nested run are not streamed.
+	assert.Equal(t, []agent.EventType{
+		agent.EventNodeStart, agent.EventToolCall, agent.EventNodeEnd,
+		agent.EventNodeStart, agent.EventToolResult, agent.EventNodeEnd,
+		agent.EventNodeStart, agent.EventTextDelta, agent.EventNodeEnd,
+		agent.EventFinal,
+	}, types)
+
+	require.Len(t, subReq.Messages, 2)
+	assert.Equal(t, agent.RoleSystem, subReq.Messages[0].Role)
+	assert.Equal(t, "you are a researcher", subReq.Messages[0].Text())
+	assert.Equal(t, "capital of france", subReq.Messages[1].Text())
+
+	require.NotNil(t, toolResp)
+	assert.Equal(t, map[string]any{"answer": "Paris"}, toolResp.Output)
+
+	require.NotNil(t, result)
+	assert.Equal(t, agent.Usage{PromptTokens: 35, CompletionTokens: 4, TotalTokens: 39}, result.Usage)
+}
+
+func TestSubAgent_Call(t *testing.T) {
+	sub := agent.New(&mockProvider{})
+	research, err := agent.NewSubAgent("research", "find facts", "", sub)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		args     string
+		expected string
+	}{
+		{name: "no task", args: `{}`, expected: "task is empty"},
+		{name: "invalid json", args: `{`, expected: "failed decode arguments"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := research.Call(t.Context(), agent.FunctionCall{Name: "research", Arguments: tc.args})
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+
+	res, err := research.Call(t.Context(), agent.FunctionCall{Name: "research", Arguments: `{"task":"echo this"}`})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"answer": "echo this"}, res.Output)
+}
+
+func TestSubAgent_FailedUsage(t *testing.T) {
+	// the nested run call a tool then its provider fails.
+	sub := agent.New(&mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			if len(req.Messages) > 1 {
+				return nil, errors.New("provider unavailable")
+			}
+			return &agent.CCRes{
+				Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+					{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}},
+				}}},
+				Usage: agent.Usage{PromptTokens: 5, CompletionTokens: 1, TotalTokens: 6},
+			}, nil
+		},
+	}, agent.WithTool(&countingTool{}))
+	research, err := agent.NewSubAgent("research", "find facts", "", sub)
+	require.NoError(t, err)
+
+	var toolResp *agent.ToolResponse
+	provider := &mockProvider{
+		ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+			if len(req.Messages) == 1 {
+				return &agent.CCRes{
+					Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+						{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "research", Arguments: `{"task":"capital of france"}`}},
+					}}},
+					Usage: agent.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+				}, nil
+			}
+			toolResp = req.Messages[len(req.Messages)-1].Parts[0].ToolResponse
+			return &agent.CCRes{Choices: []agent.Choice{{Text: "unknown"}}}, nil
+		},
+	}
+	a := agent.New(provider, agent.WithTool(research))
+	res, err := a.Completion(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "what is the capital of france?")})
+	require.NoError(t, err)
+
+	require.NotNil(t, toolResp)
+	assert.Contains(t, toolResp.Output["error"], "provider unavailable")
+	assert.Equal(t, agent.Usage{PromptTokens: 15, CompletionTokens: 3, TotalTokens: 18}, res.Usage)
+}
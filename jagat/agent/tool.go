@@ -6,8 +6,14 @@ import (
 	"fmt"
 )
 
+// JSON Schema types of ParameterDefinition.
 const (
-	Parameter_Type_Object = "object"
+	Parameter_Type_Object  = "object"
+	Parameter_Type_Array   = "array"
+	Parameter_Type_String  = "string"
+	Parameter_Type_Number  = "number"
+	Parameter_Type_Integer = "integer"
+	Parameter_Type_Boolean = "boolean"
 )
 
 // hold the tools
@@ -41,6 +47,29 @@ func (t Tools) Invoke(ctx context.Context, fc FunctionCall) (*ToolResponse, erro
 	return nil, fmt.Errorf("tools not found")
 }
 
+// lookup tool provider by its function name.
+func (t Tools) Get(name string) (ToolProvider, bool) {
+	for _, tp := range t {
+		if tp.Def().Function.Name == name {
+			return tp, true
+		}
+	}
+	return nil, false
+}
+
+// return only the named tools, it errors if some name is not found.
+func (t Tools) Only(names ...string) (Tools, error) {
+	subset := Tools{}
+	for _, name := range names {
+		tp, ok := t.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("tool '%s' not found", name)
+		}
+		subset = append(subset, tp)
+	}
+	return subset, nil
+}
+
 func (tp Tools) Def() []Tool {
 	copyDef := make([]Tool, len(tp))
 	for i := range tp {
@@ -78,10 +107,35 @@ type ParameterSchema struct {
 }
 
 // ParameterDefinition defines each individual parameter in the schema.
+// it is a JSON Schema subset, nested object and array element are defined recursively.
 type ParameterDefinition struct {
-	Type        string   `json:"type"`
+	// one of Parameter_Type_*, it may be empty if OneOf is set.
+	Type        string   `json:"type,omitempty"`
 	Description string   `json:"description,omitempty"`
 	Enum        []string `json:"enum,omitempty"`
+	// e.g "date-time", "date" or "email", only for string.
+	Format string `json:"format,omitempty"`
+	// value used by the tool when the argument is omitted.
+	Default any `json:"default,omitempty"`
+
+	// element of array.
+	Items *ParameterDefinition `json:"items,omitempty"`
+	// fields of object.
+	Properties map[string]ParameterDefinition `json:"properties,omitempty"`
+	Required   []string                       `json:"required,omitempty"`
+
+	// inclusive bounds of number and integer.
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// bounds of string length.
+	MinLength *int `json:"minLength,omitempty"`
+	MaxLength *int `json:"maxLength,omitempty"`
+	// bounds of array length.
+	MinItems *int `json:"minItems,omitempty"`
+	MaxItems *int `json:"maxItems,omitempty"`
+
+	// value must match exactly one of the definitions.
+	OneOf []ParameterDefinition `json:"oneOf,omitempty"`
 }
 
 // ToolCall represents one entry in the "tool_calls" array.
@@ -93,10 +147,12 @@ type ToolCall struct {
 
 // ToolResponse represent tool response entry in the message
 type ToolResponse struct {
+	//ID of the tool call this response is for
+	ID string `json:"id"`
 	//Tool name
-	Name string
+	Name string `json:"name"`
 	// Tool response
-	Output map[string]any
+	Output map[string]any `json:"output"`
 }
 
 func (tr ToolResponse) String() string {
@@ -22,6 +22,9 @@ type Config struct {
 	//set true if tool need to make ping when it's build.
 	//see agent.ToolProvider for interface.
 	DisablePing bool
+	//set true if every call of the tool must be approved by human before executed.
+	//see agent.ApprovalNode.
+	RequireApproval bool
 	//extra option that tool provider may need.
 	Options map[string]any
 }
@@ -72,6 +75,9 @@ func Build(ctx context.Context, cfgs []Config) ([]agent.ToolProvider, error) {
 			if err != nil {
 				return nil, fmt.Errorf("tool_provider err: %w", err)
 			}
+			if err := p.Def().Lint(); err != nil {
+				return nil, fmt.Errorf("tool_provider '%s' invalid definition: %w", cfg.Name, err)
+			}
 			toBuild = append(toBuild, providerToBuild{provider: p, config: cfg})
 		} else {
 			slog.Warn("tool provider initiated but not available, forget to register ?")
@@ -93,6 +99,9 @@ func Build(ctx context.Context, cfgs []Config) ([]agent.ToolProvider, error) {
 		}
 
 		//add tool
+		if item.config.RequireApproval {
+			item.provider = agent.RequireApproval(item.provider)
+		}
 		t = append(t, item.provider)
 		slog.Debug("tool initate", "name", item.config.Name, "address", item.config.Endpoint)
 	}
@@ -28,10 +28,14 @@ var definition = agent.Tool{
 			Type: agent.Parameter_Type_Object,
 			Properties: map[string]agent.ParameterDefinition{
 				"latitude": {
-					Type: "float",
+					Type:    agent.Parameter_Type_Number,
+					Minimum: ptr(-90.0),
+					Maximum: ptr(90.0),
 				},
 				"longitude": {
-					Type: "float",
+					Type:    agent.Parameter_Type_Number,
+					Minimum: ptr(-180.0),
+					Maximum: ptr(180.0),
 				},
 			},
 			Required: []string{"latitude", "longitude"},
@@ -39,6 +43,10 @@ var definition = agent.Tool{
 	},
 }
 
+func ptr[T any](v T) *T {
+	return &v
+}
+
 func init() {
 	tooldef.Register(Namespace, NewWeatherTool)
 }
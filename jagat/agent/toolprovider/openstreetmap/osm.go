@@ -46,14 +46,17 @@ func (osm *OsmTool) Call(ctx context.Context, fc agent.FunctionCall) (*agent.Too
 		return &toolresponse, nil
 	}
 
-	param := map[string]string{}
+	// arguments is validated by the agent, other fields does not break the decoding.
+	var param struct {
+		Address string `json:"address"`
+	}
 	if err := json.Unmarshal([]byte(fc.Arguments), &param); err != nil {
 		toolresponse.Output["error"] = "wrong format arguemnts, expected {address : location_name}"
 		return &toolresponse, nil
 	}
 
-	arg, ok := param["address"]
-	if !ok {
+	arg := param.Address
+	if arg == "" {
 		toolresponse.Output["error"] = "wrong format argument, address cannot be empty"
 		return &toolresponse, nil
 	}
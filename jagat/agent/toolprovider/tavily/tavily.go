@@ -25,6 +25,9 @@ func init() {
 	tooldef.Register("tavily", NewToolProvider)
 }
 
+// bounds of max_results.
+var minResults, maxResults = 1.0, 3.0
+
 var definition = agent.Tool{
 	Type: "function",
 	Function: agent.Function{
@@ -41,10 +44,13 @@ var definition = agent.Tool{
 					Type:        "string",
 					Description: "The depth of the search. Can be 'basic' or 'advanced'. Defaults to 'basic'.",
 					Enum:        []string{"basic", "advanced"},
+					Default:     "basic",
 				},
 				"max_results": {
 					Type:        "integer",
 					Description: "The maximum number of search results to return. Must be between 1 and 3.", // Provide constraints
+					Minimum:     &minResults,
+					Maximum:     &maxResults,
 				},
 			},
 			Required: []string{"query"},
@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ ToolProvider = (*TypedTool[struct{}, any])(nil)
+
+// tool backed by go function, the schema is derived from Args and the arguments are decoded into it.
+type TypedTool[Args, Result any] struct {
+	def Tool
+	fn  func(ctx context.Context, args Args) (Result, error)
+}
+
+// build tool from function, Args must be a struct, its fields become the tool parameters.
+// field tags:
+//
+//	json:"name,omitempty"  parameter name, "-" skip the field.
+//	description:"..."      parameter description.
+//	enum:"a,b,c"           allowed values of string.
+//	required:"true"        parameter must be present.
+//	format:"date-time"     string format, time.Time is date-time by default.
+//	minimum:"1" maximum:"3" inclusive bounds of number.
+//
+// Result is returned as ToolResponse.Output, a value that is not JSON object is wrapped as {"result": value}.
+func NewTypedTool[Args, Result any](name, description string, fn func(ctx context.Context, args Args) (Result, error)) (*TypedTool[Args, Result], error) {
+	if fn == nil {
+		return nil, fmt.Errorf("typed tool '%s' function is nil", name)
+	}
+	schema, err := schemaOf(reflect.TypeFor[Args]())
+	if err != nil {
+		return nil, fmt.Errorf("typed tool '%s' failed derive schema: %w", name, err)
+	}
+
+	def := Tool{
+		Type: "function",
+		Function: Function{
+			Name:        name,
+			Description: description,
+			Parameters:  schema,
+		},
+	}
+	if err := def.Lint(); err != nil {
+		return nil, fmt.Errorf("typed tool '%s' invalid schema: %w", name, err)
+	}
+	return &TypedTool[Args, Result]{def: def, fn: fn}, nil
+}
+
+func (tt *TypedTool[Args, Result]) Def() Tool {
+	return tt.def
+}
+
+func (tt *TypedTool[Args, Result]) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Call implements XTool.
+func (tt *TypedTool[Args, Result]) Call(ctx context.Context, fc FunctionCall) (*ToolResponse, error) {
+	if err := tt.def.Function.ValidateArguments(fc.Arguments); err != nil {
+		return nil, err
+	}
+	var args Args
+	raw := fc.Arguments
+	if strings.TrimSpace(raw) == "" {
+		raw = "{}"
+	}
+	value, err := decodeJSON([]byte(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed decode arguments: %w", err)
+	}
+	b, err := json.Marshal(plainIntegers(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed decode arguments: %w", err)
+	}
+	if err := json.Unmarshal(b, &args); err != nil {
+		return nil, fmt.Errorf("failed decode arguments: %w", err)
+	}
+
+	result, err := tt.fn(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	output, err := toOutput(result)
+	if err != nil {
+		return nil, err
+	}
+	return &ToolResponse{Name: fc.Name, Output: output}, nil
+}
+
+// integer written with fraction or exponent, e.g 3.0, is valid integer for the schema
+// but json does not decode it into go integer, so it is rewritten as 3.
+func plainIntegers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = plainIntegers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = plainIntegers(e)
+		}
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			return v
+		}
+		f, err := v.Float64()
+		if err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return json.Number(strconv.FormatInt(int64(f), 10))
+		}
+	}
+	return v
+}
+
+// convert the result into tool output through JSON, so the output look the same after checkpoint.
+func toOutput(result any) (map[string]any, error) {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed encode result: %w", err)
+	}
+	var output map[string]any
+	if err := json.Unmarshal(b, &output); err == nil && output != nil {
+		return output, nil
+	}
+	var value any
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil, fmt.Errorf("failed encode result: %w", err)
+	}
+	return map[string]any{"result": value}, nil
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func schemaOf(t reflect.Type) (ParameterSchema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ParameterSchema{}, fmt.Errorf("arguments must be struct, got %s", t)
+	}
+	def, err := definitionOf(t, map[reflect.Type]bool{})
+	if err != nil {
+		return ParameterSchema{}, err
+	}
+	return ParameterSchema{
+		Type:       Parameter_Type_Object,
+		Properties: def.Properties,
+		Required:   def.Required,
+	}, nil
+}
+
+// derive definition of go type, seen guard against recursive struct.
+func definitionOf(t reflect.Type, seen map[reflect.Type]bool) (ParameterDefinition, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return ParameterDefinition{Type: Parameter_Type_String, Format: "date-time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return ParameterDefinition{Type: Parameter_Type_String}, nil
+	case reflect.Bool:
+		return ParameterDefinition{Type: Parameter_Type_Boolean}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ParameterDefinition{Type: Parameter_Type_Integer}, nil
+	case reflect.Float32, reflect.Float64:
+		return ParameterDefinition{Type: Parameter_Type_Number}, nil
+
+	case reflect.Slice, reflect.Array:
+		// json encode []byte as base64 string.
+		if t.Elem().Kind() == reflect.Uint8 {
+			return ParameterDefinition{Type: Parameter_Type_String}, nil
+		}
+		items, err := definitionOf(t.Elem(), seen)
+		if err != nil {
+			return ParameterDefinition{}, err
+		}
+		return ParameterDefinition{Type: Parameter_Type_Array, Items: &items}, nil
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return ParameterDefinition{}, fmt.Errorf("map key must be string, got %s", t)
+		}
+		return ParameterDefinition{Type: Parameter_Type_Object}, nil
+
+	case reflect.Struct:
+		if seen[t] {
+			return ParameterDefinition{}, fmt.Errorf("recursive type %s is not supported", t)
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		def := ParameterDefinition{Type: Parameter_Type_Object, Properties: map[string]ParameterDefinition{}}
+		if err := addFields(&def, t, seen); err != nil {
+			return ParameterDefinition{}, err
+		}
+		return def, nil
+
+	default:
+		return ParameterDefinition{}, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// add exported fields of struct as properties, embedded struct is flattened like json does.
+func addFields(def *ParameterDefinition, t reflect.Type, seen map[reflect.Type]bool) error {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			if err := addFields(def, ft, seen); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop, err := definitionOf(f.Type, seen)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if err := applyTags(&prop, f.Tag); err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		def.Properties[name] = prop
+		if f.Tag.Get("required") == "true" {
+			def.Required = append(def.Required, name)
+		}
+	}
+	return nil
+}
+
+func applyTags(def *ParameterDefinition, tag reflect.StructTag) error {
+	def.Description = tag.Get("description")
+	if enum := tag.Get("enum"); enum != "" {
+		def.Enum = strings.Split(enum, ",")
+	}
+	if format := tag.Get("format"); format != "" {
+		def.Format = format
+	}
+	for key, bound := range map[string]**float64{"minimum": &def.Minimum, "maximum": &def.Maximum} {
+		v := tag.Get(key)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s tag '%s'", key, v)
+		}
+		*bound = &f
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Paging struct {
+	Limit int `json:"limit,omitempty" description:"max results" minimum:"1" maximum:"3"`
+}
+
+type searchArgs struct {
+	Query string    `json:"query" description:"search query" required:"true"`
+	Depth string    `json:"search_depth,omitempty" enum:"basic,advanced"`
+	Tags  []string  `json:"tags,omitempty"`
+	Since time.Time `json:"since,omitzero"`
+	Near  *struct {
+		Lat float64 `json:"lat" required:"true"`
+		Lon float64 `json:"lon" required:"true"`
+	} `json:"near,omitempty"`
+	Paging
+	Secret string `json:"-"`
+	hidden string
+}
+
+type searchResult struct {
+	Titles []string `json:"titles"`
+}
+
+func TestNewTypedTool(t *testing.T) {
+	var got searchArgs
+	tool, err := agent.NewTypedTool("web_search", "search the web", func(ctx context.Context, args searchArgs) (searchResult, error) {
+		got = args
+		return searchResult{Titles: []string{"go.dev"}}, nil
+	})
+	require.NoError(t, err)
+
+	def := tool.Def()
+	assert.Equal(t, "web_search", def.Function.Name)
+	assert.Equal(t, agent.ParameterSchema{
+		Type: agent.Parameter_Type_Object,
+		Properties: map[string]agent.ParameterDefinition{
+			"query":        {Type: "string", Description: "search query"},
+			"search_depth": {Type: "string", Enum: []string{"basic", "advanced"}},
+			"tags":         {Type: "array", Items: &agent.ParameterDefinition{Type: "string"}},
+			"since":        {Type: "string", Format: "date-time"},
+			"near": {Type: "object", Properties: map[string]agent.ParameterDefinition{
+				"lat": {Type: "number"},
+				"lon": {Type: "number"},
+			}, Required: []string{"lat", "lon"}},
+			"limit": {Type: "integer", Description: "max results", Minimum: ptr(1.0), Maximum: ptr(3.0)},
+		},
+		Required: []string{"query"},
+	}, def.Function.Parameters)
+
+	res, err := tool.Call(t.Context(), agent.FunctionCall{Name: "web_search", Arguments: `{"query":"go","limit":2,"near":{"lat":1.5,"lon":2}}`})
+	require.NoError(t, err)
+	assert.Equal(t, "go", got.Query)
+	assert.Equal(t, 2, got.Limit)
+	require.NotNil(t, got.Near)
+	assert.Equal(t, 1.5, got.Near.Lat)
+	assert.Equal(t, map[string]any{"titles": []any{"go.dev"}}, res.Output)
+
+	// integer with zero fraction is valid and decoded.
+	_, err = tool.Call(t.Context(), agent.FunctionCall{Name: "web_search", Arguments: `{"query":"go","limit":3.0,"near":{"lat":1.0,"lon":2e0}}`})
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.Limit)
+	assert.Equal(t, 1.0, got.Near.Lat)
+
+	_, err = tool.Call(t.Context(), agent.FunctionCall{Name: "web_search", Arguments: `{"limit":5}`})
+	var argErr *agent.ArgumentError
+	require.ErrorAs(t, err, &argErr)
+	assert.Equal(t, []string{"query: is required", "limit: must be <= 3, got 5"}, argErr.Problems)
+}
+
+func TestNewTypedTool_Result(t *testing.T) {
+	tool, err := agent.NewTypedTool("count", "", func(ctx context.Context, args struct{}) (int, error) {
+		return 3, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, agent.ParameterSchema{Type: "object", Properties: map[string]agent.ParameterDefinition{}}, tool.Def().Function.Parameters)
+
+	res, err := tool.Call(t.Context(), agent.FunctionCall{Name: "count"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"result": float64(3)}, res.Output)
+
+	failing, err := agent.NewTypedTool("fail", "", func(ctx context.Context, args struct{}) (any, error) {
+		return nil, errors.New("boom")
+	})
+	require.NoError(t, err)
+	_, err = failing.Call(t.Context(), agent.FunctionCall{Name: "fail", Arguments: `{}`})
+	assert.EqualError(t, err, "boom")
+}
+
+type node struct {
+	Children []node `json:"children"`
+}
+
+func TestNewTypedTool_InvalidArgs(t *testing.T) {
+	_, err := agent.NewTypedTool("bad", "", func(ctx context.Context, args string) (any, error) { return nil, nil })
+	assert.EqualError(t, err, "typed tool 'bad' failed derive schema: arguments must be struct, got string")
+
+	_, err = agent.NewTypedTool("bad", "", func(ctx context.Context, args struct{ C chan int }) (any, error) { return nil, nil })
+	assert.EqualError(t, err, "typed tool 'bad' failed derive schema: field C: unsupported type chan int")
+
+	_, err = agent.NewTypedTool("bad", "", func(ctx context.Context, args node) (any, error) { return nil, nil })
+	assert.EqualError(t, err, "typed tool 'bad' failed derive schema: field Children: recursive type agent_test.node is not supported")
+
+	_, err = agent.NewTypedTool("bad", "", func(ctx context.Context, args struct {
+		N int `minimum:"one"`
+	}) (any, error) {
+		return nil, nil
+	})
+	assert.EqualError(t, err, "typed tool 'bad' failed derive schema: field N: invalid minimum tag 'one'")
+}
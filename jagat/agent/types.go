@@ -14,32 +14,51 @@ const (
 	RoleTool      Role = "tool"
 )
 
+// type of Part in the wire format, see MessageVersion.
 const (
 	TextPart     = "text"
+	ThoughtPart  = "thought"
 	BlobPart     = "blob"
-	ToolCallPart = "toolcall"
-	ToolRespPart = "toolresp"
+	ToolCallPart = "tool_call"
+	ToolRespPart = "tool_response"
 )
 
 type Messages []*Message
 
+// value of CCReq.ToolChoice, other value is the name of the tool that must be called.
+const (
+	// model decides whether to call tools, default.
+	ToolChoiceAuto = "auto"
+	// model must not call tools.
+	ToolChoiceNone = "none"
+	// model must call at least one tool.
+	ToolChoiceRequired = "required"
+)
+
 // ChatCompletionRequest use for communicating with provider
 type CCReq struct {
 	// Model      string
-	Messages   []*Message
-	Stream     bool
-	Think      bool
-	Tools      []Tool
+	Messages []*Message
+	Stream   bool
+	// ask the model to think before answering, the thinking is returned in Choice.Thought.
+	Think bool
+	Tools []Tool
+	// "auto", "none", "required" or name of the tool that must be called, empty means auto.
 	ToolChoice string
+	// override the configured temperature if not nil.
+	Temperature *float32
+	// constrain the answer to JSON matching the schema if not nil.
+	// providers may ignore it when the request has tools.
+	ResponseSchema *ParameterDefinition
 }
 
 // represent single message in conversation or history.
 // it compose from multiple part of diferrent kind.
 type Message struct {
 	// the role of sender message
-	Role Role
-	// each part only have one field filled and should turn error if more.
-	Parts []*Part
+	Role Role `json:"role"`
+	// each part only have one field filled, see Part.Validate.
+	Parts []*Part `json:"parts"`
 }
 
 func (m *Message) ToolCall() (*ToolCall, bool) {
@@ -51,6 +70,17 @@ func (m *Message) ToolCall() (*ToolCall, bool) {
 	return nil, false
 }
 
+// return all tool calls in message.
+func (m *Message) ToolCalls() []*ToolCall {
+	tcs := []*ToolCall{}
+	for _, p := range m.Parts {
+		if p.Toolcall != nil {
+			tcs = append(tcs, p.Toolcall)
+		}
+	}
+	return tcs
+}
+
 func (m *Message) Text() string {
 	texts := []string{}
 	for _, p := range m.Parts {
@@ -61,6 +91,17 @@ func (m *Message) Text() string {
 	return strings.Join(texts, "")
 }
 
+// thinking of the model, it is not part of Text.
+func (m *Message) Thought() string {
+	thoughts := []string{}
+	for _, p := range m.Parts {
+		if p.Thought != "" {
+			thoughts = append(thoughts, p.Thought)
+		}
+	}
+	return strings.Join(thoughts, "")
+}
+
 func NewPartToolCall(name, arg string) *Part {
 	return &Part{
 		Toolcall: &ToolCall{
@@ -69,11 +110,20 @@ func NewPartToolCall(name, arg string) *Part {
 	}
 }
 
+// single piece of message, only one field is filled.
+// it is encoded as JSON object tagged by type, see MessageVersion.
 type Part struct {
-	Text         string
+	Text string
+	// reasoning of the model before the answer, providers do not send it back in history.
+	Thought      string
 	Blob         *Blob
 	Toolcall     *ToolCall
 	ToolResponse *ToolResponse
+
+	// problem found while decoding the part, reported by Validate.
+	problem string
+	// decoded from the legacy shape without type.
+	legacy bool
 }
 
 // represent inline raw binary data in message.
@@ -108,14 +158,33 @@ func (res *CCRes) IsToolCall() ([]*ToolCall, bool) {
 
 // choice represent single response from provider.
 type Choice struct {
-	Index        int
-	Text         string
+	Index int
+	Text  string
+	// thinking of the model, set if the provider return it separately.
+	Thought      string
 	ToolCalls    []*ToolCall
 	FinishReason string
 }
 
+// token count reported by provider.
 type Usage struct {
-	PromptTokens     int32 `json:"prompt_tokens"`
+	PromptTokens int32 `json:"prompt_tokens"`
+	// include thinking tokens.
 	CompletionTokens int32 `json:"completion_tokens"`
 	TotalTokens      int32 `json:"total_tokens"`
+	// part of prompt tokens served from provider cache.
+	CachedTokens int32 `json:"cached_tokens,omitempty"`
+	// part of completion tokens used for thinking.
+	ThinkingTokens int32 `json:"thinking_tokens,omitempty"`
+}
+
+// sum of both usage.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+		CachedTokens:     u.CachedTokens + other.CachedTokens,
+		ThinkingTokens:   u.ThinkingTokens + other.ThinkingTokens,
+	}
 }
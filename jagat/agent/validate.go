@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// returned when tool call arguments do not match the tool ParameterSchema.
+type ArgumentError struct {
+	Tool string
+	// each problem is prefixed by the argument path, e.g "location.city" or "ids[0]".
+	Problems []string
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("invalid arguments of tool '%s': %s", e.Tool, strings.Join(e.Problems, "; "))
+}
+
+// check the raw JSON arguments against the parameter schema: required fields, types, enums, bounds, formats and oneOf.
+// function without schema accept any arguments.
+func (f Function) ValidateArguments(arguments string) error {
+	schema := f.Parameters
+	if schema.isEmpty() {
+		return nil
+	}
+
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	args, err := decodeJSON([]byte(arguments))
+	if _, ok := args.(map[string]any); err != nil || !ok {
+		return &ArgumentError{Tool: f.Name, Problems: []string{"arguments must be JSON object"}}
+	}
+
+	if problems := schema.definition().validate("", args); len(problems) > 0 {
+		return &ArgumentError{Tool: f.Name, Problems: problems}
+	}
+	return nil
+}
+
+// decode JSON keeping the numbers as json.Number, so integer can be told apart.
+// b must hold single JSON value, data after it is an error.
+func decodeJSON(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// list why value does not match the definition, empty if it match.
+func (pd ParameterDefinition) validate(path string, value any) []string {
+	problems := []string{}
+	fail := func(format string, args ...any) []string {
+		name := path
+		if name == "" {
+			name = "arguments"
+		}
+		return append(problems, name+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(pd.OneOf) > 0 {
+		matched := 0
+		for _, alt := range pd.OneOf {
+			if len(alt.validate(path, value)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fail("must match exactly one of %d schemas, matched %d", len(pd.OneOf), matched)
+		}
+	}
+
+	switch pd.Type {
+	case Parameter_Type_String:
+		s, ok := value.(string)
+		if !ok {
+			return fail("must be string, got %s", jsonType(value))
+		}
+		if len(pd.Enum) > 0 && !slices.Contains(pd.Enum, s) {
+			return fail("must be one of [%s], got %q", strings.Join(pd.Enum, ", "), s)
+		}
+		n := len([]rune(s))
+		if pd.MinLength != nil && n < *pd.MinLength {
+			problems = fail("must be at least %d characters", *pd.MinLength)
+		}
+		if pd.MaxLength != nil && n > *pd.MaxLength {
+			problems = fail("must be at most %d characters", *pd.MaxLength)
+		}
+		if pd.Format != "" && !validFormat(pd.Format, s) {
+			problems = fail("must be %s format, got %q", pd.Format, s)
+		}
+
+	case Parameter_Type_Number, Parameter_Type_Integer:
+		n, ok := value.(json.Number)
+		if !ok {
+			return fail("must be %s, got %s", pd.Type, jsonType(value))
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return fail("must be %s, got %s", pd.Type, n)
+		}
+		if pd.Type == Parameter_Type_Integer && f != math.Trunc(f) {
+			return fail("must be integer, got %s", n)
+		}
+		if pd.Minimum != nil && f < *pd.Minimum {
+			problems = fail("must be >= %v, got %s", *pd.Minimum, n)
+		}
+		if pd.Maximum != nil && f > *pd.Maximum {
+			problems = fail("must be <= %v, got %s", *pd.Maximum, n)
+		}
+
+	case Parameter_Type_Boolean:
+		if _, ok := value.(bool); !ok {
+			return fail("must be boolean, got %s", jsonType(value))
+		}
+
+	case Parameter_Type_Array:
+		items, ok := value.([]any)
+		if !ok {
+			return fail("must be array, got %s", jsonType(value))
+		}
+		if pd.MinItems != nil && len(items) < *pd.MinItems {
+			problems = fail("must have at least %d items", *pd.MinItems)
+		}
+		if pd.MaxItems != nil && len(items) > *pd.MaxItems {
+			problems = fail("must have at most %d items", *pd.MaxItems)
+		}
+		if pd.Items != nil {
+			for i, item := range items {
+				problems = append(problems, pd.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+
+	case Parameter_Type_Object:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fail("must be object, got %s", jsonType(value))
+		}
+		for _, name := range pd.Required {
+			if v, ok := obj[name]; !ok || v == nil {
+				problems = append(problems, fmt.Sprintf("%s: is required", joinPath(path, name)))
+			}
+		}
+		// sorted so the error is stable for the model and tests.
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			def, ok := pd.Properties[name]
+			if !ok || obj[name] == nil {
+				continue
+			}
+			problems = append(problems, def.validate(joinPath(path, name), obj[name])...)
+		}
+	}
+	return problems
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// string formats that are checked, other format is only a hint for the model.
+var stringFormats = []string{"date-time", "date", "time", "email", "uri", "uuid"}
+
+func validFormat(format, s string) bool {
+	var err error
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, s)
+	case "date":
+		_, err = time.Parse(time.DateOnly, s)
+	case "time":
+		_, err = time.Parse(time.TimeOnly, s)
+	case "email":
+		_, err = mail.ParseAddress(s)
+	case "uri":
+		var u *url.URL
+		if u, err = url.Parse(s); err == nil && u.Scheme == "" {
+			return false
+		}
+	case "uuid":
+		return uuidPattern.MatchString(s)
+	}
+	return err == nil
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return "null"
+	}
+}
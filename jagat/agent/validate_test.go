@@ -0,0 +1,197 @@
+package agent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var searchFunction = agent.Function{
+	Name: "web_search",
+	Parameters: agent.ParameterSchema{
+		Type: agent.Parameter_Type_Object,
+		Properties: map[string]agent.ParameterDefinition{
+			"query":        {Type: "string"},
+			"search_depth": {Type: "string", Enum: []string{"basic", "advanced"}},
+			"max_results":  {Type: "integer"},
+			"safe":         {Type: "boolean"},
+			"score":        {Type: "number"},
+		},
+		Required: []string{"query"},
+	},
+}
+
+func TestFunction_ValidateArguments(t *testing.T) {
+	testCases := []struct {
+		name      string
+		arguments string
+		problems  []string
+	}{
+		{name: "valid", arguments: `{"query":"go","search_depth":"basic","max_results":3,"safe":true,"score":0.5}`},
+		{name: "unknown field is ignored", arguments: `{"query":"go","lang":"en"}`},
+		{name: "integer with zero fraction", arguments: `{"query":"go","max_results":2.0}`},
+		{name: "empty arguments", arguments: ``, problems: []string{"query: is required"}},
+		{name: "null required", arguments: `{"query":null}`, problems: []string{"query: is required"}},
+		{name: "not object", arguments: `["go"]`, problems: []string{"arguments must be JSON object"}},
+		{name: "trailing data", arguments: `{"query":"go"} {}`, problems: []string{"arguments must be JSON object"}},
+		{
+			name:      "wrong types",
+			arguments: `{"query":1,"max_results":"3","safe":"yes","score":"high"}`,
+			problems: []string{
+				"max_results: must be integer, got string",
+				"query: must be string, got number",
+				"safe: must be boolean, got string",
+				"score: must be number, got string",
+			},
+		},
+		{name: "fraction integer", arguments: `{"query":"go","max_results":2.5}`, problems: []string{"max_results: must be integer, got 2.5"}},
+		{name: "enum", arguments: `{"query":"go","search_depth":"deep"}`, problems: []string{`search_depth: must be one of [basic, advanced], got "deep"`}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := searchFunction.ValidateArguments(tc.arguments)
+			if tc.problems == nil {
+				require.NoError(t, err)
+				return
+			}
+			var argErr *agent.ArgumentError
+			require.ErrorAs(t, err, &argErr)
+			assert.Equal(t, "web_search", argErr.Tool)
+			assert.Equal(t, tc.problems, argErr.Problems)
+		})
+	}
+
+	assert.NoError(t, agent.Function{Name: "no_schema"}.ValidateArguments(`{"any":1}`))
+}
+
+func TestFunction_ValidateNestedArguments(t *testing.T) {
+	fn := agent.Function{
+		Name: "create_event",
+		Parameters: agent.ParameterSchema{
+			Type: agent.Parameter_Type_Object,
+			Properties: map[string]agent.ParameterDefinition{
+				"title": {Type: "string", MinLength: ptr(1), MaxLength: ptr(10)},
+				"start": {Type: "string", Format: "date-time"},
+				"guests": {Type: "array", MaxItems: ptr(2), Items: &agent.ParameterDefinition{
+					Type: "object",
+					Properties: map[string]agent.ParameterDefinition{
+						"email": {Type: "string", Format: "email"},
+						"age":   {Type: "integer", Minimum: ptr(0.0)},
+					},
+					Required: []string{"email"},
+				}},
+				"room": {OneOf: []agent.ParameterDefinition{
+					{Type: "integer"},
+					{Type: "string", Enum: []string{"hall", "garden"}},
+				}},
+			},
+			Required: []string{"title"},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		arguments string
+		problems  []string
+	}{
+		{name: "valid", arguments: `{"title":"party","start":"2026-01-02T15:04:05Z","guests":[{"email":"a@b.c","age":3}],"room":"hall"}`},
+		{name: "oneOf integer", arguments: `{"title":"party","room":2}`},
+		{
+			name:      "string bounds and format",
+			arguments: `{"title":"","start":"tomorrow"}`,
+			problems:  []string{"start: must be date-time format, got \"tomorrow\"", "title: must be at least 1 characters"},
+		},
+		{
+			name:      "array items",
+			arguments: `{"title":"party","guests":[{"age":-1},{"email":"nope"},{"email":"a@b.c"}]}`,
+			problems: []string{
+				"guests: must have at most 2 items",
+				"guests[0].email: is required",
+				"guests[0].age: must be >= 0, got -1",
+				"guests[1].email: must be email format, got \"nope\"",
+			},
+		},
+		{name: "oneOf no match", arguments: `{"title":"party","room":"roof"}`, problems: []string{"room: must match exactly one of 2 schemas, matched 0"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := fn.ValidateArguments(tc.arguments)
+			if tc.problems == nil {
+				require.NoError(t, err)
+				return
+			}
+			var argErr *agent.ArgumentError
+			require.ErrorAs(t, err, &argErr)
+			assert.Equal(t, tc.problems, argErr.Problems)
+		})
+	}
+}
+
+type searchTool struct {
+	countingTool
+}
+
+func (st *searchTool) Def() agent.Tool {
+	return agent.Tool{Type: "function", Function: searchFunction}
+}
+
+func TestAgent_InvalidArguments(t *testing.T) {
+	problems := []string{"query: is required", "max_results: must be integer, got string"}
+	limit := map[string]any{"error": "invalid arguments, retry limit is reached, do not call this tool again", "problems": problems}
+	testCases := []struct {
+		name     string
+		opts     []agent.OptionFunc
+		expected []map[string]any
+	}{
+		{
+			name: "default",
+			expected: []map[string]any{
+				{"error": "invalid arguments", "problems": problems, "retries_left": 2},
+				{"error": "invalid arguments", "problems": problems, "retries_left": 1},
+				limit,
+				{"error": "tool 'web_search' is not available anymore after 3 calls with invalid arguments"},
+			},
+		},
+		{
+			name: "no retry",
+			opts: []agent.OptionFunc{agent.WithArgumentRetries(0)},
+			expected: []map[string]any{
+				limit,
+				{"error": "tool 'web_search' is not available anymore after 1 calls with invalid arguments"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// keep calling the tool with invalid arguments.
+			var responses []map[string]any
+			provider := &mockProvider{
+				ChatFunc: func(ctx context.Context, req agent.CCReq) (*agent.CCRes, error) {
+					last := req.Messages[len(req.Messages)-1]
+					if last.Role == agent.RoleTool {
+						responses = append(responses, last.Parts[0].ToolResponse.Output)
+					}
+					if len(responses) == len(tc.expected) {
+						return &agent.CCRes{Choices: []agent.Choice{{Text: "give up"}}}, nil
+					}
+					return &agent.CCRes{Choices: []agent.Choice{{ToolCalls: []*agent.ToolCall{
+						{ID: "call", Type: "function", Function: agent.FunctionCall{Name: "web_search", Arguments: `{"max_results":"3"}`}},
+					}}}}, nil
+				},
+			}
+			tool := &searchTool{}
+			a := agent.New(provider, append(tc.opts, agent.WithTool(tool))...)
+
+			res, err := a.Completion(t.Context(), []*agent.Message{agent.NewTextMessage(agent.RoleUser, "search go")})
+			require.NoError(t, err)
+			assert.Equal(t, "give up", res.Text())
+			assert.Equal(t, int32(0), tool.calls.Load())
+			assert.Equal(t, tc.expected, responses)
+		})
+	}
+}
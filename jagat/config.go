@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"path/filepath"
+	"time"
 
+	"github.com/odit-bit/jagatai/jagat/agent"
 	"github.com/odit-bit/jagatai/jagat/agent/driver"
 	"github.com/odit-bit/jagatai/jagat/agent/tooldef"
 )
@@ -14,6 +17,9 @@ type Config struct {
 	Server   ServerConfig     `yaml:"server"`
 	Provider Provider         `yaml:"provider"`
 	Tools    []tooldef.Config `yaml:"tools"`
+	Agent    AgentConfig      `yaml:"agent"`
+	// named agents served next to the default agent, request select one by name.
+	Profiles []ProfileConfig `yaml:"profiles"`
 	// Observe  ObsConfig        `yaml:"observability"`
 	Metric Metric
 	Trace  Trace
@@ -25,13 +31,141 @@ type ServerConfig struct {
 	Debug   bool   `yaml:"debug"`
 }
 
+// name of the agent built from top level provider and tools.
+const DefaultProfile = "default"
+
+// agent selected by name, it shares tools and execution config of the default agent.
+type ProfileConfig struct {
+	Name string `yaml:"name"`
+	// provider of the profile, the default provider is used if not set.
+	Provider *Provider `yaml:"provider"`
+	// generation options, it overrides the options of the provider.
+	Options *driver.Config `yaml:"options"`
+	// system prompt of every run.
+	Instruction string `yaml:"instruction"`
+	// function names of tools and names of sub agents the profile may use, like the request tools field.
+	// nil means all, empty list disables tools.
+	Tools []string `yaml:"tools"`
+	// limit of every run, it can only tighten the agent budget and request can only tighten it.
+	Budget agent.Budget `yaml:"budget"`
+}
+
+// budget of the profile, unset limit is taken from the agent budget.
+func (pc ProfileConfig) budget(def agent.Budget) agent.Budget {
+	return def.Tighten(pc.Budget)
+}
+
+// provider of the profile.
+func (pc ProfileConfig) provider(def Provider) Provider {
+	p := def
+	if pc.Provider != nil {
+		p = *pc.Provider
+	}
+	if pc.Options != nil {
+		p.Options = *pc.Options
+	}
+	return p
+}
+
 // external llm provider
 type Provider struct {
+	// name of registered driver, see driver.Register.
 	Name     string        //`yaml:"name"`
 	Model    string        //`yaml:"model"`
 	ApiKey   string        //`yaml:"apikey"`
 	Endpoint string        //`yaml:"endpoint"`
-	Options  driver.Config //`yaml:"extra"`
+	Options  driver.Config //`yaml:"options"`
+	// driver specific settings, checked against the schema of the driver.
+	Extra map[string]any //`yaml:"extra"`
+}
+
+// agent execution config
+type AgentConfig struct {
+	// maximum number of tool calls executed concurrently in one step.
+	ToolConcurrency int `yaml:"toolConcurrency"`
+	// retries of a tool after it is called with invalid arguments, unset use the agent default.
+	ArgumentRetries *int `yaml:"argumentRetries"`
+	// limit of every run, request can only tighten it.
+	Budget agent.Budget `yaml:"budget"`
+	// store run checkpoint so failed run can be resumed.
+	Checkpoint CheckpointConfig `yaml:"checkpoint"`
+	// compact long history before it is sent to the provider.
+	Context ContextConfig `yaml:"context"`
+	// agents exposed as tools, the main agent delegate task to them.
+	SubAgents []SubAgentConfig `yaml:"subAgents"`
+}
+
+// agent exposed as tool of the main agent.
+type SubAgentConfig struct {
+	// tool name seen by the main agent.
+	Name string `yaml:"name"`
+	// tell the main agent when to delegate.
+	Description string `yaml:"description"`
+	// system prompt of the sub agent.
+	Instruction string `yaml:"instruction"`
+	// provider of the sub agent, the main provider is used if not set.
+	Provider *Provider `yaml:"provider"`
+	// tools of the sub agent, main tools are not shared.
+	Tools []tooldef.Config `yaml:"tools"`
+	// limit of every delegated run, it can only tighten the agent budget.
+	Budget agent.Budget `yaml:"budget"`
+}
+
+// budget of the sub agent, unset limit is taken from the agent budget.
+func (sc SubAgentConfig) budget(def agent.Budget) agent.Budget {
+	return def.Tighten(sc.Budget)
+}
+
+// history compaction config
+type ContextConfig struct {
+	// default estimated token budget of the history, zero disables compaction.
+	MaxTokens int `yaml:"maxTokens"`
+	// "drop_oldest", "keep_last" or "summarize".
+	Strategy agent.CompactStrategy `yaml:"strategy"`
+	// number of latest messages kept by keep_last and summarize strategy.
+	KeepLast int `yaml:"keepLast"`
+	// token budget by model name, it overrides MaxTokens.
+	Models []ModelContext `yaml:"models"`
+}
+
+type ModelContext struct {
+	Name      string `yaml:"name"`
+	MaxTokens int    `yaml:"maxTokens"`
+}
+
+// context window of the model.
+func (cc ContextConfig) window(model string) agent.ContextWindow {
+	cw := agent.ContextWindow{
+		MaxTokens: cc.MaxTokens,
+		Strategy:  cc.Strategy,
+		KeepLast:  cc.KeepLast,
+	}
+	for _, m := range cc.Models {
+		if m.Name == model {
+			cw.MaxTokens = m.MaxTokens
+		}
+	}
+	return cw
+}
+
+// run checkpoint storage
+type CheckpointConfig struct {
+	// "memory", "file" or empty to disable.
+	Type string `yaml:"type"`
+	// directory of checkpoint files, file type only.
+	Dir string `yaml:"dir"`
+	// time a run is kept after its last step and the number of runs kept, memory type only.
+	// unset use agent.DefaultCheckpointTTL and agent.DefaultMaxCheckpoints, negative is unlimited.
+	TTL     time.Duration `yaml:"ttl"`
+	MaxRuns int           `yaml:"maxRuns"`
+}
+
+// checkpoint of the profile, run is only resumed by the profile that started it.
+func (cc CheckpointConfig) profile(name string) CheckpointConfig {
+	if cc.Dir != "" {
+		cc.Dir = filepath.Join(cc.Dir, "profiles", name)
+	}
+	return cc
 }
 
 type ObsConfig struct {
@@ -64,5 +198,55 @@ func (c *Config) validate() error {
 		return errors.New("provider model is required")
 	}
 
+	if err := validateThinking(c.Provider.Options.Thinking); err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, sa := range c.Agent.SubAgents {
+		if sa.Name == "" {
+			return errors.New("sub agent name is required")
+		}
+		if names[sa.Name] {
+			return fmt.Errorf("sub agent name '%s' is already used", sa.Name)
+		}
+		names[sa.Name] = true
+		if sa.Provider != nil && (sa.Provider.Name == "" || sa.Provider.Model == "") {
+			return fmt.Errorf("sub agent '%s' provider name and model are required", sa.Name)
+		}
+	}
+
+	profiles := map[string]bool{DefaultProfile: true}
+	for _, pc := range c.Profiles {
+		if pc.Name == "" {
+			return errors.New("profile name is required")
+		}
+		if profiles[pc.Name] {
+			return fmt.Errorf("profile name '%s' is already used", pc.Name)
+		}
+		profiles[pc.Name] = true
+		if pc.Provider != nil && (pc.Provider.Name == "" || pc.Provider.Model == "") {
+			return fmt.Errorf("profile '%s' provider name and model are required", pc.Name)
+		}
+		if err := validateThinking(pc.provider(c.Provider).Options.Thinking); err != nil {
+			return fmt.Errorf("profile '%s': %w", pc.Name, err)
+		}
+	}
+
+	switch c.Agent.Context.Strategy {
+	case "", agent.CompactDropOldest, agent.CompactKeepLast, agent.CompactSummarize:
+	default:
+		return fmt.Errorf("unknown context strategy: %s", c.Agent.Context.Strategy)
+	}
+
 	return nil
 }
+
+func validateThinking(tc driver.ThinkingConfig) error {
+	switch tc.Level {
+	case "", driver.ThinkingLow, driver.ThinkingMedium, driver.ThinkingHigh:
+		return nil
+	default:
+		return fmt.Errorf("unknown thinking level: %s", tc.Level)
+	}
+}
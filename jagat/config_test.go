@@ -0,0 +1,37 @@
+package jagat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Budget(t *testing.T) {
+	def := agent.Budget{MaxSteps: 20, MaxToolCalls: 10, Timeout: 2 * time.Minute}
+
+	testCases := []struct {
+		name     string
+		budget   agent.Budget
+		expected agent.Budget
+	}{
+		{name: "unset", expected: def},
+		{
+			name:     "tighter",
+			budget:   agent.Budget{MaxSteps: 5, MaxCallsPerTool: 2},
+			expected: agent.Budget{MaxSteps: 5, MaxToolCalls: 10, MaxCallsPerTool: 2, Timeout: 2 * time.Minute},
+		},
+		{
+			name:     "looser",
+			budget:   agent.Budget{MaxToolCalls: 50, Timeout: time.Hour},
+			expected: def,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ProfileConfig{Budget: tc.budget}.budget(def))
+			assert.Equal(t, tc.expected, SubAgentConfig{Budget: tc.budget}.budget(def))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package jagat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -12,11 +13,38 @@ import (
 )
 
 type jagat struct {
-	Agent
+	*agent.Agent
+	models []Model
+	// named agents, only set in the default agent.
+	profiles map[string]*jagat
 }
 
+// list the configured models.
+func (j *jagat) Models() []Model {
+	return j.models
+}
+
+// agent of the named profile, empty name is the default profile.
+func (j *jagat) Profile(name string) (Agent, error) {
+	if name == "" || name == DefaultProfile {
+		return j, nil
+	}
+	p, ok := j.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, name)
+	}
+	return p, nil
+}
+
+var ErrProfileNotFound = errors.New("profile not found")
+
 type Agent interface {
-	Completion(ctx context.Context, msgs []*agent.Message) (*agent.Message, error)
+	Completion(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Result, error)
+	Resume(ctx context.Context, runID string, opts ...agent.CompletionOption) (*agent.Result, error)
+	CompletionStream(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (<-chan agent.Event, error)
+	Models() []Model
+	// agent of the named profile, empty name is the default profile.
+	Profile(name string) (Agent, error)
 }
 
 func New(ctx context.Context, cfg *Config) (*jagat, error) {
@@ -32,21 +60,7 @@ func New(ctx context.Context, cfg *Config) (*jagat, error) {
 	}
 
 	// llm provider
-	var provider agent.Provider
-	var err error
-
-	switch cfg.Provider.Name {
-
-	case "ollama":
-		provider, err = driver.NewOllamaAdapter(cfg.Provider.Model, cfg.Provider.ApiKey, &cfg.Provider.Options)
-
-	case "genai":
-		provider, err = driver.NewGeminiAdapter(cfg.Provider.Model, cfg.Provider.ApiKey, &cfg.Provider.Options)
-
-	default:
-		err = fmt.Errorf("unknown provider specified in config: %s", cfg.Provider.Name)
-
-	}
+	provider, err := newProvider(cfg.Provider)
 	if err != nil {
 		slog.Error("jagat init provider", "error", err)
 		return nil, err
@@ -58,16 +72,153 @@ func New(ctx context.Context, cfg *Config) (*jagat, error) {
 		slog.Error(err.Error())
 		return nil, err
 	}
-	toolOpt := agent.WithTool(t...)
+
+	// sub agents
+	for _, sc := range cfg.Agent.SubAgents {
+		if _, ok := agent.Tools(t).Get(sc.Name); ok {
+			return nil, fmt.Errorf("sub agent name '%s' is already used by a tool", sc.Name)
+		}
+		sa, err := newSubAgent(ctx, cfg, sc)
+		if err != nil {
+			slog.Error("jagat init sub agent", "name", sc.Name, "error", err)
+			return nil, err
+		}
+		t = append(t, sa)
+	}
 	if cfg.Server.Debug {
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 		slog.Debug("tools", "list", tooldef.RegisteredTools())
 	}
 
+	// checkpoint
+	cp, err := newCheckpointer(cfg.Agent.Checkpoint)
+	if err != nil {
+		slog.Error("jagat init checkpointer", "error", err)
+		return nil, err
+	}
+
 	// agent
-	a := agent.New(provider, toolOpt)
+	a := agent.New(
+		provider,
+		agent.WithTool(t...),
+		agent.WithToolConcurrency(cfg.Agent.ToolConcurrency),
+		agent.WithArgumentRetries(argumentRetries(cfg.Agent.ArgumentRetries)),
+		agent.WithBudget(cfg.Agent.Budget),
+		agent.WithCheckpointer(cp),
+		agent.WithContextWindow(cfg.Agent.Context.window(cfg.Provider.Model)),
+	)
+
+	j := &jagat{
+		Agent:    a,
+		models:   []Model{{ID: cfg.Provider.Model, OwnedBy: cfg.Provider.Name}},
+		profiles: map[string]*jagat{},
+	}
+
+	// profiles
+	for _, pc := range cfg.Profiles {
+		p, err := newProfile(cfg, pc, t)
+		if err != nil {
+			slog.Error("jagat init profile", "name", pc.Name, "error", err)
+			return nil, err
+		}
+		j.profiles[pc.Name] = p
+	}
 
+	return j, nil
+}
+
+// build agent of the profile, tools are picked from the tools of the default agent.
+func newProfile(cfg *Config, pc ProfileConfig, tools agent.Tools) (*jagat, error) {
+	p := pc.provider(cfg.Provider)
+	provider, err := newProvider(p)
+	if err != nil {
+		return nil, fmt.Errorf("profile '%s': %w", pc.Name, err)
+	}
+	if pc.Tools != nil {
+		if tools, err = tools.Only(pc.Tools...); err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", pc.Name, err)
+		}
+	}
+	cp, err := newCheckpointer(cfg.Agent.Checkpoint.profile(pc.Name))
+	if err != nil {
+		return nil, fmt.Errorf("profile '%s': %w", pc.Name, err)
+	}
+	a := agent.New(
+		provider,
+		agent.WithTool(tools...),
+		agent.WithInstruction(pc.Instruction),
+		agent.WithToolConcurrency(cfg.Agent.ToolConcurrency),
+		agent.WithArgumentRetries(argumentRetries(cfg.Agent.ArgumentRetries)),
+		agent.WithBudget(pc.budget(cfg.Agent.Budget)),
+		agent.WithCheckpointer(cp),
+		agent.WithContextWindow(cfg.Agent.Context.window(p.Model)),
+	)
 	return &jagat{
-		Agent: a,
+		Agent:  a,
+		models: []Model{{ID: p.Model, OwnedBy: p.Name}},
 	}, nil
 }
+
+func newProvider(p Provider) (agent.Provider, error) {
+	return driver.New(driver.ProviderConfig{
+		Name:     p.Name,
+		Model:    p.Model,
+		ApiKey:   p.ApiKey,
+		Endpoint: p.Endpoint,
+		Options:  p.Options,
+		Extra:    p.Extra,
+	})
+}
+
+// build agent from sub agent config, it share the execution config of the main agent, its budget tighten the main one.
+func newSubAgent(ctx context.Context, cfg *Config, sc SubAgentConfig) (*agent.SubAgent, error) {
+	p := cfg.Provider
+	if sc.Provider != nil {
+		p = *sc.Provider
+	}
+	provider, err := newProvider(p)
+	if err != nil {
+		return nil, fmt.Errorf("sub agent '%s': %w", sc.Name, err)
+	}
+	t, err := tooldef.Build(ctx, sc.Tools)
+	if err != nil {
+		return nil, fmt.Errorf("sub agent '%s': %w", sc.Name, err)
+	}
+	a := agent.New(
+		provider,
+		agent.WithTool(t...),
+		agent.WithToolConcurrency(cfg.Agent.ToolConcurrency),
+		agent.WithArgumentRetries(argumentRetries(cfg.Agent.ArgumentRetries)),
+		agent.WithBudget(sc.budget(cfg.Agent.Budget)),
+		agent.WithContextWindow(cfg.Agent.Context.window(p.Model)),
+	)
+	return agent.NewSubAgent(sc.Name, sc.Description, sc.Instruction, a)
+}
+
+// unset retries keep the agent default, 0 is a valid limit.
+func argumentRetries(n *int) int {
+	if n == nil {
+		return -1
+	}
+	return *n
+}
+
+func newCheckpointer(cfg CheckpointConfig) (agent.Checkpointer, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case "memory":
+		opts := []agent.MemoryCheckpointerOption{}
+		if cfg.TTL != 0 {
+			opts = append(opts, agent.WithCheckpointTTL(cfg.TTL))
+		}
+		if cfg.MaxRuns != 0 {
+			opts = append(opts, agent.WithMaxCheckpoints(cfg.MaxRuns))
+		}
+		return agent.NewMemoryCheckpointer(opts...), nil
+	case "file":
+		return agent.NewFileCheckpointer(cfg.Dir)
+	default:
+		return nil, fmt.Errorf("unknown checkpoint type specified in config: %s", cfg.Type)
+	}
+}
@@ -0,0 +1,59 @@
+package jagat
+
+import (
+	"testing"
+
+	"github.com/odit-bit/jagatai/jagat/agent/tooldef"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_Profiles(t *testing.T) {
+	cfg := &Config{
+		Server:   ServerConfig{Address: "127.0.0.1:11823"},
+		Provider: Provider{Name: "ollama", Model: "qwen3:1.7b"},
+		Tools:    []tooldef.Config{{Name: "clock"}},
+		Profiles: []ProfileConfig{
+			{Name: "ops", Instruction: "you are an ops assistant", Tools: []string{"get_current_time"}},
+			{Name: "support", Provider: &Provider{Name: "ollama", Model: "gemma3"}, Tools: []string{}},
+		},
+	}
+	j, err := New(t.Context(), cfg)
+	require.NoError(t, err)
+
+	def, err := j.Profile("")
+	require.NoError(t, err)
+	assert.Equal(t, []Model{{ID: "qwen3:1.7b", OwnedBy: "ollama"}}, def.Models())
+
+	support, err := j.Profile("support")
+	require.NoError(t, err)
+	assert.Equal(t, []Model{{ID: "gemma3", OwnedBy: "ollama"}}, support.Models())
+
+	_, err = j.Profile("sales")
+	assert.ErrorIs(t, err, ErrProfileNotFound)
+}
+
+func TestNew_ProfileInvalid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		profiles []ProfileConfig
+		expected string
+	}{
+		{name: "no name", profiles: []ProfileConfig{{}}, expected: "profile name is required"},
+		{name: "reserved name", profiles: []ProfileConfig{{Name: DefaultProfile}}, expected: "profile name 'default' is already used"},
+		{name: "duplicate", profiles: []ProfileConfig{{Name: "ops"}, {Name: "ops"}}, expected: "profile name 'ops' is already used"},
+		{name: "unknown tool", profiles: []ProfileConfig{{Name: "ops", Tools: []string{"mailer"}}}, expected: "profile 'ops': tool 'mailer' not found"},
+		{name: "unknown provider", profiles: []ProfileConfig{{Name: "ops", Provider: &Provider{Name: "acme", Model: "m"}}}, expected: "profile 'ops': unknown provider"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				Server:   ServerConfig{Address: "127.0.0.1:11823"},
+				Provider: Provider{Name: "ollama", Model: "qwen3:1.7b"},
+				Profiles: tc.profiles,
+			}
+			_, err := New(t.Context(), cfg)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
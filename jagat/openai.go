@@ -0,0 +1,608 @@
+package jagat
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/odit-bit/jagatai/jagat/agent"
+)
+
+// OpenAI Chat Completions compatible request.
+type OpenAIChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []OpenAIMessage `json:"messages"`
+	// restrict the run to these configured tools, the function name must match.
+	Tools []OpenAITool `json:"tools,omitempty"`
+	// "auto", "none", "required" or {"type":"function","function":{"name":...}}.
+	ToolChoice  json.RawMessage `json:"tool_choice,omitempty"`
+	Temperature *float32        `json:"temperature,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	// set include_usage to receive usage in the last stream chunk.
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+	// "text", "json_object" or "json_schema" with the schema of the answer.
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type OpenAIResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema *struct {
+		Name   string                     `json:"name"`
+		Schema *agent.ParameterDefinition `json:"schema"`
+	} `json:"json_schema,omitempty"`
+}
+
+// response schema of the format, nil if the answer is free text.
+func (rf *OpenAIResponseFormat) schema() (*agent.ParameterDefinition, error) {
+	if rf == nil {
+		return nil, nil
+	}
+	switch rf.Type {
+	case "", "text":
+		return nil, nil
+	case "json_object":
+		return &agent.ParameterDefinition{Type: agent.Parameter_Type_Object}, nil
+	case "json_schema":
+		if rf.JSONSchema == nil || rf.JSONSchema.Schema == nil {
+			return nil, fmt.Errorf("response_format json_schema need schema")
+		}
+		return rf.JSONSchema.Schema, nil
+	default:
+		return nil, fmt.Errorf("response_format type must be \"text\", \"json_object\" or \"json_schema\"")
+	}
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type OpenAIMessage struct {
+	Role       string           `json:"role,omitempty"`
+	Content    OpenAIContent    `json:"content,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// message content, it is encoded as plain string or array of parts.
+type OpenAIContent []OpenAIContentPart
+
+func (oc *OpenAIContent) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*oc = nil
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*oc = OpenAIContent{{Type: "text", Text: text}}
+		return nil
+	}
+	var parts []OpenAIContentPart
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return fmt.Errorf("content must be string or array of parts")
+	}
+	*oc = parts
+	return nil
+}
+
+func (oc OpenAIContent) MarshalJSON() ([]byte, error) {
+	if len(oc) == 1 && oc[0].Type == "text" {
+		return json.Marshal(oc[0].Text)
+	}
+	return json.Marshal([]OpenAIContentPart(oc))
+}
+
+type OpenAIContentPart struct {
+	// "text" or "image_url".
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *OpenAIImageURL `json:"image_url,omitempty"`
+}
+
+type OpenAIImageURL struct {
+	// only base64 data URL is supported, e.g "data:image/png;base64,...".
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type OpenAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+type OpenAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type OpenAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// OpenAI Chat Completions compatible response, also used for stream chunk.
+type OpenAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   *OpenAIUsage   `json:"usage,omitempty"`
+}
+
+type OpenAIUsage struct {
+	PromptTokens        int32 `json:"prompt_tokens"`
+	CompletionTokens    int32 `json:"completion_tokens"`
+	TotalTokens         int32 `json:"total_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int32 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int32 `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+}
+
+func newOpenAIUsage(u agent.Usage) *OpenAIUsage {
+	ou := &OpenAIUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	ou.PromptTokensDetails.CachedTokens = u.CachedTokens
+	ou.CompletionTokensDetails.ReasoningTokens = u.ThinkingTokens
+	return ou
+}
+
+type OpenAIChoice struct {
+	Index int `json:"index"`
+	// set in response.
+	Message *OpenAIMessage `json:"message,omitempty"`
+	// set in stream chunk.
+	Delta        *OpenAIMessage `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+// configured model, listed by /v1/models.
+type Model struct {
+	ID      string `json:"id"`
+	OwnedBy string `json:"owned_by"`
+}
+
+const (
+	finishStop = "stop"
+
+	openAIObjectCompletion = "chat.completion"
+	openAIObjectChunk      = "chat.completion.chunk"
+)
+
+func (req *OpenAIChatRequest) validate(models []Model) error {
+	if len(req.Messages) == 0 {
+		return fmt.Errorf("messages cannot be empty")
+	}
+	if req.Model != "" && !slices.ContainsFunc(models, func(m Model) bool { return m.ID == req.Model }) {
+		return fmt.Errorf("model '%s' does not exist", req.Model)
+	}
+	for i, t := range req.Tools {
+		if t.Type != "function" || t.Function.Name == "" {
+			return fmt.Errorf("tools[%d]: only function tool with name is supported", i)
+		}
+	}
+	if _, err := req.toolChoice(); err != nil {
+		return err
+	}
+	if _, err := req.ResponseFormat.schema(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// tool_choice is either a string or {"type":"function","function":{"name":...}} to force the named tool.
+func (req *OpenAIChatRequest) toolChoice() (string, error) {
+	if len(req.ToolChoice) == 0 {
+		return agent.ToolChoiceAuto, nil
+	}
+	var choice string
+	if err := json.Unmarshal(req.ToolChoice, &choice); err == nil {
+		switch choice {
+		case agent.ToolChoiceAuto, agent.ToolChoiceNone, agent.ToolChoiceRequired:
+			return choice, nil
+		}
+		return "", fmt.Errorf("tool_choice must be \"auto\", \"none\", \"required\" or function object")
+	}
+
+	var fn struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(req.ToolChoice, &fn); err != nil || fn.Type != "function" || fn.Function.Name == "" {
+		return "", fmt.Errorf("tool_choice must be \"auto\", \"none\", \"required\" or function object")
+	}
+	if len(req.Tools) > 0 && !slices.ContainsFunc(req.Tools, func(t OpenAITool) bool { return t.Function.Name == fn.Function.Name }) {
+		return "", fmt.Errorf("tool_choice function '%s' is not in tools", fn.Function.Name)
+	}
+	return fn.Function.Name, nil
+}
+
+// translate request fields into agent completion options, request must be validated.
+func (req *OpenAIChatRequest) options() []agent.CompletionOption {
+	opts := []agent.CompletionOption{}
+	choice, _ := req.toolChoice()
+	if choice == agent.ToolChoiceNone {
+		opts = append(opts, agent.WithAllowedTools())
+	} else if len(req.Tools) > 0 {
+		names := make([]string, len(req.Tools))
+		for i, t := range req.Tools {
+			names[i] = t.Function.Name
+		}
+		opts = append(opts, agent.WithAllowedTools(names...))
+	}
+	if choice != agent.ToolChoiceAuto && choice != agent.ToolChoiceNone {
+		opts = append(opts, agent.WithToolChoice(choice))
+	}
+	if req.Temperature != nil {
+		opts = append(opts, agent.WithTemperature(*req.Temperature))
+	}
+	if schema, _ := req.ResponseFormat.schema(); schema != nil {
+		opts = append(opts, agent.WithResponseSchema(*schema))
+	}
+	return opts
+}
+
+// convert OpenAI messages into agent messages, consecutive tool messages are merged into one.
+func (req *OpenAIChatRequest) messages() ([]*agent.Message, error) {
+	msgs := []*agent.Message{}
+	// tool response need the function name, the message only carry the call ID.
+	callNames := map[string]string{}
+
+	for i, om := range req.Messages {
+		msg := &agent.Message{}
+		switch om.Role {
+		case "system", "developer":
+			msg.Role = agent.RoleSystem
+		case "user":
+			msg.Role = agent.RoleUser
+		case "assistant":
+			msg.Role = agent.RoleAssistant
+		case "tool":
+			msg.Role = agent.RoleTool
+		default:
+			return nil, fmt.Errorf("messages[%d]: unknown role '%s'", i, om.Role)
+		}
+
+		if msg.Role == agent.RoleTool {
+			part, err := toolResponsePart(om, callNames)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			if last := len(msgs) - 1; last >= 0 && msgs[last].Role == agent.RoleTool {
+				msgs[last].Parts = append(msgs[last].Parts, part)
+				continue
+			}
+			msg.Parts = append(msg.Parts, part)
+			msgs = append(msgs, msg)
+			continue
+		}
+
+		for j, cp := range om.Content {
+			part, err := contentPart(cp)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d].content[%d]: %w", i, j, err)
+			}
+			msg.Parts = append(msg.Parts, part)
+		}
+		for _, tc := range om.ToolCalls {
+			callNames[tc.ID] = tc.Function.Name
+			msg.Parts = append(msg.Parts, &agent.Part{Toolcall: &agent.ToolCall{
+				ID:   tc.ID,
+				Type: "function",
+				Function: agent.FunctionCall{
+					Name:      tc.Function.Name,
+					Arguments: tc.Function.Arguments,
+				},
+			}})
+		}
+		if len(msg.Parts) == 0 {
+			return nil, fmt.Errorf("messages[%d]: content cannot be empty", i)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func contentPart(cp OpenAIContentPart) (*agent.Part, error) {
+	switch cp.Type {
+	case "text":
+		return &agent.Part{Text: cp.Text}, nil
+	case "image_url":
+		if cp.ImageURL == nil {
+			return nil, fmt.Errorf("image_url cannot be empty")
+		}
+		blob, err := decodeDataURL(cp.ImageURL.URL)
+		if err != nil {
+			return nil, err
+		}
+		return &agent.Part{Blob: blob}, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type '%s'", cp.Type)
+	}
+}
+
+// decode "data:<mime>;base64,<data>" into blob.
+func decodeDataURL(url string) (*agent.Blob, error) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return nil, fmt.Errorf("image url must be base64 data url")
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	mime, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !ok || !isBase64 || mime == "" {
+		return nil, fmt.Errorf("image url must be base64 data url")
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 image data: %w", err)
+	}
+	return &agent.Blob{Bytes: b, Mime: mime}, nil
+}
+
+func toolResponsePart(om OpenAIMessage, callNames map[string]string) (*agent.Part, error) {
+	if om.ToolCallID == "" {
+		return nil, fmt.Errorf("tool message need tool_call_id")
+	}
+	name := om.Name
+	if name == "" {
+		name = callNames[om.ToolCallID]
+	}
+
+	texts := []string{}
+	for _, cp := range om.Content {
+		if cp.Type != "text" {
+			return nil, fmt.Errorf("tool message content must be text")
+		}
+		texts = append(texts, cp.Text)
+	}
+	text := strings.Join(texts, "")
+
+	// tool output is json object in agent, wrap plain text result.
+	output := map[string]any{}
+	if err := json.Unmarshal([]byte(text), &output); err != nil {
+		output = map[string]any{"content": text}
+	}
+	return &agent.Part{ToolResponse: &agent.ToolResponse{
+		ID:     om.ToolCallID,
+		Name:   name,
+		Output: output,
+	}}, nil
+}
+
+// map provider finish reason, e.g gemini "MAX_TOKENS", into OpenAI finish reason.
+func openAIFinishReason(reason string) string {
+	switch strings.ToLower(reason) {
+	case "", "stop":
+		return finishStop
+	case "max_tokens", "length":
+		return "length"
+	case "safety", "recitation", "blocklist", "prohibited_content", "spii":
+		return "content_filter"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+func openAIError(c echo.Context, status int, typ, msg string) error {
+	return c.JSON(status, echo.Map{"error": echo.Map{"message": msg, "type": typ}})
+}
+
+// map completion error into OpenAI error, paused run is reported in native format.
+func openAICompletionError(c echo.Context, runID string, err error) error {
+	var interrupt *agent.Interrupt
+	if errors.As(err, &interrupt) {
+		return completionError(c, runID, err)
+	}
+	var budgetErr *agent.ErrBudgetExceeded
+	if errors.As(err, &budgetErr) {
+		return openAIError(c, http.StatusUnprocessableEntity, "budget_exceeded", budgetErr.Error())
+	}
+	var optionErr *agent.ErrInvalidOption
+	if errors.As(err, &optionErr) {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", optionErr.Error())
+	}
+	var outputErr *agent.ErrInvalidOutput
+	if errors.As(err, &outputErr) {
+		return openAIError(c, http.StatusUnprocessableEntity, "invalid_output", outputErr.Error())
+	}
+	return openAIError(c, http.StatusBadRequest, "server_error", "server unavailable")
+}
+
+func handleOpenAICompletions(root Agent) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if ok := IsJsonContentType(c.Request()); !ok {
+			return openAIError(c, http.StatusBadRequest, "invalid_request_error", "expecting json body")
+		}
+		// the OpenAI body has no profile field, profile is selected by path only.
+		a, err := selectProfile(c, root, "")
+		if err != nil {
+			return openAIError(c, profileStatus(err), "invalid_request_error", err.Error())
+		}
+
+		var input OpenAIChatRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&input); err != nil {
+			return openAIError(c, http.StatusBadRequest, "invalid_request_error", "bad json format: "+err.Error())
+		}
+		models := a.Models()
+		if err := input.validate(models); err != nil {
+			return openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		}
+		msgs, err := input.messages()
+		if err != nil {
+			return openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		}
+
+		model := input.Model
+		if model == "" && len(models) > 0 {
+			model = models[0].ID
+		}
+
+		runID := agent.NewRunID()
+		c.Response().Header().Set(HeaderRunID, runID)
+		opts := append(input.options(), agent.WithRunID(runID))
+		res := &OpenAIChatResponse{
+			ID:      "chatcmpl-" + runID,
+			Object:  openAIObjectCompletion,
+			Created: time.Now().Unix(),
+			Model:   model,
+		}
+
+		if input.Stream {
+			includeUsage := input.StreamOptions != nil && input.StreamOptions.IncludeUsage
+			// structured answer is validated at the end of the run, its deltas are not streamed.
+			schema, _ := input.ResponseFormat.schema()
+			return streamOpenAICompletion(c, a, res, msgs, opts, includeUsage, schema != nil)
+		}
+
+		output, err := a.Completion(c.Request().Context(), msgs, opts...)
+		if err != nil {
+			slog.Error("failed completion", "error", err, "run_id", runID)
+			return openAICompletionError(c, runID, err)
+		}
+
+		// structured answer is returned without the code fence the model may add.
+		text := output.Text()
+		if output.Output != nil {
+			text = string(output.Output)
+		}
+		finish := openAIFinishReason(output.FinishReason)
+		res.Choices = []OpenAIChoice{{
+			Message: &OpenAIMessage{
+				Role:    string(agent.RoleAssistant),
+				Content: OpenAIContent{{Type: "text", Text: text}},
+			},
+			FinishReason: &finish,
+		}}
+		res.Usage = newOpenAIUsage(output.Usage)
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+// write the run as OpenAI stream chunks, terminated by "data: [DONE]".
+func streamOpenAICompletion(c echo.Context, a Agent, res *OpenAIChatResponse, msgs []*agent.Message, opts []agent.CompletionOption, includeUsage, structured bool) error {
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	events, err := a.CompletionStream(ctx, msgs, opts...)
+	if err != nil {
+		return openAICompletionError(c, c.Response().Header().Get(HeaderRunID), err)
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, MIMEEventStream)
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	res.Object = openAIObjectChunk
+	chunk := func(delta *OpenAIMessage, finish *string) any {
+		r := *res
+		r.Choices = []OpenAIChoice{{Delta: delta, FinishReason: finish}}
+		return r
+	}
+	write := func(v any) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+
+	err = write(chunk(&OpenAIMessage{Role: string(agent.RoleAssistant)}, nil))
+	content := func(text string) {
+		if err == nil {
+			err = write(chunk(&OpenAIMessage{Content: OpenAIContent{{Type: "text", Text: text}}}, nil))
+		}
+	}
+	// text of intermediate tool call turn is not part of the answer,
+	// deltas of a turn are held back until its node ends without a tool call.
+	var pending []string
+	var streamed bool
+	flush := func() {
+		for _, text := range pending {
+			content(text)
+			streamed = true
+		}
+		pending = nil
+	}
+	for ev := range events {
+		if err != nil {
+			// client is gone, stop the run and drain remaining events.
+			cancel()
+			continue
+		}
+		switch ev.Type {
+		case agent.EventTextDelta:
+			if !structured {
+				pending = append(pending, ev.Text)
+			}
+
+		case agent.EventToolCall:
+			pending = nil
+
+		case agent.EventNodeEnd:
+			flush()
+
+		case agent.EventFinal:
+			flush()
+			switch {
+			case ev.Result.Output != nil:
+				// structured answer is the validated output, not the text of the answer turn.
+				content(string(ev.Result.Output))
+			case !streamed:
+				content(ev.Message.Text())
+			}
+			if err == nil {
+				finish := openAIFinishReason(ev.Result.FinishReason)
+				err = write(chunk(&OpenAIMessage{}, &finish))
+			}
+			// usage chunk has no choices.
+			if err == nil && includeUsage {
+				r := *res
+				r.Choices = []OpenAIChoice{}
+				r.Usage = newOpenAIUsage(ev.Result.Usage)
+				err = write(r)
+			}
+
+		case agent.EventError:
+			slog.Error("failed completion stream", "error", ev.Err, "run_id", ev.RunID)
+			frame := streamError(c.Response().Header().Get(HeaderRunID), ev.Err)
+			msg := frame.Error
+			if frame.Response != nil {
+				msg = "tool calls wait for approval"
+			}
+			err = write(echo.Map{"error": echo.Map{"message": msg, "type": "server_error"}})
+		}
+	}
+	if err == nil {
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package jagat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/odit-bit/jagatai/jagat/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleOpenAICompletions(t *testing.T) {
+	e := echo.New()
+	mockAgent := &mockAgent{
+		CompletionsFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error) {
+			o := agent.CompletionOptions{}
+			for _, fn := range opts {
+				fn(&o)
+			}
+			if len(msgs) != 4 {
+				return nil, fmt.Errorf("unexpected messages %d", len(msgs))
+			}
+			if msgs[0].Role != agent.RoleSystem || msgs[1].Parts[1].Blob.Mime != "image/png" {
+				return nil, fmt.Errorf("unexpected messages")
+			}
+			// both tool messages are merged
+			if len(msgs[3].Parts) != 2 || msgs[3].Parts[0].ToolResponse.Name != "xtime" {
+				return nil, fmt.Errorf("unexpected tool response")
+			}
+			if o.Temperature == nil || *o.Temperature != 0.5 {
+				return nil, fmt.Errorf("unexpected temperature")
+			}
+			return agent.NewTextMessage("assistant", "it is noon"), nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	body := `{
+	"model": "mock-model",
+	"temperature": 0.5,
+	"messages": [
+		{"role": "system", "content": "be brief"},
+		{"role": "user", "content": [
+			{"type": "text", "text": "what time is it?"},
+			{"type": "image_url", "image_url": {"url": "data:image/png;base64,aGVsbG8="}}
+		]},
+		{"role": "assistant", "content": null, "tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "xtime", "arguments": "{}"}},
+			{"id": "call_2", "type": "function", "function": {"name": "xtime", "arguments": "{}"}}
+		]},
+		{"role": "tool", "tool_call_id": "call_1", "content": "{\"time\":\"12:00\"}"},
+		{"role": "tool", "tool_call_id": "call_2", "content": "12:00"}
+	]
+}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var res OpenAIChatResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, "chat.completion", res.Object)
+	assert.Equal(t, "mock-model", res.Model)
+	require.Len(t, res.Choices, 1)
+	assert.Equal(t, "assistant", res.Choices[0].Message.Role)
+	assert.Equal(t, OpenAIContent{{Type: "text", Text: "it is noon"}}, res.Choices[0].Message.Content)
+	assert.Equal(t, "stop", *res.Choices[0].FinishReason)
+	require.NotNil(t, res.Usage)
+	assert.Equal(t, int32(3), res.Usage.PromptTokens)
+	assert.Equal(t, int32(5), res.Usage.TotalTokens)
+	assert.Equal(t, int32(1), res.Usage.PromptTokensDetails.CachedTokens)
+	assert.Equal(t, int32(1), res.Usage.CompletionTokensDetails.ReasoningTokens)
+	assert.Contains(t, rec.Body.String(), `"content":"it is noon"`)
+}
+
+func TestHandleOpenAICompletions_BadRequest(t *testing.T) {
+	e := echo.New()
+	RestHandler(context.Background(), &mockAgent{}, e)
+
+	testCases := []struct {
+		name          string
+		body          string
+		expectedError string
+	}{
+		{
+			name:          "unknown model",
+			body:          `{"model":"gpt-x","messages":[{"role":"user","content":"hi"}]}`,
+			expectedError: "model 'gpt-x' does not exist",
+		},
+		{
+			name:          "unknown role",
+			body:          `{"messages":[{"role":"robot","content":"hi"}]}`,
+			expectedError: "messages[0]: unknown role 'robot'",
+		},
+		{
+			name:          "remote image url",
+			body:          `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`,
+			expectedError: "messages[0].content[0]: image url must be base64 data url",
+		},
+		{
+			name:          "unsupported tool choice",
+			body:          `{"messages":[{"role":"user","content":"hi"}],"tool_choice":"any"}`,
+			expectedError: `tool_choice must be \"auto\", \"none\", \"required\" or function object`,
+		},
+		{
+			name:          "tool choice not in tools",
+			body:          `{"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"geocode"}}],"tool_choice":{"type":"function","function":{"name":"weather"}}}`,
+			expectedError: "tool_choice function 'weather' is not in tools",
+		},
+		{
+			name:          "unsupported response format",
+			body:          `{"messages":[{"role":"user","content":"hi"}],"response_format":{"type":"xml"}}`,
+			expectedError: `response_format type must be \"text\", \"json_object\" or \"json_schema\"`,
+		},
+		{
+			name:          "json schema without schema",
+			body:          `{"messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_schema","json_schema":{"name":"city"}}}`,
+			expectedError: "response_format json_schema need schema",
+		},
+		{
+			name:          "tool message without call id",
+			body:          `{"messages":[{"role":"tool","content":"ok"}]}`,
+			expectedError: "messages[0]: tool message need tool_call_id",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), tc.expectedError)
+		})
+	}
+}
+
+func TestHandleOpenAICompletions_Stream(t *testing.T) {
+	e := echo.New()
+	mockAgent := &mockAgent{
+		StreamFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (<-chan agent.Event, error) {
+			o := agent.CompletionOptions{}
+			for _, fn := range opts {
+				fn(&o)
+			}
+			events := make(chan agent.Event, 8)
+			if o.Tools == nil || len(o.Tools) != 0 {
+				events <- agent.Event{Type: agent.EventError, Err: fmt.Errorf("tools is not disabled")}
+			}
+			// text of the tool call turn is not streamed.
+			events <- agent.Event{Type: agent.EventTextDelta, Text: "let me check"}
+			events <- agent.Event{Type: agent.EventToolCall, ToolCall: &agent.ToolCall{ID: "call_0_0"}}
+			events <- agent.Event{Type: agent.EventTextDelta, Text: "hel"}
+			events <- agent.Event{Type: agent.EventTextDelta, Text: "lo"}
+			res := mockResult(agent.NewTextMessage("assistant", "hello"))
+			events <- agent.Event{Type: agent.EventFinal, Message: res.Message, Result: res}
+			close(events)
+			return events, nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	body := `{"messages":[{"role":"user","content":"hi"}],"stream":true,"stream_options":{"include_usage":true},"tool_choice":"none"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	frames := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	require.Len(t, frames, 6)
+	assert.Equal(t, "data: [DONE]", frames[5])
+
+	var usage OpenAIChatResponse
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(frames[4], "data: ")), &usage))
+	assert.Empty(t, usage.Choices)
+	require.NotNil(t, usage.Usage)
+	assert.Equal(t, int32(5), usage.Usage.TotalTokens)
+
+	var text string
+	for i, frame := range frames[:4] {
+		var chunk OpenAIChatResponse
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(frame, "data: ")), &chunk))
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		delta := chunk.Choices[0].Delta
+		if i == 0 {
+			assert.Equal(t, "assistant", delta.Role)
+		}
+		for _, p := range delta.Content {
+			text += p.Text
+		}
+		if i == 3 {
+			assert.Equal(t, "stop", *chunk.Choices[0].FinishReason)
+		}
+	}
+	assert.Equal(t, "hello", text)
+}
+
+func TestHandleModels(t *testing.T) {
+	e := echo.New()
+	RestHandler(context.Background(), &mockAgent{}, e)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"object":"list","data":[{"id":"mock-model","object":"model","owned_by":"mock"}]}`, rec.Body.String())
+}
+
+func TestHandleOpenAICompletions_ResponseFormat(t *testing.T) {
+	e := echo.New()
+	var got agent.CompletionOptions
+	mockAgent := &mockAgent{
+		CompletionsFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error) {
+			got = newMockOptions(opts)
+			return agent.NewTextMessage("assistant", `{"city":"Jakarta"}`), nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	testCases := []struct {
+		format   string
+		expected *agent.ParameterDefinition
+	}{
+		{format: `{"type":"text"}`},
+		{format: `{"type":"json_object"}`, expected: &agent.ParameterDefinition{Type: agent.Parameter_Type_Object}},
+		{
+			format: `{"type":"json_schema","json_schema":{"name":"city","schema":{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}}}`,
+			expected: &agent.ParameterDefinition{
+				Type:       agent.Parameter_Type_Object,
+				Properties: map[string]agent.ParameterDefinition{"city": {Type: agent.Parameter_Type_String}},
+				Required:   []string{"city"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			body := `{"messages":[{"role":"user","content":"largest city"}],"response_format":` + tc.format + `}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			assert.Equal(t, tc.expected, got.ResponseSchema)
+			assert.Contains(t, rec.Body.String(), `"content":"{\"city\":\"Jakarta\"}"`)
+		})
+	}
+}
+
+func TestHandleOpenAICompletions_StreamBeforeFinal(t *testing.T) {
+	release := make(chan struct{})
+	mockAgent := &mockAgent{
+		StreamFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (<-chan agent.Event, error) {
+			events := make(chan agent.Event)
+			go func() {
+				defer close(events)
+				events <- agent.Event{Type: agent.EventNodeStart, Node: agent.AgentNodeName}
+				events <- agent.Event{Type: agent.EventTextDelta, Text: "hello"}
+				events <- agent.Event{Type: agent.EventNodeEnd, Node: agent.AgentNodeName}
+				// the run is finished only after the client has read the answer.
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return
+				}
+				res := mockResult(agent.NewTextMessage("assistant", "hello"))
+				events <- agent.Event{Type: agent.EventFinal, Message: res.Message, Result: res}
+			}()
+			return events, nil
+		},
+	}
+	e := echo.New()
+	RestHandler(context.Background(), mockAgent, e)
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := `{"messages":[{"role":"user","content":"hi"}],"stream":true}`
+	// the answer held until the final event fails the read by timeout.
+	cli := &http.Client{Timeout: 5 * time.Second}
+	resp, err := cli.Post(ts.URL+"/v1/chat/completions", echo.MIMEApplicationJSON, strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	frames := bufio.NewScanner(resp.Body)
+	next := func() OpenAIChatResponse {
+		for frames.Scan() {
+			data, ok := strings.CutPrefix(frames.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var chunk OpenAIChatResponse
+			require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+			return chunk
+		}
+		t.Fatal("stream ended early")
+		return OpenAIChatResponse{}
+	}
+
+	// role chunk, then the answer before the final event.
+	assert.Equal(t, "assistant", next().Choices[0].Delta.Role)
+	content := next().Choices[0].Delta.Content
+	require.Len(t, content, 1)
+	assert.Equal(t, "hello", content[0].Text)
+
+	close(release)
+	last := next()
+	assert.Empty(t, last.Choices[0].Delta.Content)
+	assert.Equal(t, "stop", *last.Choices[0].FinishReason)
+}
+
+func TestHandleOpenAICompletions_StreamResponseFormat(t *testing.T) {
+	e := echo.New()
+	mockAgent := &mockAgent{
+		StreamFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (<-chan agent.Event, error) {
+			events := make(chan agent.Event, 4)
+			// the first answer is fenced, the output node validate and strip it.
+			events <- agent.Event{Type: agent.EventTextDelta, Text: "```json\n{\"city\":"}
+			events <- agent.Event{Type: agent.EventTextDelta, Text: "\"Jakarta\"}\n```"}
+			res := mockResult(agent.NewTextMessage("assistant", "```json\n{\"city\":\"Jakarta\"}\n```"))
+			res.Output = json.RawMessage(`{"city":"Jakarta"}`)
+			events <- agent.Event{Type: agent.EventFinal, Message: res.Message, Result: res}
+			close(events)
+			return events, nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	body := `{"messages":[{"role":"user","content":"largest city"}],"stream":true,"response_format":{"type":"json_object"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var text string
+	for _, frame := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n") {
+		var chunk OpenAIChatResponse
+		if json.Unmarshal([]byte(strings.TrimPrefix(frame, "data: ")), &chunk) != nil || len(chunk.Choices) == 0 {
+			continue
+		}
+		for _, p := range chunk.Choices[0].Delta.Content {
+			text += p.Text
+		}
+	}
+	assert.Equal(t, `{"city":"Jakarta"}`, text)
+}
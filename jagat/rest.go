@@ -2,6 +2,7 @@ package jagat
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/odit-bit/jagatai/jagat/agent"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 	"go.opentelemetry.io/otel"
@@ -77,27 +79,228 @@ func (s *Server) Start() error {
 
 // Request
 type ChatRequest struct {
+	// message format of content, 1 require parts tagged by type, see agent.MessageVersion.
+	// 0 also accept the legacy part shape, it is deprecated and removed in the next release.
+	Version int              `json:"version,omitempty"`
 	Content []*agent.Message `json:"content"`
+	// optional, tighten the configured budget for this request.
+	Budget *BudgetRequest `json:"budget,omitempty"`
+	// stream the run as server-sent events, same as "Accept: text/event-stream" header.
+	Stream bool `json:"stream,omitempty"`
+	// optional, names of configured tools the request may use, empty list disables tools.
+	Tools []string `json:"tools,omitempty"`
+	// optional, "auto", "none", "required" or name of the tool that must be called first.
+	ToolChoice string `json:"tool_choice,omitempty"`
+	// optional, the final answer must be JSON matching the schema, it is returned in ChatResponse.Output.
+	ResponseSchema *agent.ParameterDefinition `json:"response_schema,omitempty"`
+	// optional, ask the model to think and return the thinking in ChatResponse.Reasoning.
+	Reasoning bool `json:"reasoning,omitempty"`
+	// optional, name of the configured profile that run the request, the path profile takes precedence.
+	Profile string `json:"profile,omitempty"`
 }
 
+// per request budget, zero value means use the configured limit.
+type BudgetRequest struct {
+	MaxSteps        int `json:"max_steps,omitempty"`
+	MaxToolCalls    int `json:"max_tool_calls,omitempty"`
+	MaxCallsPerTool int `json:"max_calls_per_tool,omitempty"`
+	// duration string, e.g "30s"
+	Timeout string `json:"timeout,omitempty"`
+}
+
+func (br *BudgetRequest) toBudget() (agent.Budget, error) {
+	b := agent.Budget{
+		MaxSteps:        br.MaxSteps,
+		MaxToolCalls:    br.MaxToolCalls,
+		MaxCallsPerTool: br.MaxCallsPerTool,
+	}
+	if br.Timeout != "" {
+		d, err := time.ParseDuration(br.Timeout)
+		if err != nil {
+			return b, fmt.Errorf("invalid budget timeout: %w", err)
+		}
+		b.Timeout = d
+	}
+	return b, nil
+}
+
+// header that carry the run ID of the request.
+const HeaderRunID = "X-Run-ID"
+
+// header set when the request use deprecated format.
+const HeaderDeprecation = "Deprecation"
+
+// request body to resume failed run, it is optional.
+type ResumeRequest struct {
+	Budget    *BudgetRequest `json:"budget,omitempty"`
+	Reasoning bool           `json:"reasoning,omitempty"`
+	// profile that started the run.
+	Profile string `json:"profile,omitempty"`
+}
+
+// request body to decide tool calls of paused run.
+type ApprovalRequest struct {
+	// keyed by tool call ID.
+	Decisions map[string]agent.Approval `json:"decisions"`
+	Budget    *BudgetRequest            `json:"budget,omitempty"`
+	Reasoning bool                      `json:"reasoning,omitempty"`
+	// profile that started the run.
+	Profile string `json:"profile,omitempty"`
+}
+
+// status of the run in ChatResponse.
+const (
+	StatusCompleted       = "completed"
+	StatusPendingApproval = "pending_approval"
+)
+
 // Response
 type ChatResponse struct {
 	Created time.Time `json:"created"`
 	Text    string    `json:"text"`
+	// use it to resume the run if it failed.
+	RunID string `json:"run_id,omitempty"`
+	// echo the X-Request-ID header, generated if the request has none.
+	RequestID string `json:"request_id,omitempty"`
+	Status    string `json:"status,omitempty"`
+	// tool calls that wait for approval, see ApprovalRequest.
+	Pending []*agent.ToolCall `json:"pending,omitempty"`
+	// messages appended by the run: assistant tool calls, tool responses and the final answer.
+	// append them to the history to keep it faithful.
+	Messages     []*agent.Message `json:"messages,omitempty"`
+	Model        string           `json:"model,omitempty"`
+	FinishReason string           `json:"finish_reason,omitempty"`
+	Usage        agent.Usage      `json:"usage"`
+	Steps        []StepTiming     `json:"steps,omitempty"`
+	// final answer parsed as JSON, only set when the request has response_schema.
+	Output json.RawMessage `json:"output,omitempty"`
+	// thinking of the model, only set when the request has reasoning.
+	Reasoning string `json:"reasoning,omitempty"`
+	// message format of messages, see agent.MessageVersion.
+	Version int `json:"version"`
+}
+
+// execution time of single graph node.
+type StepTiming struct {
+	Node       string    `json:"node"`
+	Start      time.Time `json:"start"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// response of finished run, thought parts are left out unless the client ask for reasoning.
+func newChatResponse(c echo.Context, runID string, res *agent.Result, reasoning bool) ChatResponse {
+	steps := make([]StepTiming, len(res.Timings))
+	for i, t := range res.Timings {
+		steps[i] = StepTiming{Node: t.Node, Start: t.Start, DurationMS: t.Duration.Milliseconds()}
+	}
+	msgs := res.Messages
+	if !reasoning {
+		msgs = withoutThoughts(msgs)
+	}
+	resp := ChatResponse{
+		Created:      time.Now(),
+		Text:         res.Text(),
+		RunID:        runID,
+		RequestID:    c.Response().Header().Get(echo.HeaderXRequestID),
+		Status:       StatusCompleted,
+		Messages:     msgs,
+		Model:        res.Model,
+		FinishReason: res.FinishReason,
+		Usage:        res.Usage,
+		Steps:        steps,
+		Output:       res.Output,
+		Version:      agent.MessageVersion,
+	}
+	if reasoning {
+		resp.Reasoning = res.Reasoning()
+	}
+	return resp
+}
+
+// copy of messages without thought parts.
+func withoutThoughts(msgs []*agent.Message) []*agent.Message {
+	out := make([]*agent.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.Thought() == "" {
+			out = append(out, msg)
+			continue
+		}
+		parts := []*agent.Part{}
+		for _, p := range msg.Parts {
+			if p.Thought == "" {
+				parts = append(parts, p)
+			}
+		}
+		out = append(out, &agent.Message{Role: msg.Role, Parts: parts})
+	}
+	return out
 }
 
 func (cr *ChatRequest) validate() error {
+	if cr.Version < 0 || cr.Version > agent.MessageVersion {
+		return fmt.Errorf("unsupported version %d, latest is %d", cr.Version, agent.MessageVersion)
+	}
 	if len(cr.Content) == 0 {
-		return fmt.Errorf("messages cannot be nil")
+		return fmt.Errorf("content cannot be empty")
 	}
-	for _, msg := range cr.Content {
-		if len(msg.Parts) == 0 {
-			return fmt.Errorf("some message has no parts")
+	for i, msg := range cr.Content {
+		if msg == nil {
+			return fmt.Errorf("content[%d]: message is empty", i)
+		}
+		for j, p := range msg.Parts {
+			if p == nil {
+				return fmt.Errorf("content[%d].parts[%d]: part is empty", i, j)
+			}
+			if err := p.Validate(); err != nil {
+				return fmt.Errorf("content[%d].parts[%d]: %w", i, j, err)
+			}
+			if p.IsLegacy() && cr.Version >= agent.MessageVersion {
+				return fmt.Errorf("content[%d].parts[%d]: part type is required in version %d", i, j, cr.Version)
+			}
+		}
+		// role and empty parts.
+		if err := msg.Validate(); err != nil {
+			return fmt.Errorf("content[%d]: %w", i, err)
+		}
+	}
+	if cr.Budget != nil {
+		if _, err := cr.Budget.toBudget(); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+func (cr *ChatRequest) hasLegacyParts() bool {
+	for _, msg := range cr.Content {
+		for _, p := range msg.Parts {
+			if p.IsLegacy() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// translate request fields into agent completion options.
+func (cr *ChatRequest) options() []agent.CompletionOption {
+	// budget is already validated.
+	opts, _ := budgetOptions(cr.Budget)
+	if cr.Tools != nil {
+		opts = append(opts, agent.WithAllowedTools(cr.Tools...))
+	}
+	if cr.ToolChoice != "" {
+		opts = append(opts, agent.WithToolChoice(cr.ToolChoice))
+	}
+	if cr.ResponseSchema != nil {
+		opts = append(opts, agent.WithResponseSchema(*cr.ResponseSchema))
+	}
+	if cr.Reasoning {
+		opts = append(opts, agent.WithThink(true))
+	}
+	return opts
+}
+
 func RestHandler(ctx context.Context, a Agent, e *echo.Echo) {
 	if e == nil {
 		panic("got nil parameter")
@@ -114,6 +317,7 @@ func RestHandler(ctx context.Context, a Agent, e *echo.Echo) {
 
 	// otel middleware
 	e.Use(otelecho.Middleware("jagat-server"))
+	e.Use(middleware.RequestID())
 
 	//custom middleware to counter request
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -124,7 +328,53 @@ func RestHandler(ctx context.Context, a Agent, e *echo.Echo) {
 		}
 	})
 
-	e.POST("/v1/chat/completions", func(c echo.Context) error {
+	// routes of the default profile, and the same routes of named profile under /v1/profiles/:profile.
+	for _, g := range []*echo.Group{e.Group("/v1"), e.Group("/v1/profiles/:" + paramProfile)} {
+		profileRoutes(g, a)
+	}
+}
+
+// path parameter that select the profile.
+const paramProfile = "profile"
+
+// agent of the profile named by path or request field, the default profile if both are empty.
+func selectProfile(c echo.Context, a Agent, name string) (Agent, error) {
+	if p := c.Param(paramProfile); p != "" {
+		if name != "" && name != p {
+			return nil, fmt.Errorf("profile '%s' does not match path profile '%s'", name, p)
+		}
+		name = p
+	}
+	return a.Profile(name)
+}
+
+// map profile error into http status.
+func profileStatus(err error) int {
+	if errors.Is(err, ErrProfileNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func profileRoutes(g *echo.Group, root Agent) {
+	// OpenAI Chat Completions compatible.
+	g.POST("/chat/completions", handleOpenAICompletions(root))
+
+	// list configured models in OpenAI format.
+	g.GET("/models", func(c echo.Context) error {
+		a, err := selectProfile(c, root, "")
+		if err != nil {
+			return openAIError(c, profileStatus(err), "invalid_request_error", err.Error())
+		}
+		data := []echo.Map{}
+		for _, m := range a.Models() {
+			data = append(data, echo.Map{"id": m.ID, "object": "model", "owned_by": m.OwnedBy})
+		}
+		return c.JSON(200, echo.Map{"object": "list", "data": data})
+	})
+
+	// native format, the messages and response carry agent types.
+	g.POST("/agent/completions", func(c echo.Context) error {
 		slog.Debug("got request")
 		if ok := IsJsonContentType(c.Request()); !ok {
 			return c.JSON(400, echo.Map{"error": "expecting json body"})
@@ -138,22 +388,154 @@ func RestHandler(ctx context.Context, a Agent, e *echo.Echo) {
 
 		if err := input.validate(); err != nil {
 			slog.Error("validate error", "error", err)
-			return c.JSON(400, echo.Map{"error": "bad json format."})
+			return c.JSON(400, echo.Map{"error": err.Error()})
+		}
+		a, err := selectProfile(c, root, input.Profile)
+		if err != nil {
+			return c.JSON(profileStatus(err), echo.Map{"error": err.Error()})
 		}
+		if input.hasLegacyParts() {
+			c.Response().Header().Set(HeaderDeprecation, "true")
+			slog.Warn("request use deprecated legacy part shape, tag parts by type and set version", "version", agent.MessageVersion)
+		}
+
+		// run ID let the client resume the run if it failed.
+		runID := agent.NewRunID()
+		c.Response().Header().Set(HeaderRunID, runID)
+		opts := append(input.options(), agent.WithRunID(runID))
 
-		output, err := a.Completion(c.Request().Context(), input.Content)
+		if wantStream(c, &input) {
+			return streamCompletion(c, a, runID, input.Content, opts, input.Reasoning)
+		}
 
+		output, err := a.Completion(c.Request().Context(), input.Content, opts...)
 		if err != nil {
-			slog.Error("failed completion", "error", err)
-			return c.JSON(400, echo.Map{"error": "server unavailable"})
+			slog.Error("failed completion", "error", err, "run_id", runID)
+			return completionError(c, runID, err)
 		}
 
 		slog.Debug("request finish")
-		return c.JSON(200, ChatResponse{
-			Text: output.Text(),
-		})
+		return c.JSON(200, newChatResponse(c, runID, output, input.Reasoning))
 	})
 
+	// resume failed run from its last checkpoint, tool calls that already finished are not executed again.
+	g.POST("/runs/:id/resume", func(c echo.Context) error {
+		runID := c.Param("id")
+		c.Response().Header().Set(HeaderRunID, runID)
+
+		var input ResumeRequest
+		if c.Request().ContentLength > 0 {
+			if ok := IsJsonContentType(c.Request()); !ok {
+				return c.JSON(400, echo.Map{"error": "expecting json body"})
+			}
+			if err := c.Bind(&input); err != nil {
+				return c.JSON(400, echo.Map{"error": "bad json format"})
+			}
+		}
+
+		a, err := selectProfile(c, root, input.Profile)
+		if err != nil {
+			return c.JSON(profileStatus(err), echo.Map{"error": err.Error()})
+		}
+		opts, err := budgetOptions(input.Budget)
+		if err != nil {
+			return c.JSON(400, echo.Map{"error": err.Error()})
+		}
+		if input.Reasoning {
+			opts = append(opts, agent.WithThink(true))
+		}
+
+		output, err := a.Resume(c.Request().Context(), runID, opts...)
+		if err != nil {
+			slog.Error("failed resume", "error", err, "run_id", runID)
+			return completionError(c, runID, err)
+		}
+
+		return c.JSON(200, newChatResponse(c, runID, output, input.Reasoning))
+	})
+
+	// approve, edit or reject tool calls of paused run then resume it.
+	g.POST("/runs/:id/approval", func(c echo.Context) error {
+		runID := c.Param("id")
+		c.Response().Header().Set(HeaderRunID, runID)
+		if ok := IsJsonContentType(c.Request()); !ok {
+			return c.JSON(400, echo.Map{"error": "expecting json body"})
+		}
+
+		var input ApprovalRequest
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(400, echo.Map{"error": "bad json format"})
+		}
+		if len(input.Decisions) == 0 {
+			return c.JSON(400, echo.Map{"error": "decisions cannot be empty"})
+		}
+
+		a, err := selectProfile(c, root, input.Profile)
+		if err != nil {
+			return c.JSON(profileStatus(err), echo.Map{"error": err.Error()})
+		}
+		opts, err := budgetOptions(input.Budget)
+		if err != nil {
+			return c.JSON(400, echo.Map{"error": err.Error()})
+		}
+		opts = append(opts, agent.WithApprovals(input.Decisions))
+		if input.Reasoning {
+			opts = append(opts, agent.WithThink(true))
+		}
+
+		output, err := a.Resume(c.Request().Context(), runID, opts...)
+		if err != nil {
+			slog.Error("failed resume approval", "error", err, "run_id", runID)
+			return completionError(c, runID, err)
+		}
+
+		return c.JSON(200, newChatResponse(c, runID, output, input.Reasoning))
+	})
+
+}
+
+func budgetOptions(br *BudgetRequest) ([]agent.CompletionOption, error) {
+	opts := []agent.CompletionOption{}
+	if br != nil {
+		b, err := br.toBudget()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, agent.WithCompletionBudget(b))
+	}
+	return opts, nil
+}
+
+// map completion error into http response.
+func completionError(c echo.Context, runID string, err error) error {
+	var interrupt *agent.Interrupt
+	if errors.As(err, &interrupt) {
+		if pending, ok := interrupt.Value.(*agent.PendingApproval); ok {
+			return c.JSON(http.StatusAccepted, ChatResponse{
+				Created:   time.Now(),
+				RunID:     runID,
+				RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+				Status:    StatusPendingApproval,
+				Pending:   pending.Calls,
+			})
+		}
+	}
+	var budgetErr *agent.ErrBudgetExceeded
+	if errors.As(err, &budgetErr) {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": budgetErr.Error(), "run_id": runID})
+	}
+	var optionErr *agent.ErrInvalidOption
+	if errors.As(err, &optionErr) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": optionErr.Error(), "run_id": runID})
+	}
+	var outputErr *agent.ErrInvalidOutput
+	if errors.As(err, &outputErr) {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": outputErr.Error(), "problems": outputErr.Problems, "run_id": runID})
+	}
+	if errors.Is(err, agent.ErrCheckpointNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "run not found", "run_id": runID})
+	}
+	return c.JSON(400, echo.Map{"error": "server unavailable", "run_id": runID})
 }
 
 func IsJsonContentType(req *http.Request) bool {
@@ -2,12 +2,17 @@ package jagat
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/odit-bit/jagatai/api"
 	"github.com/odit-bit/jagatai/jagat/agent"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,15 +20,88 @@ import (
 
 // mockAgent provides a mock implementation of the Agent interface for testing.
 type mockAgent struct {
-	CompletionsFunc func(ctx context.Context, msgs []*agent.Message) (*agent.Message, error)
+	CompletionsFunc func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error)
+	ResumeFunc      func(ctx context.Context, runID string, opts ...agent.CompletionOption) (*agent.Message, error)
+	StreamFunc      func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (<-chan agent.Event, error)
+	// named profiles, the mock itself is the default profile.
+	profiles map[string]*mockAgent
+	model    string
 }
 
 // Completions implements the Agent interface for the mockAgent.
-func (m *mockAgent) Completion(ctx context.Context, msgs []*agent.Message) (*agent.Message, error) {
+func (m *mockAgent) Completion(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Result, error) {
+	msg := agent.NewTextMessage("assistant", "mock response")
 	if m.CompletionsFunc != nil {
-		return m.CompletionsFunc(ctx, msgs)
+		var err error
+		if msg, err = m.CompletionsFunc(ctx, msgs, opts...); err != nil {
+			return nil, err
+		}
+	}
+	res := mockResult(msg)
+	// structured run answer with the JSON text.
+	if o := newMockOptions(opts); o.ResponseSchema != nil {
+		res.Output = json.RawMessage(msg.Text())
+	}
+	return res, nil
+}
+
+func newMockOptions(opts []agent.CompletionOption) agent.CompletionOptions {
+	o := agent.CompletionOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+func (m *mockAgent) Resume(ctx context.Context, runID string, opts ...agent.CompletionOption) (*agent.Result, error) {
+	msg := agent.NewTextMessage("assistant", "mock resume")
+	if m.ResumeFunc != nil {
+		var err error
+		if msg, err = m.ResumeFunc(ctx, runID, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return mockResult(msg), nil
+}
+
+func mockResult(msg *agent.Message) *agent.Result {
+	return &agent.Result{
+		Message:      msg,
+		Messages:     []*agent.Message{msg},
+		Model:        "mock-model",
+		FinishReason: "STOP",
+		Usage:        agent.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5, CachedTokens: 1, ThinkingTokens: 1},
+		Timings:      []agent.StepTiming{{Node: agent.AgentNodeName, Duration: 1500 * time.Microsecond}},
 	}
-	return agent.NewTextMessage("assistant", "mock response"), nil
+}
+
+func (m *mockAgent) CompletionStream(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (<-chan agent.Event, error) {
+	if m.StreamFunc != nil {
+		return m.StreamFunc(ctx, msgs, opts...)
+	}
+	events := make(chan agent.Event, 1)
+	res := mockResult(agent.NewTextMessage("assistant", "mock response"))
+	events <- agent.Event{Type: agent.EventFinal, Message: res.Message, Result: res}
+	close(events)
+	return events, nil
+}
+
+func (m *mockAgent) Models() []Model {
+	if m.model != "" {
+		return []Model{{ID: m.model, OwnedBy: "mock"}}
+	}
+	return []Model{{ID: "mock-model", OwnedBy: "mock"}}
+}
+
+func (m *mockAgent) Profile(name string) (Agent, error) {
+	if name == "" || name == DefaultProfile {
+		return m, nil
+	}
+	p, ok := m.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, name)
+	}
+	return p, nil
 }
 
 func TestHandleAgentCompletions(t *testing.T) {
@@ -78,14 +156,14 @@ func TestHandleAgentCompletions(t *testing.T) {
 			requestBody:        "",
 			contentType:        echo.MIMEApplicationJSON,
 			expectedStatusCode: http.StatusBadRequest,
-			expectedResponse:   "bad json format",
+			expectedResponse:   "content cannot be empty",
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Create a new HTTP request and recorder
-			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tc.requestBody))
+			req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(tc.requestBody))
 			req.Header.Set(echo.HeaderContentType, tc.contentType)
 			rec := httptest.NewRecorder()
 
@@ -98,3 +176,475 @@ func TestHandleAgentCompletions(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleAgentCompletions_BudgetExceeded(t *testing.T) {
+	e := echo.New()
+	mockAgent := &mockAgent{
+		CompletionsFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error) {
+			o := agent.CompletionOptions{}
+			for _, fn := range opts {
+				fn(&o)
+			}
+			if o.Budget.MaxToolCalls != 1 {
+				return nil, fmt.Errorf("unexpected budget %v", o.Budget)
+			}
+			return nil, fmt.Errorf("failed: %w", &agent.ErrBudgetExceeded{Limit: agent.LimitToolCalls, Detail: "max 1 tool calls"})
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	body := `{"content":[{"role":"user","parts":[{"text":"hi"}]}],"budget":{"max_tool_calls":1,"timeout":"10s"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "max 1 tool calls")
+}
+
+func TestHandleResume(t *testing.T) {
+	e := echo.New()
+	mockAgent := &mockAgent{
+		ResumeFunc: func(ctx context.Context, runID string, opts ...agent.CompletionOption) (*agent.Message, error) {
+			if runID != "run-1" {
+				return nil, fmt.Errorf("load: %w", agent.ErrCheckpointNotFound)
+			}
+			return agent.NewTextMessage("assistant", "resumed"), nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	testCases := []struct {
+		name               string
+		runID              string
+		body               string
+		expectedStatusCode int
+		expectedResponse   string
+	}{
+		{name: "resume without body", runID: "run-1", expectedStatusCode: http.StatusOK, expectedResponse: `"run_id":"run-1"`},
+		{name: "resume with budget", runID: "run-1", body: `{"budget":{"max_steps":2}}`, expectedStatusCode: http.StatusOK, expectedResponse: "resumed"},
+		{name: "unknown run", runID: "run-2", expectedStatusCode: http.StatusNotFound, expectedResponse: "run not found"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/runs/"+tc.runID+"/resume", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tc.expectedResponse)
+			assert.Equal(t, tc.runID, rec.Header().Get(HeaderRunID))
+		})
+	}
+}
+
+func TestHandleApproval(t *testing.T) {
+	e := echo.New()
+	pendingCall := &agent.ToolCall{ID: "call_1", Type: "function", Function: agent.FunctionCall{Name: "send_message", Arguments: `{}`}}
+	mockAgent := &mockAgent{
+		CompletionsFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error) {
+			return nil, &agent.Interrupt{RunID: "run-1", Node: agent.ApprovalNodeName, Value: &agent.PendingApproval{Calls: []*agent.ToolCall{pendingCall}}}
+		},
+		ResumeFunc: func(ctx context.Context, runID string, opts ...agent.CompletionOption) (*agent.Message, error) {
+			o := agent.CompletionOptions{}
+			for _, fn := range opts {
+				fn(&o)
+			}
+			if o.Approvals["call_1"].Action != agent.ApprovalReject {
+				return nil, fmt.Errorf("unexpected approvals %v", o.Approvals)
+			}
+			return agent.NewTextMessage("assistant", "message not sent"), nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	body := `{"content":[{"role":"user","parts":[{"text":"send hello"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var pending ChatResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+	assert.Equal(t, StatusPendingApproval, pending.Status)
+	assert.Equal(t, []*agent.ToolCall{pendingCall}, pending.Pending)
+	assert.NotEmpty(t, pending.RunID)
+
+	body = `{"decisions":{"call_1":{"action":"reject","reason":"not now"}}}`
+	req = httptest.NewRequest(http.MethodPost, "/v1/runs/"+pending.RunID+"/approval", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "message not sent")
+}
+
+func TestHandleAgentCompletions_Stream(t *testing.T) {
+	e := echo.New()
+	mockAgent := &mockAgent{
+		StreamFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (<-chan agent.Event, error) {
+			events := make(chan agent.Event, 4)
+			events <- agent.Event{Type: agent.EventToolCall, Node: agent.AgentNodeName, ToolCall: &agent.ToolCall{ID: "call_1"}}
+			events <- agent.Event{Type: agent.EventTextDelta, Node: agent.AgentNodeName, Text: "hel"}
+			events <- agent.Event{Type: agent.EventTextDelta, Node: agent.AgentNodeName, Text: "lo"}
+			res := mockResult(agent.NewTextMessage("assistant", "hello"))
+			events <- agent.Event{Type: agent.EventFinal, Message: res.Message, Result: res}
+			close(events)
+			return events, nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	testCases := []struct {
+		name   string
+		body   string
+		accept string
+	}{
+		{
+			name: "stream field",
+			body: `{"content":[{"role":"user","parts":[{"text":"hi"}]}],"stream":true}`,
+		},
+		{
+			name:   "accept header",
+			body:   `{"content":[{"role":"user","parts":[{"text":"hi"}]}]}`,
+			accept: MIMEEventStream,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(echo.HeaderAccept, tc.accept)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, MIMEEventStream, rec.Header().Get(echo.HeaderContentType))
+
+			frames := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+			require.Len(t, frames, 4)
+			assert.True(t, strings.HasPrefix(frames[0], "event: tool_call\n"))
+			assert.True(t, strings.HasPrefix(frames[1], "event: text_delta\n"))
+
+			var final StreamEvent
+			require.True(t, strings.HasPrefix(frames[3], "event: final\ndata: "))
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(frames[3], "event: final\ndata: ")), &final))
+			require.NotNil(t, final.Response)
+			assert.Equal(t, "hello", final.Response.Text)
+			assert.Equal(t, StatusCompleted, final.Response.Status)
+			assert.Equal(t, rec.Header().Get(HeaderRunID), final.RunID)
+		})
+	}
+}
+
+func TestHandleAgentCompletions_StreamDisconnect(t *testing.T) {
+	cancelled := make(chan struct{})
+	mockAgent := &mockAgent{
+		StreamFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (<-chan agent.Event, error) {
+			events := make(chan agent.Event)
+			go func() {
+				defer close(events)
+				for {
+					select {
+					case events <- agent.Event{Type: agent.EventTextDelta, Text: "tick"}:
+					case <-ctx.Done():
+						close(cancelled)
+						return
+					}
+				}
+			}()
+			return events, nil
+		},
+	}
+	e := echo.New()
+	RestHandler(context.Background(), mockAgent, e)
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	cli := api.NewClient(ts.URL, "")
+	for ev, err := range cli.ChatStream(t.Context(), api.ChatRequest{Content: []*api.Message{api.NewTextMessage("user", "hi")}}) {
+		require.NoError(t, err)
+		assert.Equal(t, "tick", ev.Text)
+		break
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run is not cancelled after client disconnect")
+	}
+}
+
+func TestHandleAgentCompletions_Response(t *testing.T) {
+	e := echo.New()
+	RestHandler(context.Background(), &mockAgent{}, e)
+
+	body := `{"content":[{"role":"user","parts":[{"text":"hi"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res ChatResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, "req-1", res.RequestID)
+	assert.Equal(t, rec.Header().Get(HeaderRunID), res.RunID)
+	assert.False(t, res.Created.IsZero())
+	assert.Equal(t, "mock-model", res.Model)
+	assert.Equal(t, "STOP", res.FinishReason)
+	assert.Equal(t, agent.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5, CachedTokens: 1, ThinkingTokens: 1}, res.Usage)
+	require.Len(t, res.Messages, 1)
+	assert.Equal(t, "mock response", res.Messages[0].Text())
+	assert.Equal(t, []StepTiming{{Node: agent.AgentNodeName, DurationMS: 1}}, res.Steps)
+}
+
+func TestHandleAgentCompletions_ToolChoice(t *testing.T) {
+	e := echo.New()
+	var got agent.CompletionOptions
+	mockAgent := &mockAgent{
+		CompletionsFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error) {
+			got = agent.CompletionOptions{}
+			for _, fn := range opts {
+				fn(&got)
+			}
+			if got.ToolChoice == "unknown_tool" {
+				return nil, &agent.ErrInvalidOption{Err: errors.New("agent tool choice: tool 'unknown_tool' not found")}
+			}
+			return agent.NewTextMessage("assistant", "ok"), nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"content":[{"role":"user","parts":[{"text":"weather in Paris"}]}],"tools":["geocode","weather"],"tool_choice":"geocode"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"geocode", "weather"}, got.Tools)
+	assert.Equal(t, "geocode", got.ToolChoice)
+
+	rec = post(`{"content":[{"role":"user","parts":[{"text":"hi"}]}]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, got.Tools)
+	assert.Empty(t, got.ToolChoice)
+
+	rec = post(`{"content":[{"role":"user","parts":[{"text":"hi"}]}],"tool_choice":"unknown_tool"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "tool 'unknown_tool' not found")
+}
+
+func TestHandleAgentCompletions_ResponseSchema(t *testing.T) {
+	e := echo.New()
+	mockAgent := &mockAgent{
+		CompletionsFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error) {
+			o := newMockOptions(opts)
+			if o.ResponseSchema.Properties["city"].Type != agent.Parameter_Type_String {
+				return nil, &agent.ErrInvalidOutput{Problems: []string{"city: must be string, got number"}}
+			}
+			return agent.NewTextMessage("assistant", `{"city":"Jakarta"}`), nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"content":[{"role":"user","parts":[{"text":"largest city"}]}],"response_schema":{"type":"object","properties":{"city":{"type":"string"}}}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res ChatResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.JSONEq(t, `{"city":"Jakarta"}`, string(res.Output))
+
+	rec = post(`{"content":[{"role":"user","parts":[{"text":"largest city"}]}],"response_schema":{"type":"object","properties":{"city":{"type":"integer"}}}}`)
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"problems":["city: must be string, got number"]`)
+}
+
+func TestHandleAgentCompletions_Reasoning(t *testing.T) {
+	e := echo.New()
+	var got agent.CompletionOptions
+	mockAgent := &mockAgent{
+		CompletionsFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error) {
+			got = newMockOptions(opts)
+			return &agent.Message{Role: agent.RoleAssistant, Parts: []*agent.Part{{Thought: "user greets"}, {Text: "hello"}}}, nil
+		},
+	}
+	RestHandler(context.Background(), mockAgent, e)
+
+	testCases := []struct {
+		name      string
+		body      string
+		reasoning string
+		parts     int
+	}{
+		{name: "default", body: `{"content":[{"role":"user","parts":[{"text":"hi"}]}]}`, parts: 1},
+		{name: "opt in", body: `{"content":[{"role":"user","parts":[{"text":"hi"}]}],"reasoning":true}`, reasoning: "user greets", parts: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			var res ChatResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, "hello", res.Text)
+			assert.Equal(t, tc.reasoning, res.Reasoning)
+			assert.Equal(t, tc.reasoning != "", got.Think)
+			require.Len(t, res.Messages, 1)
+			assert.Len(t, res.Messages[0].Parts, tc.parts)
+		})
+	}
+}
+
+func TestHandleAgentCompletions_MessageFormat(t *testing.T) {
+	e := echo.New()
+	RestHandler(context.Background(), &mockAgent{}, e)
+
+	testCases := []struct {
+		name       string
+		body       string
+		status     int
+		expected   string
+		deprecated bool
+	}{
+		{
+			name:     "typed parts",
+			body:     `{"version":1,"content":[{"role":"user","parts":[{"type":"text","text":"hi"}]}]}`,
+			status:   http.StatusOK,
+			expected: `"version":1`,
+		},
+		{
+			name:       "legacy parts",
+			body:       `{"content":[{"role":"user","parts":[{"text":"hi"}]}]}`,
+			status:     http.StatusOK,
+			expected:   `"parts":[{"type":"text","text":"mock response"}]`,
+			deprecated: true,
+		},
+		{
+			name:     "legacy parts in version 1",
+			body:     `{"version":1,"content":[{"role":"user","parts":[{"type":"text","text":"hi"}]},{"role":"user","parts":[{"text":"hi"}]}]}`,
+			status:   http.StatusBadRequest,
+			expected: "content[1].parts[0]: part type is required in version 1",
+		},
+		{
+			name:     "two fields",
+			body:     `{"content":[{"role":"user","parts":[{"type":"text","text":"hi"}]},{"role":"user","parts":[{"type":"text","text":"hi"},{"type":"text","text":"hi","thought":"greet"}]}]}`,
+			status:   http.StatusBadRequest,
+			expected: "content[1].parts[1]: part must have exactly one field, got text and thought",
+		},
+		{
+			name:     "unknown role",
+			body:     `{"content":[{"role":"robot","parts":[{"type":"text","text":"hi"}]}]}`,
+			status:   http.StatusBadRequest,
+			expected: "content[0]: unknown role 'robot'",
+		},
+		{
+			name:     "unknown version",
+			body:     `{"version":2,"content":[{"role":"user","parts":[{"type":"text","text":"hi"}]}]}`,
+			status:   http.StatusBadRequest,
+			expected: "unsupported version 2, latest is 1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/agent/completions", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.status, rec.Code, rec.Body.String())
+			assert.Contains(t, rec.Body.String(), tc.expected)
+			assert.Equal(t, tc.deprecated, rec.Header().Get(HeaderDeprecation) == "true")
+		})
+	}
+}
+
+func TestHandleProfiles(t *testing.T) {
+	e := echo.New()
+	ops := &mockAgent{
+		model: "ops-model",
+		CompletionsFunc: func(ctx context.Context, msgs []*agent.Message, opts ...agent.CompletionOption) (*agent.Message, error) {
+			return agent.NewTextMessage(agent.RoleAssistant, "ops response"), nil
+		},
+		ResumeFunc: func(ctx context.Context, runID string, opts ...agent.CompletionOption) (*agent.Message, error) {
+			return agent.NewTextMessage(agent.RoleAssistant, "ops resume"), nil
+		},
+	}
+	RestHandler(context.Background(), &mockAgent{profiles: map[string]*mockAgent{"ops": ops}}, e)
+
+	chat := `{"content":[{"role":"user","parts":[{"type":"text","text":"hi"}]}]`
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{name: "default", method: http.MethodPost, path: "/v1/agent/completions", body: chat + `}`, status: http.StatusOK, expected: `"text":"mock response"`},
+		{name: "default by name", method: http.MethodPost, path: "/v1/profiles/default/agent/completions", body: chat + `}`, status: http.StatusOK, expected: `"text":"mock response"`},
+		{name: "path", method: http.MethodPost, path: "/v1/profiles/ops/agent/completions", body: chat + `}`, status: http.StatusOK, expected: `"text":"ops response"`},
+		{name: "field", method: http.MethodPost, path: "/v1/agent/completions", body: chat + `,"profile":"ops"}`, status: http.StatusOK, expected: `"text":"ops response"`},
+		{
+			name:     "field mismatch path",
+			method:   http.MethodPost,
+			path:     "/v1/profiles/ops/agent/completions",
+			body:     chat + `,"profile":"default"}`,
+			status:   http.StatusBadRequest,
+			expected: `profile 'default' does not match path profile 'ops'`,
+		},
+		{name: "unknown", method: http.MethodPost, path: "/v1/agent/completions", body: chat + `,"profile":"sales"}`, status: http.StatusNotFound, expected: `profile not found: 'sales'`},
+		{name: "resume", method: http.MethodPost, path: "/v1/profiles/ops/runs/run-1/resume", status: http.StatusOK, expected: `"text":"ops resume"`},
+		{name: "models", method: http.MethodGet, path: "/v1/profiles/ops/models", status: http.StatusOK, expected: `"id":"ops-model"`},
+		{
+			name:     "openai",
+			method:   http.MethodPost,
+			path:     "/v1/profiles/ops/chat/completions",
+			body:     `{"model":"ops-model","messages":[{"role":"user","content":"hi"}]}`,
+			status:   http.StatusOK,
+			expected: `"content":"ops response"`,
+		},
+		{
+			name:     "openai unknown",
+			method:   http.MethodPost,
+			path:     "/v1/profiles/sales/chat/completions",
+			body:     `{"messages":[{"role":"user","content":"hi"}]}`,
+			status:   http.StatusNotFound,
+			expected: `profile not found: 'sales'`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Contains(t, rec.Body.String(), tc.expected)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package jagat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/odit-bit/jagatai/jagat/agent"
+)
+
+const MIMEEventStream = "text/event-stream"
+
+// single server-sent event frame, the SSE event name is the same as Type.
+type StreamEvent struct {
+	agent.Event
+	// set in final event, the message is carried here instead of Event.Message.
+	Response *ChatResponse `json:"response,omitempty"`
+}
+
+// client ask for server-sent events by request field or accept header.
+func wantStream(c echo.Context, input *ChatRequest) bool {
+	return input.Stream || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), MIMEEventStream)
+}
+
+// run the completion and write its events as server-sent events.
+// the run is cancelled when the client disconnect, thought_delta is only sent if the client ask for reasoning.
+func streamCompletion(c echo.Context, a Agent, runID string, msgs []*agent.Message, opts []agent.CompletionOption, reasoning bool) error {
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	events, err := a.CompletionStream(ctx, msgs, opts...)
+	if err != nil {
+		slog.Error("failed completion stream", "error", err, "run_id", runID)
+		return completionError(c, runID, err)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, MIMEEventStream)
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+
+	for ev := range events {
+		if ev.Type == agent.EventThoughtDelta && !reasoning {
+			continue
+		}
+		ev.RunID = runID
+		frame := StreamEvent{Event: ev}
+		switch ev.Type {
+		case agent.EventFinal:
+			resp := newChatResponse(c, runID, ev.Result, reasoning)
+			frame.Response = &resp
+			frame.Message = nil
+
+		case agent.EventError:
+			slog.Error("failed completion stream", "error", ev.Err, "run_id", runID)
+			frame = streamError(runID, ev.Err)
+		}
+
+		if err := writeEvent(res, frame); err != nil {
+			// client is gone, stop the run and drain remaining events.
+			cancel()
+			for range events {
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// map completion error into final or error frame.
+func streamError(runID string, err error) StreamEvent {
+	var interrupt *agent.Interrupt
+	if errors.As(err, &interrupt) {
+		if pending, ok := interrupt.Value.(*agent.PendingApproval); ok {
+			return StreamEvent{
+				Event: agent.Event{Type: agent.EventFinal, RunID: runID},
+				Response: &ChatResponse{
+					RunID:   runID,
+					Status:  StatusPendingApproval,
+					Pending: pending.Calls,
+				},
+			}
+		}
+	}
+
+	msg := "server unavailable"
+	var budgetErr *agent.ErrBudgetExceeded
+	if errors.As(err, &budgetErr) {
+		msg = budgetErr.Error()
+	} else if errors.Is(err, agent.ErrCheckpointNotFound) {
+		msg = "run not found"
+	}
+	return StreamEvent{Event: agent.Event{Type: agent.EventError, RunID: runID, Error: msg}}
+}
+
+func writeEvent(res *echo.Response, ev StreamEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", ev.Type, b); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
@@ -6,9 +6,12 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/odit-bit/jagatai/api"
+	"github.com/odit-bit/jagatai/jagat/agent"
 	tele "gopkg.in/telebot.v4"
 )
 
@@ -37,9 +40,10 @@ func Handle(ctx context.Context, bot *tele.Bot, llmClient *api.Client, cache *Ch
 	})
 
 	h := Handler{
-		ctx:   ctx,
-		ai:    llmClient,
-		cache: cache,
+		ctx:       ctx,
+		ai:        llmClient,
+		cache:     cache,
+		approvals: map[int64]*pendingApproval{},
 	}
 
 	bot.Handle(tele.OnText, h.HandleText)
@@ -47,12 +51,30 @@ func Handle(ctx context.Context, bot *tele.Bot, llmClient *api.Client, cache *Ch
 	bot.Handle(tele.OnLocation, h.HandleLoc)
 	bot.Handle(tele.OnDocument, h.HandleDoc)
 	bot.Handle(tele.OnAudio, h.HandleAudio)
+	bot.Handle(&tele.Btn{Unique: btnApprove}, h.HandleApproval)
+	bot.Handle(&tele.Btn{Unique: btnReject}, h.HandleApproval)
 }
 
+// inline button unique for tool call approval.
+const (
+	btnApprove = "tool_approve"
+	btnReject  = "tool_reject"
+)
+
 type Handler struct {
 	ctx   context.Context
 	ai    *api.Client
 	cache *ChatCache
+
+	mx sync.Mutex
+	// run that wait for tool calls approval by chat ID.
+	approvals map[int64]*pendingApproval
+}
+
+type pendingApproval struct {
+	runID     string
+	calls     []*agent.ToolCall
+	decisions map[string]agent.Approval
 }
 
 func (h *Handler) HandleAudio(ctx tele.Context) error {
@@ -86,7 +108,7 @@ func (h *Handler) HandleAudio(ctx tele.Context) error {
 		slog.Error("failed generate content", "error", err)
 		return ctx.Send("server errror")
 	}
-	return ctx.Send(resp.Text)
+	return h.reply(ctx, resp)
 }
 
 func (h *Handler) HandleDoc(ctx tele.Context) error {
@@ -121,7 +143,7 @@ func (h *Handler) HandleDoc(ctx tele.Context) error {
 		slog.Error("failed generate content", "error", err)
 		return ctx.Send("server errror")
 	}
-	return ctx.Send(resp.Text)
+	return h.reply(ctx, resp)
 }
 
 func (h *Handler) HandleText(ctx tele.Context) error {
@@ -136,7 +158,7 @@ func (h *Handler) HandleText(ctx tele.Context) error {
 	if err != nil {
 		return ctx.Send("service unavailable")
 	}
-	return ctx.Send(res.Text)
+	return h.reply(ctx, res)
 }
 
 func (h *Handler) HandleLoc(ctx tele.Context) error {
@@ -150,7 +172,7 @@ func (h *Handler) HandleLoc(ctx tele.Context) error {
 	if err != nil {
 		return ctx.Send("service unavailable")
 	}
-	return ctx.Send(res.Text)
+	return h.reply(ctx, res)
 }
 
 func (h *Handler) HandlePhoto(ctx tele.Context) error {
@@ -184,7 +206,7 @@ func (h *Handler) HandlePhoto(ctx tele.Context) error {
 			slog.Error(err.Error())
 			return ctx.Send("error")
 		}
-		return ctx.Send(res.Text)
+		return h.reply(ctx, res)
 	}
 
 	return ctx.Send("picture not from telegram server")
@@ -206,13 +228,94 @@ func (h *Handler) do(ctx context.Context, id int64, query *api.Message) (*api.Ch
 		return nil, err
 	}
 
-	resp.Text = ParseThink(resp.Text)
+	return h.finish(id, resp), nil
+}
+
+// store the answer into chat history, run that wait for approval has no answer yet.
+func (h *Handler) finish(id int64, resp *api.ChatResponse) *api.ChatResponse {
+	sc := h.cache.Get(id)
+	if resp.Status == api.StatusPendingApproval {
+		h.mx.Lock()
+		h.approvals[id] = &pendingApproval{
+			runID:     resp.RunID,
+			calls:     resp.Pending,
+			decisions: map[string]agent.Approval{},
+		}
+		h.mx.Unlock()
+		sc.Save()
+		return resp
+	}
 
 	sc.Add(*api.NewTextMessage("assistant", resp.Text))
 	sc.Save()
-	return resp, nil
+	return resp
+}
+
+// send the answer, or ask user to approve tool calls with inline buttons.
+func (h *Handler) reply(ctx tele.Context, resp *api.ChatResponse) error {
+	if resp.Status != api.StatusPendingApproval {
+		return ctx.Send(resp.Text)
+	}
+
+	markup := &tele.ReplyMarkup{}
+	rows := []tele.Row{}
+	text := strings.Builder{}
+	text.WriteString("need your approval:\n")
+	for i, tc := range resp.Pending {
+		idx := strconv.Itoa(i)
+		fmt.Fprintf(&text, "%d. %s %s\n", i+1, tc.Function.Name, tc.Function.Arguments)
+		rows = append(rows, markup.Row(
+			markup.Data(fmt.Sprintf("approve %d", i+1), btnApprove, idx),
+			markup.Data(fmt.Sprintf("reject %d", i+1), btnReject, idx),
+		))
+	}
+	markup.Inline(rows...)
+	return ctx.Send(text.String(), markup)
+}
+
+// record user decision, the run is resumed after every tool call is decided.
+func (h *Handler) HandleApproval(ctx tele.Context) error {
+	id := ctx.Chat().ID
+	cb := ctx.Callback()
+
+	h.mx.Lock()
+	pending, ok := h.approvals[id]
+	if !ok {
+		h.mx.Unlock()
+		return ctx.Respond(&tele.CallbackResponse{Text: "no pending approval"})
+	}
+	idx, err := strconv.Atoi(cb.Data)
+	if err != nil || idx < 0 || idx >= len(pending.calls) {
+		h.mx.Unlock()
+		return ctx.Respond(&tele.CallbackResponse{Text: "unknown tool call"})
+	}
+	action := agent.ApprovalApprove
+	if cb.Unique == btnReject {
+		action = agent.ApprovalReject
+	}
+	pending.decisions[pending.calls[idx].ID] = agent.Approval{Action: action}
+	done := len(pending.decisions) == len(pending.calls)
+	if done {
+		delete(h.approvals, id)
+	}
+	h.mx.Unlock()
+
+	if err := ctx.Respond(&tele.CallbackResponse{Text: string(action)}); err != nil {
+		slog.Error("failed respond callback", "error", err)
+	}
+	if !done {
+		return nil
+	}
+
+	resp, err := h.ai.Approve(h.ctx, pending.runID, api.ApprovalRequest{Decisions: pending.decisions})
+	if err != nil {
+		slog.Error("failed resume approval", "error", err, "run_id", pending.runID)
+		return ctx.Send("service unavailable")
+	}
+	return h.reply(ctx, h.finish(id, resp))
 }
 
+// Deprecated: thinking is returned apart from the answer text, see api.ChatResponse.Reasoning.
 func ParseThink(msg string) string {
 	close := "</think>"
 	idx := strings.Index(msg, close)